@@ -0,0 +1,236 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/stuttgart-things/k2n/internal"
+	"github.com/stuttgart-things/k2n/internal/ai"
+)
+
+var (
+	auditLocation      string
+	auditLimit         int
+	auditShowFormat    string
+	auditReplayN       int
+	auditReplayDest    string
+	auditReplayModel   string
+	auditReplayProv    string
+	auditReplayBaseURL string
+	auditReplayWrite   string
+)
+
+// startAudit returns a new audit record if auditing is enabled, otherwise nil.
+func startAudit(command string, providerConfig *ai.ProviderConfig) *internal.AuditRecord {
+	if internal.AuditLocation(auditLocation) == "" {
+		return nil
+	}
+	return internal.NewAuditRecord(command, string(providerConfig.Type), providerConfig.Model)
+}
+
+// saveAudit stores a finished audit record. Failing to store it is reported but
+// does not fail the run.
+func saveAudit(record *internal.AuditRecord, report *internal.Report) {
+	if record == nil {
+		return
+	}
+	record.Finish(report)
+
+	store, err := internal.OpenAuditStore(internal.AuditLocation(auditLocation))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not open audit store: %v\n", err)
+		return
+	}
+	defer store.Close()
+
+	if err := store.Save(record); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not save audit record: %v\n", err)
+		return
+	}
+	fmt.Printf("🔏 Audit record %s saved\n", record.ID)
+}
+
+// openAuditStore opens the configured store for the audit subcommands.
+func openAuditStore() (internal.AuditStore, error) {
+	store, err := internal.OpenAuditStore(internal.AuditLocation(auditLocation))
+	if err != nil {
+		return nil, configError(err)
+	}
+	return store, nil
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect and replay the prompts and responses recorded in the audit store",
+	Long: `The 'audit' command works with the opt-in audit store. When --audit or
+K2N_AUDIT points to a directory or a SQLite file (sqlite:<file>, *.db, *.sqlite),
+every gen and talk run records the user, provider and model, the redacted prompts,
+the raw responses, the parsed result and the files written.`,
+}
+
+var auditListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recorded runs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openAuditStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		records, err := store.List()
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			fmt.Println("No audit records yet.")
+			return nil
+		}
+		if auditLimit > 0 && len(records) > auditLimit {
+			records = records[:auditLimit]
+		}
+
+		tableData := pterm.TableData{{"ID", "TIMESTAMP", "USER", "COMMAND", "MODEL", "CALLS", "FILES", "STATUS"}}
+		for _, r := range records {
+			command := r.Command
+			if r.ReplayOf != "" {
+				command += " (replay of " + r.ReplayOf + ")"
+			}
+			tableData = append(tableData, []string{
+				r.ID,
+				r.Timestamp.Format(time.RFC3339),
+				r.User,
+				command,
+				strings.Trim(r.Provider+"/"+r.Model, "/"),
+				fmt.Sprintf("%d", len(r.Exchanges)),
+				fmt.Sprintf("%d", len(r.Files)),
+				r.Status,
+			})
+		}
+		return pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+	},
+}
+
+var auditShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a recorded run with prompts, responses and written files",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := internal.ValidateReportFormat(auditShowFormat); err != nil || auditShowFormat == "" {
+			return configError(fmt.Errorf("unknown output format %q (supported: json, yaml)", auditShowFormat))
+		}
+		store, err := openAuditStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		record, err := store.Load(args[0])
+		if err != nil {
+			return err
+		}
+		return internal.WriteStructured(record, auditShowFormat, "")
+	},
+}
+
+var auditReplayCmd = &cobra.Command{
+	Use:   "replay <id>",
+	Short: "Send a recorded prompt again, to the same or a different model",
+	Long: `The 'replay' command sends a recorded prompt to the AI again and prints the
+response, or writes it with --destination. By default the first prompt of the
+run is replayed against the recorded provider and model; use --ai-provider and
+--ai-model to compare another model. Values redacted when the prompt was recorded
+stay redacted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openAuditStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		record, err := store.Load(args[0])
+		if err != nil {
+			return err
+		}
+		if auditReplayN < 1 || auditReplayN > len(record.Exchanges) {
+			return configError(fmt.Errorf("record %s has %d prompt(s), --prompt %d is out of range", record.ID, len(record.Exchanges), auditReplayN))
+		}
+		prompt := record.Exchanges[auditReplayN-1].Prompt
+
+		provider, model := auditReplayProv, auditReplayModel
+		if provider == "" {
+			provider = record.Provider
+			if model == "" {
+				model = record.Model
+			}
+		}
+		providerConfig, err := resolveProviderConfig(provider, model, auditReplayBaseURL)
+		if err != nil {
+			return configError(err)
+		}
+
+		replay := internal.NewAuditRecord("audit replay", string(providerConfig.Type), providerConfig.Model)
+		replay.ReplayOf = record.ID
+		report := internal.NewReport("audit replay")
+
+		var output string
+		var usage ai.Usage
+		err = runStep(fmt.Sprintf("Replaying %s against %s/%s...", record.ID, providerConfig.Type, providerConfig.Model), 2*time.Minute, func(context.Context) error {
+			var callErr error
+			output, usage, callErr = ai.CallAIWithUsage(providerConfig, prompt)
+			return callErr
+		})
+		replay.AddExchange(prompt, output, usage, err)
+		if err != nil {
+			report.Fail("ai", err)
+			saveAudit(replay, report)
+			return aiError(fmt.Errorf("error calling %s API: %w", providerConfig.Type, err))
+		}
+		replay.Parsed = internal.ParseGeneratedFiles(output)
+
+		if auditReplayDest == "" {
+			fmt.Println(output)
+			saveAudit(replay, report)
+			return nil
+		}
+
+		opts, err := newOutputOptions(auditReplayWrite, auditReplayDest)
+		if err != nil {
+			return configError(err)
+		}
+		err = internal.SaveOutputWithOptions(auditReplayDest, output, opts)
+		saveJournal(opts)
+		report.AddJournal(opts.Journal)
+		if err != nil {
+			report.Fail("output", err)
+		}
+		saveAudit(replay, report)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&auditLocation, "audit", "", "Record prompts and responses in an audit store: a directory or a SQLite file (or K2N_AUDIT env var)")
+
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditListCmd, auditShowCmd, auditReplayCmd)
+
+	auditListCmd.Flags().IntVarP(&auditLimit, "limit", "n", 20, "Maximum number of records to list (0 for all)")
+	auditShowCmd.Flags().StringVarP(&auditShowFormat, "output", "o", "yaml", "Output format: json or yaml")
+	auditReplayCmd.Flags().IntVar(&auditReplayN, "prompt", 1, "Number of the recorded prompt to replay, e.g. 2 for the first repair")
+	auditReplayCmd.Flags().StringVar(&auditReplayProv, "ai-provider", "", "AI provider to replay against (default: the recorded one)")
+	auditReplayCmd.Flags().StringVar(&auditReplayModel, "ai-model", "", "AI model to replay against (default: the recorded one)")
+	auditReplayCmd.Flags().StringVar(&auditReplayBaseURL, "ai-base-url", "", "Base URL for OpenRouter API (default from AI_BASE_URL env)")
+	auditReplayCmd.Flags().StringVar(&auditReplayDest, "destination", "", "Write the response instead of printing it: a file or a directory")
+	auditReplayCmd.Flags().StringVar(&auditReplayWrite, "overwrite", "always", "What to do with existing files: always, never, prompt or backup")
+}
@@ -0,0 +1,238 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/stuttgart-things/k2n/internal"
+	"github.com/stuttgart-things/k2n/internal/ai"
+)
+
+var (
+	batchParallel      int
+	batchResume        bool
+	batchStateFile     string
+	batchProvider      string
+	batchModel         string
+	batchBaseURL       string
+	batchMaxRepairs    int
+	batchValidateYAML  bool
+	batchCheckCommands []string
+	batchReport        string
+	batchRulesMode     string
+	batchReportFile    string
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <jobs.yaml>",
+	Short: "Generate many configurations from a job manifest",
+	Long: `The 'batch' command reads a job manifest and runs every job on a bounded pool
+of workers. Each job has its own instruction, usecase, examples, rulesets and
+destination; fields missing in a job are taken from the manifest defaults.
+
+The outcome of every job is stored in a state file next to the manifest, so a
+failed batch can be continued with --resume, which skips jobs that already
+succeeded and have not been changed since.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (runErr error) {
+		manifestPath := args[0]
+		restoreStdout := humanOutputToStderr(batchReport, batchReportFile)
+		defer restoreStdout()
+
+		internal.PrintBanner()
+
+		if err := internal.ValidateReportFormat(batchReport); err != nil {
+			return configError(err)
+		}
+		if _, err := internal.ParseRulesMode(batchRulesMode); err != nil {
+			return configError(err)
+		}
+		if batchParallel < 1 {
+			return configError(fmt.Errorf("--parallel must be at least 1"))
+		}
+
+		jobs, err := internal.LoadBatchManifest(manifestPath)
+		if err != nil {
+			return configError(err)
+		}
+
+		providerConfig, err := resolveProviderConfig(batchProvider, batchModel, batchBaseURL)
+		if err != nil {
+			return configError(err)
+		}
+
+		if batchStateFile == "" {
+			batchStateFile = internal.BatchStatePath(manifestPath)
+		}
+		state, err := internal.LoadBatchState(batchStateFile)
+		if err != nil {
+			return configError(err)
+		}
+		state.Manifest = manifestPath
+
+		internal.PrintEnvTable(map[string]string{
+			"MANIFEST":    manifestPath,
+			"JOBS":        fmt.Sprintf("%d", len(jobs)),
+			"PARALLEL":    fmt.Sprintf("%d", batchParallel),
+			"RESUME":      fmt.Sprintf("%t", batchResume),
+			"AI_PROVIDER": string(providerConfig.Type),
+			"AI_MODEL":    providerConfig.Model,
+		})
+		fmt.Println()
+
+		var validators []internal.Validator
+		if batchValidateYAML {
+			validators = append(validators, internal.ValidateYAML)
+		}
+		for _, check := range batchCheckCommands {
+			validators = append(validators, internal.CommandValidator(check))
+		}
+
+		done := 0
+		runner := &internal.BatchRunner{
+			Workers:    batchParallel,
+			Call:       batchCall(providerConfig, 2*time.Minute),
+			Validate:   internal.CombineValidators(validators...),
+			MaxRepairs: batchMaxRepairs,
+			RulesMode:  batchRulesMode,
+			Rulesets:   internal.RulesetSourcesFromEnv(),
+			JournalDir: internal.JournalDir(),
+			Command:    strings.Join(os.Args, " "),
+			OnDone: func(r internal.BatchResult) {
+				done++
+				printBatchResult(done, len(jobs), r)
+			},
+		}
+		if batchResume {
+			runner.Skip = state.Succeeded
+		}
+
+		startedAt := time.Now()
+		results := runner.Run(jobs)
+
+		state.Record(results)
+		if err := state.Save(batchStateFile); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Could not save batch state: %v\n", err)
+		}
+
+		fmt.Println()
+		printBatchSummary(results)
+
+		if batchReport != "" {
+			restoreStdout()
+			report := internal.NewBatchReport(manifestPath, startedAt, batchParallel, results)
+			report.Provider = string(providerConfig.Type)
+			report.Model = providerConfig.Model
+			if err := internal.WriteStructured(report, batchReport, batchReportFile); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Could not write report: %v\n", err)
+			}
+		}
+
+		summary := internal.SummarizeBatch(results)
+		switch {
+		case summary[internal.BatchFailed] > 0:
+			return fmt.Errorf("%d of %d job(s) failed, re-run with --resume to retry them", summary[internal.BatchFailed]+summary[internal.BatchInvalid], len(jobs))
+		case summary[internal.BatchInvalid] > 0:
+			return validationError(fmt.Errorf("%d of %d job(s) failed validation, re-run with --resume to retry them", summary[internal.BatchInvalid], len(jobs)))
+		}
+		return nil
+	},
+}
+
+// batchCall calls the AI provider with a timeout per request. Spinners are not
+// used because several jobs run at the same time.
+func batchCall(config *ai.ProviderConfig, timeout time.Duration) func(string) (string, ai.Usage, error) {
+	return func(prompt string) (string, ai.Usage, error) {
+		type answer struct {
+			output string
+			usage  ai.Usage
+			err    error
+		}
+		ch := make(chan answer, 1)
+		go func() {
+			output, usage, err := ai.CallAIWithUsage(config, prompt)
+			ch <- answer{output, usage, err}
+		}()
+		select {
+		case a := <-ch:
+			if a.err != nil {
+				return "", a.usage, fmt.Errorf("error calling %s API: %w", string(config.Type), a.err)
+			}
+			return a.output, a.usage, nil
+		case <-time.After(timeout):
+			return "", ai.Usage{}, fmt.Errorf("error calling %s API: timed out after %s", string(config.Type), timeout)
+		}
+	}
+}
+
+// batchStatusIcons decorate the status of a job on a terminal.
+var batchStatusIcons = map[internal.BatchStatus]string{
+	internal.BatchSucceeded: "✅",
+	internal.BatchInvalid:   "⚠️ ",
+	internal.BatchFailed:    "❌",
+	internal.BatchSkipped:   "⏭️ ",
+}
+
+// printBatchResult prints one status line for a finished job.
+func printBatchResult(done, total int, r internal.BatchResult) {
+	line := fmt.Sprintf("[%d/%d] %s: %s", done, total, r.Job.Name, r.Status)
+	if r.Status != internal.BatchSkipped {
+		line += fmt.Sprintf(" (%d attempt(s), %s)", r.Report.Attempts, r.Duration.Round(time.Millisecond))
+	}
+	if r.Err != nil {
+		line += ": " + r.Err.Error()
+	}
+	if !ciMode {
+		line = batchStatusIcons[r.Status] + " " + line
+	}
+	fmt.Println(line)
+}
+
+// printBatchSummary renders a table with one row per job followed by the totals.
+func printBatchSummary(results []internal.BatchResult) {
+	tableData := pterm.TableData{{"JOB", "STATUS", "ATTEMPTS", "FILES", "DURATION", "DESTINATION"}}
+	for _, r := range results {
+		attempts, files := "-", "-"
+		if r.Status != internal.BatchSkipped {
+			attempts = fmt.Sprintf("%d", r.Report.Attempts)
+			files = fmt.Sprintf("%d", len(r.Report.Files))
+		}
+		tableData = append(tableData, []string{
+			r.Job.Name,
+			string(r.Status),
+			attempts,
+			files,
+			r.Duration.Round(time.Millisecond).String(),
+			r.Job.Destination,
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+
+	summary := internal.SummarizeBatch(results)
+	fmt.Printf("\n%d succeeded, %d invalid, %d failed, %d skipped\n",
+		summary[internal.BatchSucceeded], summary[internal.BatchInvalid],
+		summary[internal.BatchFailed], summary[internal.BatchSkipped])
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+	batchCmd.Flags().IntVarP(&batchParallel, "parallel", "j", 4, "Number of jobs generated at the same time")
+	batchCmd.Flags().BoolVar(&batchResume, "resume", false, "Skip jobs that succeeded in the previous run and are unchanged")
+	batchCmd.Flags().StringVar(&batchStateFile, "state-file", "", "File recording the outcome of each job (default <manifest>.state.json)")
+	batchCmd.Flags().StringVar(&batchProvider, "ai-provider", "", "AI provider: openrouter or gemini (default from AI_PROVIDER env)")
+	batchCmd.Flags().StringVar(&batchModel, "ai-model", "", "AI model name (default from AI_MODEL env)")
+	batchCmd.Flags().StringVar(&batchBaseURL, "ai-base-url", "", "Base URL for OpenRouter API (default from AI_BASE_URL env)")
+	batchCmd.Flags().IntVar(&batchMaxRepairs, "max-repairs", 2, "Maximum number of repair attempts for jobs that do not set maxRepairs")
+	batchCmd.Flags().BoolVar(&batchValidateYAML, "validate-yaml", true, "Validate generated YAML files before writing them")
+	batchCmd.Flags().StringVar(&batchRulesMode, "rules", internal.RulesFix, "What to do with structured rulesets after generation: fix, check or off")
+	batchCmd.Flags().StringArrayVar(&batchCheckCommands, "check", nil, "Shell command used to check the output of every job; repeatable")
+	batchCmd.Flags().StringVar(&batchReport, "report", "", "Write a combined machine-readable run report: json or yaml")
+	batchCmd.Flags().StringVar(&batchReportFile, "report-file", "", "File for the run report (default stdout)")
+}
@@ -0,0 +1,325 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stuttgart-things/k2n/internal"
+	"github.com/stuttgart-things/k2n/internal/ai"
+)
+
+var (
+	chatExamplesDir         string
+	chatExampleFiles        string
+	chatExampleFileExt      string
+	chatRulesetEnvDir       string
+	chatRulesetUsecaseDir   string
+	chatRulesetEnvFiles     string
+	chatRulesetUsecaseFiles string
+	chatUsecase             string
+	chatDestination         string
+	chatProvider            string
+	chatModel               string
+	chatBaseURL             string
+	chatMaxRepairs          int
+	chatValidateYAML        bool
+	chatOverwrite           string
+	chatVerbose             bool
+	chatPostProcess         bool
+	chatRulesets            []string
+	chatExampleInclude      string
+	chatExampleExclude      string
+	chatExampleMaxSize      string
+	chatExampleMaxTotal     string
+	chatExampleSimilarity   float64
+)
+
+const chatHelp = `Type an instruction to generate or refine the current files, or a command:
+  /show           print the current files
+  /diff           show what the last instruction changed
+  /save [dest]    write the current files (default --destination)
+  /undo           revert the last instruction
+  /rules          print the loaded rulesets
+  /model [name]   show or switch the AI model
+  /help           show this help
+  /exit           leave the chat`
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Generate and refine configurations in an interactive session",
+	Long: `The 'chat' command starts an interactive session. Examples and rulesets are
+loaded once; every instruction refines the current set of generated files, with
+the conversation so far sent along as context. Files are only written on /save.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		internal.PrintBanner()
+
+		if _, err := internal.ParseOverwritePolicy(chatOverwrite); err != nil {
+			return configError(err)
+		}
+
+		providerConfig, err := resolveProviderConfig(chatProvider, chatModel, chatBaseURL)
+		if err != nil {
+			return configError(err)
+		}
+
+		sources, err := rulesetSources(chatRulesets)
+		if err != nil {
+			return configError(err)
+		}
+		maxSize, maxTotal, err := exampleSizeLimits(chatExampleMaxSize, chatExampleMaxTotal)
+		if err != nil {
+			return configError(err)
+		}
+		if err := validateSimilarity(chatExampleSimilarity); err != nil {
+			return configError(err)
+		}
+		inputs, err := internal.LoadInputs(internal.InputConfig{
+			ExamplesDirs:        internal.SplitAndTrimPaths(chatExamplesDir),
+			ExampleFiles:        internal.SplitAndTrimPaths(chatExampleFiles),
+			ExampleFileExt:      internal.SplitAndTrimExts(chatExampleFileExt),
+			RulesetEnvDirs:      internal.SplitAndTrimPaths(chatRulesetEnvDir),
+			RulesetUsecaseDirs:  internal.SplitAndTrimPaths(chatRulesetUsecaseDir),
+			RulesetEnvFiles:     internal.SplitAndTrimPaths(chatRulesetEnvFiles),
+			RulesetUsecaseFiles: internal.SplitAndTrimPaths(chatRulesetUsecaseFiles),
+			Rulesets:            sources,
+			Usecase:             chatUsecase,
+			ExampleInclude:      internal.SplitAndTrimPaths(chatExampleInclude),
+			ExampleExclude:      internal.SplitAndTrimPaths(chatExampleExclude),
+			ExampleMaxSize:      maxSize,
+			ExampleMaxTotal:     maxTotal,
+			ExampleSimilarity:   chatExampleSimilarity,
+		})
+		if err != nil {
+			return configError(err)
+		}
+
+		for _, w := range inputs.Warnings {
+			fmt.Println("⚠️  " + w)
+		}
+		if chatVerbose {
+			printGitSources(inputs.GitSources)
+		}
+		printSkippedFiles(inputs.SkippedFiles, chatVerbose)
+		printCollapsedExamples(inputs.CollapsedExamples, chatVerbose)
+		internal.PrintEnvTable(map[string]string{
+			"AI_PROVIDER": string(providerConfig.Type),
+			"AI_MODEL":    providerConfig.Model,
+			"USECASE":     chatUsecase,
+			"EXAMPLES":    fmt.Sprintf("%d", len(inputs.Examples)),
+			"RULESETS":    fmt.Sprintf("%d", len(inputs.RulesetPaths)),
+			"DESTINATION": chatDestination,
+		})
+		fmt.Println()
+		fmt.Println(chatHelp)
+
+		session := internal.NewChatSession(inputs, chatUsecase)
+		return runChat(session, providerConfig, os.Stdin)
+	},
+}
+
+// runChat reads instructions and commands from in until /exit or end of input.
+func runChat(session *internal.ChatSession, providerConfig *ai.ProviderConfig, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for {
+		fmt.Print("\nk2n> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "/") {
+			if err := chatTurn(session, providerConfig, line); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			}
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "/show":
+			if len(session.Files) == 0 {
+				fmt.Println("No files generated yet.")
+				continue
+			}
+			fmt.Println(session.Render())
+		case "/diff":
+			diff := session.Diff()
+			if diff == "" {
+				fmt.Println("Nothing changed in the last turn.")
+				continue
+			}
+			internal.PrintDiff(diff)
+		case "/save":
+			if err := chatSave(session, arg); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			}
+		case "/undo":
+			if !session.Undo() {
+				fmt.Println("Nothing to undo.")
+				continue
+			}
+			fmt.Printf("↩️  Reverted the last instruction, %d file(s) left.\n", len(session.Files))
+		case "/rules":
+			printChatRules(session.Inputs)
+		case "/model":
+			if err := switchChatModel(providerConfig, arg); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			}
+		case "/help":
+			fmt.Println(chatHelp)
+		case "/exit", "/quit":
+			return nil
+		default:
+			fmt.Printf("Unknown command %s, type /help for the list of commands.\n", command)
+		}
+	}
+}
+
+// switchChatModel shows the model of the provider or switches to name. Gemini
+// always uses the same model.
+func switchChatModel(providerConfig *ai.ProviderConfig, name string) error {
+	if providerConfig.Type == ai.ProviderGemini {
+		if name != "" && name != ai.GeminiModel {
+			return fmt.Errorf("the %s provider always uses %s, the model cannot be switched", providerConfig.Type, ai.GeminiModel)
+		}
+		fmt.Printf("Model: %s (%s)\n", ai.GeminiModel, providerConfig.Type)
+		return nil
+	}
+	if name != "" {
+		providerConfig.Model = name
+	}
+	fmt.Printf("Model: %s (%s)\n", providerConfig.Model, providerConfig.Type)
+	return nil
+}
+
+// chatTurn sends one instruction through the generate → validate → repair loop
+// and merges the answer into the session.
+func chatTurn(session *internal.ChatSession, providerConfig *ai.ProviderConfig, instruction string) error {
+	prompt := session.Prompt(instruction)
+	if chatVerbose {
+		fmt.Println(prompt)
+	}
+
+	callAI := func(p string) (string, error) {
+		var res string
+		err := runStep(fmt.Sprintf("CALLING %s AI...🚀", string(providerConfig.Type)), 2*time.Minute, func(context.Context) error {
+			var callErr error
+			res, callErr = ai.CallAI(providerConfig, p)
+			return callErr
+		})
+		if err != nil {
+			return "", fmt.Errorf("error calling %s API: %w", string(providerConfig.Type), err)
+		}
+		return res, nil
+	}
+
+	var validate internal.Validator
+	if chatValidateYAML {
+		validate = internal.ValidateYAML
+	}
+	result, err := internal.GenerateWithRepair(prompt, chatMaxRepairs, callAI, validate,
+		func(format string, a ...any) { fmt.Printf("🔁 "+format+"\n", a...) })
+	if err != nil {
+		return err
+	}
+	if !result.Passed {
+		fmt.Println("⚠️  Output still fails validation after all repair attempts.")
+	}
+
+	changed := session.Apply(instruction, result.Output)
+	if len(changed) == 0 {
+		fmt.Println("No files changed.")
+		return nil
+	}
+	fmt.Printf("✏️  Changed: %s (/diff to review, /save to write)\n", strings.Join(changed, ", "))
+	return nil
+}
+
+// chatSave writes the current files to dest, recording the write in the journal.
+func chatSave(session *internal.ChatSession, dest string) error {
+	if dest == "" {
+		dest = chatDestination
+	}
+	if dest == "" {
+		return fmt.Errorf("no destination, use /save <dest> or --destination")
+	}
+	if len(session.Files) == 0 {
+		return fmt.Errorf("no files generated yet")
+	}
+
+	opts, err := newOutputOptions(chatOverwrite, dest)
+	if err != nil {
+		return err
+	}
+	// The same steps as in gen, so saved files do not depend on the model.
+	output := session.Render()
+	if len(session.Inputs.Structured) > 0 {
+		output = applyStructuredRules(output, session.Inputs.Structured, nil)
+	}
+	if chatPostProcess {
+		output = applyPostProcess(output, session.Inputs.Structured, nil)
+	}
+	err = internal.SaveOutputWithOptions(dest, output, opts)
+	saveJournal(opts)
+	return err
+}
+
+// printChatRules prints the environment and use case rulesets of the session.
+func printChatRules(inputs *internal.Inputs) {
+	if len(inputs.EnvRules) == 0 && len(inputs.UsecaseRules) == 0 {
+		fmt.Println("No rulesets loaded.")
+		return
+	}
+	for _, p := range inputs.RulesetPaths {
+		fmt.Println("📄 " + p)
+	}
+	for _, r := range inputs.EnvRules {
+		fmt.Printf("\nEnvironment rule:\n%s\n", r)
+	}
+	for _, r := range inputs.UsecaseRules {
+		fmt.Printf("\nUse case rule:\n%s\n", r)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(chatCmd)
+	chatCmd.Flags().StringVar(&chatExampleFiles, "example-files", "", "Comma-separated list of example file paths")
+	chatCmd.Flags().StringVar(&chatExamplesDir, "examples-dirs", "", "Comma-separated list of directories containing example code files")
+	chatCmd.Flags().StringVar(&chatExampleFileExt, "example-file-ext", ".yaml,.tf", "Comma-separated list of allowed example file extensions (e.g., .yaml,.tf)")
+	chatCmd.Flags().StringVar(&chatExampleInclude, "example-include", "", "Comma-separated glob patterns relative to each examples dir; only matching files are loaded")
+	chatCmd.Flags().StringVar(&chatExampleExclude, "example-exclude", "", "Comma-separated glob patterns relative to each examples dir that are not loaded")
+	chatCmd.Flags().StringVar(&chatExampleMaxSize, "example-max-size", internal.DefaultExampleMaxSize, "Skip example files larger than this (0 for no limit)")
+	chatCmd.Flags().StringVar(&chatExampleMaxTotal, "example-max-total", "", "Stop loading examples once their total size reaches this (default no limit)")
+	chatCmd.Flags().Float64Var(&chatExampleSimilarity, "example-similarity", 0, "Collapse examples at least this similar (0-1) into the most representative one; 0 disables it")
+	chatCmd.Flags().StringVar(&chatRulesetEnvDir, "ruleset-env-dir", "", "Directory containing environment rulesets (optional)")
+	chatCmd.Flags().StringVar(&chatRulesetUsecaseDir, "ruleset-usecase-dir", "", "Directory containing use case rulesets (optional)")
+	chatCmd.Flags().StringVar(&chatRulesetEnvFiles, "ruleset-env-files", "", "Comma-separated list of environment ruleset files")
+	chatCmd.Flags().StringVar(&chatRulesetUsecaseFiles, "ruleset-usecase-files", "", "Comma-separated list of usecase ruleset files")
+	chatCmd.Flags().StringArrayVar(&chatRulesets, "ruleset", nil, "Ruleset file or directory for a layer as layer=path (repeatable)")
+	chatCmd.Flags().StringVar(&chatUsecase, "usecase", "", "usecase context for generation")
+	chatCmd.Flags().StringVar(&chatDestination, "destination", "", "Default destination for /save: a file or a directory")
+	chatCmd.Flags().StringVar(&chatProvider, "ai-provider", "", "AI provider: openrouter or gemini (default from AI_PROVIDER env)")
+	chatCmd.Flags().StringVar(&chatModel, "ai-model", "", "AI model name (default from AI_MODEL env)")
+	chatCmd.Flags().StringVar(&chatBaseURL, "ai-base-url", "", "Base URL for OpenRouter API (default from AI_BASE_URL env)")
+	chatCmd.Flags().IntVar(&chatMaxRepairs, "max-repairs", 2, "Maximum number of times failed output is sent back to the AI for repair")
+	chatCmd.Flags().BoolVar(&chatValidateYAML, "validate-yaml", true, "Validate generated YAML files after every instruction")
+	chatCmd.Flags().StringVar(&chatOverwrite, "overwrite", "always", "What to do with existing files on /save: always, never, prompt or backup")
+	chatCmd.Flags().BoolVar(&chatPostProcess, "postprocess", true, "Run the post-processing steps of structured rulesets on /save")
+	chatCmd.Flags().BoolVarP(&chatVerbose, "verbose", "v", false, "Print the prompt of every instruction")
+}
@@ -0,0 +1,63 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"charm.land/huh/v2/spinner"
+	"github.com/pterm/pterm"
+	"github.com/stuttgart-things/k2n/internal"
+	"golang.org/x/term"
+)
+
+// ciMode disables banner, spinners and colours. It is set with --ci or detected
+// from the CI environment variable or a stdout that is not a terminal.
+var ciMode bool
+
+// detectCI reports whether k2n runs non-interactively.
+func detectCI() bool {
+	if v := strings.ToLower(os.Getenv("CI")); v != "" && v != "false" && v != "0" {
+		return true
+	}
+	return !term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// applyCIMode switches terminal output to plain text when running in CI.
+func applyCIMode() {
+	if !ciMode {
+		return
+	}
+	internal.SetPlainOutput(true)
+	pterm.DisableStyling()
+}
+
+// runStep runs action with a timeout, showing a spinner on a terminal and a plain
+// log line in CI mode.
+func runStep(title string, timeout time.Duration, action func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if !ciMode {
+		return spinner.New().
+			Context(ctx).
+			Title(title).
+			ActionWithErr(action).
+			Run()
+	}
+
+	fmt.Fprintln(os.Stderr, title)
+	done := make(chan error, 1)
+	go func() { done <- action(ctx) }()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
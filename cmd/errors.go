@@ -0,0 +1,60 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"errors"
+)
+
+// Exit codes returned by k2n. They are part of the CLI contract for CI pipelines.
+const (
+	ExitOK         = 0 // success
+	ExitError      = 1 // unclassified error, e.g. writing output
+	ExitConfig     = 2 // invalid flags, missing configuration or unreadable inputs
+	ExitAI         = 3 // the AI provider call failed or returned an unusable answer
+	ExitValidation = 4 // generated output failed validation after all repairs
+	ExitAPI        = 5 // the claim-machinery-api or another remote API failed
+)
+
+// exitError carries the exit code for an error returned from a command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func configError(err error) error     { return &exitError{code: ExitConfig, err: err} }
+func aiError(err error) error         { return &exitError{code: ExitAI, err: err} }
+func validationError(err error) error { return &exitError{code: ExitValidation, err: err} }
+func apiError(err error) error        { return &exitError{code: ExitAPI, err: err} }
+
+// exitCode maps an error returned by a command to the process exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return ExitError
+}
+
+// errorStage names the stage of a run an error belongs to, used in run reports.
+func errorStage(err error) string {
+	switch exitCode(err) {
+	case ExitConfig:
+		return "config"
+	case ExitAI:
+		return "ai"
+	case ExitValidation:
+		return "validation"
+	case ExitAPI:
+		return "api"
+	default:
+		return "output"
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"charm.land/huh/v2/spinner"
+	"charm.land/huh/v2"
 
 	"github.com/spf13/cobra"
 	"github.com/stuttgart-things/k2n/internal"
@@ -27,82 +29,143 @@ var (
 	rulesetUsecaseDir   string
 	usecase             string
 	instruction         string
-	examples            []string
-	err                 error
 	rulesetEnvFiles     string
 	rulesetUsecaseFiles string
 	destination         string
 	verbose             bool
 	exampleFileExt      string
 	promptToAI          bool
-	generatedResult     string
 	aiprovider          string
 	aiproviderModel     string
 	aiproviderBaseURL   string
+	maxRepairs          int
+	validateYAML        bool
+	checkCommands       []string
+	planOutput          bool
+	applyPlan           bool
+	interactiveApply    bool
+	overwritePolicy     string
+	reportFormat        string
+	reportFile          string
+	templateValues      []string
+	templateSets        []string
+	refineFile          string
+	refineAllow         []string
+	rulesMode           string
+	rulesetLayers       []string
+	exampleTags         string
+	exampleInclude      string
+	exampleExclude      string
+	exampleMaxSize      string
+	exampleMaxTotal     string
+	exampleSimilarity   float64
+	contextFiles        string
+	contextDirs         string
+	contextMaxSize      string
+	contextKeepSecrets  bool
+	learnDestination    bool
+	gitCommit           bool
+	prBodyFile          string
+	splitMode           string
+	namePattern         string
+	kustomize           bool
+	kustomizeNamespace  string
+	kustomizeLabels     map[string]string
+	kustomizeNameSuffix string
+	postProcess         bool
 )
 
 var genCmd = &cobra.Command{
 	Use:   "gen",
 	Short: "Generate a claim/code configuration using AI based on examples and rulesets",
 	Long:  `The 'gen' command uses the Gemini AI model to generate configurations from code examples and optional rulesets.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) (runErr error) {
+
+		instruction, err := resolveInstruction(instruction, templateValues, templateSets)
+		if err != nil {
+			return configError(err)
+		}
 
 		allFlags := map[string]string{
-			"EXAMPLES-DIR":          examplesDir,
-			"EXAMPLE-FILES":         exampleFiles,
-			"RULESET-ENV-DIR":       rulesetEnvDir,
-			"RULESET-USECASE-DIR":   rulesetUsecaseDir,
-			"USECASE":               usecase,
-			"INSTRUCTION":           instruction,
-			"RULESET-ENV-FILES":     rulesetEnvFiles,
-			"RULESET-USECASE-FILES": rulesetUsecaseFiles,
-			"DESTINATION":           destination,
-			"PROMPT-TO-AI":          fmt.Sprintf("%t", promptToAI),
-			"VERBOSE":               fmt.Sprintf("%t", verbose),
+			"EXAMPLES-DIR":           examplesDir,
+			"EXAMPLE-FILES":          exampleFiles,
+			"RULESET-ENV-DIR":        rulesetEnvDir,
+			"RULESET-USECASE-DIR":    rulesetUsecaseDir,
+			"USECASE":                usecase,
+			"INSTRUCTION":            instruction,
+			"RULESET-ENV-FILES":      rulesetEnvFiles,
+			"RULESET-USECASE-FILES":  rulesetUsecaseFiles,
+			"DESTINATION":            destination,
+			"PROMPT-TO-AI":           fmt.Sprintf("%t", promptToAI),
+			"VERBOSE":                fmt.Sprintf("%t", verbose),
+			"MAX-REPAIRS":            fmt.Sprintf("%d", maxRepairs),
+			"RULES":                  rulesMode,
+			"REFINE":                 refineFile,
+			"LEARN-FROM-DESTINATION": fmt.Sprintf("%t", learnDestination),
+			"GIT-COMMIT":             fmt.Sprintf("%t", gitCommit),
+			"SPLIT":                  splitMode,
+			"KUSTOMIZE":              fmt.Sprintf("%t", kustomize),
 		}
 
+		restoreStdout := humanOutputToStderr(reportFormat, reportFile)
+		defer restoreStdout()
+
 		internal.PrintBanner()
 		internal.PrintEnvTable(allFlags)
 
-		// READ API KEY
-		apiKey := os.Getenv(envAPIKeyVar)
-		if apiKey == "" {
-			panic("AI_API_KEY is not set in environment")
+		if err := internal.ValidateReportFormat(reportFormat); err != nil {
+			return configError(err)
 		}
 
-		// SETUP PROVIDER CONFIGURATION
-		providerConfig := &ai.ProviderConfig{
-			APIKey: apiKey,
-		}
+		runReport := internal.NewReport("gen")
+		var auditRecord *internal.AuditRecord
+		defer func() {
+			if runErr != nil {
+				runReport.Fail(errorStage(runErr), runErr)
+			}
+			saveAudit(auditRecord, runReport)
+			restoreStdout()
+			writeReport(runReport, reportFormat, reportFile)
+		}()
 
-		// Use flag values or environment variables for provider settings
-		if aiprovider != "" {
-			providerConfig.Type = ai.ProviderType(aiprovider)
-		} else if envProvider := os.Getenv("AI_PROVIDER"); envProvider != "" {
-			providerConfig.Type = ai.ProviderType(envProvider)
-		} else {
-			providerConfig.Type = ai.ProviderOpenRouter
+		if _, err := internal.ParseOverwritePolicy(overwritePolicy); err != nil {
+			return configError(err)
 		}
-
-		// Configure provider-specific settings
-		switch providerConfig.Type {
-		case ai.ProviderOpenRouter:
-			if aiproviderModel != "" {
-				providerConfig.Model = aiproviderModel
-			} else if envModel := os.Getenv("AI_MODEL"); envModel != "" {
-				providerConfig.Model = envModel
-			} else {
-				providerConfig.Model = "openai/gpt-3.5-turbo"
+		if _, err := internal.ParseRulesMode(rulesMode); err != nil {
+			return configError(err)
+		}
+		if gitCommit {
+			if err := validateGitCommit(destination); err != nil {
+				return configError(err)
 			}
-			if aiproviderBaseURL != "" {
-				providerConfig.BaseURL = aiproviderBaseURL
-			} else if envURL := os.Getenv("AI_BASE_URL"); envURL != "" {
-				providerConfig.BaseURL = envURL
-			} else {
-				providerConfig.BaseURL = "https://openrouter.ai/api/v1/chat/completions"
+		}
+		var splitter *internal.ManifestSplitter
+		if splitMode != internal.SplitOff {
+			if refineFile != "" {
+				return configError(fmt.Errorf("--split cannot be combined with --refine"))
+			}
+			if learnDestination {
+				return configError(fmt.Errorf("--split cannot be combined with --learn-from-destination, which names files after the learned layout"))
+			}
+			if splitter, err = internal.NewManifestSplitter(splitMode, namePattern); err != nil {
+				return configError(err)
+			}
+		} else if namePattern != "" {
+			return configError(fmt.Errorf("--name-pattern requires --split"))
+		}
+		if kustomize {
+			if err := validateKustomize(destination); err != nil {
+				return configError(err)
 			}
-		case ai.ProviderGemini:
-			// Gemini doesn't require additional configuration
+		}
+		if ciMode && (interactiveApply || overwritePolicy == string(internal.OverwritePrompt)) {
+			return configError(fmt.Errorf("--interactive and --overwrite=prompt are not available in CI mode"))
+		}
+
+		// SETUP PROVIDER CONFIGURATION
+		providerConfig, err := resolveProviderConfig(aiprovider, aiproviderModel, aiproviderBaseURL)
+		if err != nil {
+			return configError(err)
 		}
 
 		// Add AI environment variables to flags display
@@ -115,6 +178,11 @@ var genCmd = &cobra.Command{
 			allFlags["AI_BASE_URL"] = providerConfig.BaseURL
 		}
 
+		runReport.SetConfig(allFlags)
+		runReport.Provider = string(providerConfig.Type)
+		runReport.Model = providerConfig.Model
+		auditRecord = startAudit("gen", providerConfig)
+
 		fmt.Println("\n📋 AI Configuration:")
 		internal.PrintEnvTable(map[string]string{
 			"AI_API_KEY":  "***",
@@ -123,53 +191,59 @@ var genCmd = &cobra.Command{
 			"AI_BASE_URL": providerConfig.BaseURL,
 		})
 
-		// READ EXAMPLES
-		if examplesDir != "" {
-			dirs := internal.SplitAndTrimPaths(examplesDir)
-			for _, dir := range dirs {
-				dirExamples, err := internal.LoadCodeExamplesWithExtensions(dir, internal.SplitAndTrimExts(exampleFileExt))
-				if err != nil {
-					panic(fmt.Errorf("failed to load examples from dir %s: %w", dir, err))
-				}
-				examples = append(examples, dirExamples...)
-			}
-		}
+		// READ EXAMPLES AND RULESETS
 		if exampleFiles != "" {
-			paths := internal.SplitAndTrimPaths(exampleFiles)
-			fmt.Println("Example file paths:", paths)
+			fmt.Println("Example file paths:", internal.SplitAndTrimPaths(exampleFiles))
+		}
+		inputConfig, err := genInputConfig()
+		if err != nil {
+			return configError(err)
+		}
+		inputs, err := internal.LoadInputs(inputConfig)
+		if err != nil {
+			return configError(err)
+		}
+		runReport.Examples = inputs.ExamplePaths
+		runReport.Rulesets = inputs.RulesetPaths
+		runReport.Sources = inputs.GitSources
+		runReport.Skipped = inputs.SkippedFiles
+		runReport.Collapsed = inputs.CollapsedExamples
+		runReport.Context = contextPaths(inputs.Context)
+		if verbose {
+			printGitSources(inputs.GitSources)
+		}
+		printSkippedFiles(inputs.SkippedFiles, verbose)
+		printCollapsedExamples(inputs.CollapsedExamples, verbose)
+		printContextFiles(inputs.Context)
 
-			fileExamples, err := internal.LoadExampleFilesWithExtensions(paths, internal.SplitAndTrimExts(exampleFileExt))
+		// LEARN LAYOUT AND NAMING OF AN EXISTING DESTINATION REPOSITORY
+		var conventions *internal.Conventions
+		if learnDestination {
+			conventions, err = learnConventions(destination, verbose)
 			if err != nil {
-				panic(err)
+				return configError(err)
+			}
+			runReport.Conventions = conventions
+			if text := conventions.PromptText(); text != "" {
+				inputs.Context = append(inputs.Context, internal.ContextFile{
+					Path:    destination,
+					Title:   "conventions of the destination",
+					Content: text,
+				})
 			}
-			examples = append(examples, fileExamples...)
 		}
 
-		if len(examples) == 0 {
-			fmt.Println("No examples provided. Proceeding without examples.")
-		} else {
-			examples = internal.DeduplicateStrings(examples)
+		for _, w := range inputs.Warnings {
+			fmt.Println("⚠️  " + w)
+			runReport.Warn("examples", "%s", w)
 		}
-
-		envRules, _ := internal.LoadRulesetsIfExists(rulesetEnvDir)
-		usecaseRules, _ := internal.LoadRulesetsIfExists(rulesetUsecaseDir)
-
-		if rulesetEnvFiles != "" {
-			files := internal.SplitAndTrimPaths(rulesetEnvFiles)
-			fileRules, err := internal.LoadExampleFiles(files)
-			if err != nil {
-				panic(err)
-			}
-			envRules = append(envRules, fileRules...)
+		if inputs.SkippedExamples > 0 {
+			fmt.Printf("🔎 Selected %d example(s) by metadata, %d skipped\n", len(inputs.Examples), inputs.SkippedExamples)
 		}
 
-		if rulesetUsecaseFiles != "" {
-			files := internal.SplitAndTrimPaths(rulesetUsecaseFiles)
-			fileRules, err := internal.LoadExampleFiles(files)
-			if err != nil {
-				panic(err)
-			}
-			usecaseRules = append(usecaseRules, fileRules...)
+		if len(inputs.Examples) == 0 && refineFile == "" {
+			fmt.Println("No examples provided. Proceeding without examples.")
+			runReport.Warn("examples", "no examples provided")
 		}
 
 		finalInstruction := instruction
@@ -177,44 +251,519 @@ var genCmd = &cobra.Command{
 			finalInstruction = fmt.Sprintf("Generate a %s configuration. Only return one file definition, no description.", usecase)
 		}
 
-		prompt := internal.BuildPrompt(examples, envRules, usecaseRules, usecase, finalInstruction)
+		// REFINE MODE EDITS AN EXISTING FILE INSTEAD OF GENERATING FROM EXAMPLES
+		var original string
+		if refineFile != "" {
+			if instruction == "" {
+				return configError(fmt.Errorf("--refine requires --instruction"))
+			}
+			data, err := os.ReadFile(refineFile)
+			if err != nil {
+				return configError(fmt.Errorf("failed to read file to refine: %w", err))
+			}
+			original = string(data)
+			if destination == "" {
+				destination = refineFile
+			}
+		}
+
+		var prompt string
+		if refineFile != "" {
+			prompt = internal.BuildRefinePrompt(refineFile, original, inputs.EnvRules, inputs.UsecaseRules, usecase, instruction)
+		} else {
+			prompt = internal.BuildPromptFromExamples(inputs.Examples, inputs.Context, inputs.EnvRules, inputs.UsecaseRules, usecase, finalInstruction)
+		}
+		runReport.SetPrompt(prompt)
 
 		if verbose {
 			fmt.Println(prompt)
 		}
 
-		if promptToAI && instruction != "" {
+		if !promptToAI {
+			return nil
+		}
+		if instruction == "" {
+			fmt.Println("⚠️  No instruction provided. Skipping AI call. Use --instruction to prompt the AI.")
+			runReport.Warn("gen", "no instruction provided, AI call skipped")
+			return nil
+		}
+
+		// CALL AI PROVIDER WITH GENERATE → VALIDATE → REPAIR LOOP
+		callAI := func(p string) (string, error) {
+			var res string
+			var usage ai.Usage
+			err := runStep(fmt.Sprintf("CALLING %s AI...🚀", string(providerConfig.Type)), 2*time.Minute, func(context.Context) error {
+				var callErr error
+				res, usage, callErr = ai.CallAIWithUsage(providerConfig, p)
+				return callErr
+			})
+			if auditRecord != nil {
+				auditRecord.AddExchange(p, res, usage, err)
+			}
+			if err != nil {
+				return "", fmt.Errorf("error calling %s API: %w", string(providerConfig.Type), err)
+			}
+			runReport.Usage.Add(usage)
+			return res, nil
+		}
+
+		var validators []internal.Validator
+		if validateYAML {
+			validators = append(validators, internal.ValidateYAML)
+		}
+		for _, check := range checkCommands {
+			validators = append(validators, internal.CommandValidator(check))
+		}
+		if refineFile != "" {
+			validators = append(validators, internal.RefineValidator(refineFile, original, instruction, refineAllow))
+		}
+		if len(inputs.Structured) > 0 && rulesMode != internal.RulesOff {
+			validators = append(validators, internal.StructuredRulesValidator(inputs.Structured, rulesMode == internal.RulesFix))
+		}
+		if splitter != nil {
+			validators = append(validators, internal.DuplicateObjects)
+		}
 
-			// CALL AI PROVIDER
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-			defer cancel()
-			spinnerErr := spinner.New().
-				Context(ctx).
-				Title(fmt.Sprintf("CALLING %s AI...🚀", string(providerConfig.Type))).
-				Action(func() {
-					res, err := ai.CallAI(providerConfig, prompt)
-					if err != nil {
-						fmt.Printf("ERROR CALLING %s API: %v\n", string(providerConfig.Type), err)
-						return
-					}
-					generatedResult = res
-				}).
-				Run()
+		result, err := internal.GenerateWithRepair(
+			prompt,
+			maxRepairs,
+			callAI,
+			internal.CombineValidators(validators...),
+			func(format string, a ...any) { fmt.Printf("🔁 "+format+"\n", a...) },
+		)
+		if err != nil {
+			return aiError(err)
+		}
+		runReport.Attempts = len(result.Attempts)
 
-			if spinnerErr != nil {
-				panic(spinnerErr)
+		if !result.Passed {
+			fmt.Println("⚠️  Output still fails validation after all repair attempts. Writing last result.")
+			for _, p := range result.Attempts[len(result.Attempts)-1].Problems {
+				runReport.Warn("validation", "%s", p)
 			}
+		}
 
-			if err := internal.SaveOutput(destination, generatedResult); err != nil {
-				panic(err)
+		output := result.Output
+		fixRules := len(inputs.Structured) > 0 && rulesMode == internal.RulesFix
+		if refineFile != "" {
+			output, err = internal.ExtractRefinedFile(output, refineFile, original)
+			if err != nil {
+				return aiError(err)
+			}
+			// Only the refined file is written, so only its fixes are reported.
+			if fixRules {
+				var fixes []internal.RuleViolation
+				output, fixes = internal.FixRefinedFile(output, refineFile, inputs.Structured)
+				reportRuleFixes(fixes, runReport)
+			}
+			printRefineChanges(original, output, instruction)
+		} else {
+			if fixRules {
+				output = applyStructuredRules(output, inputs.Structured, runReport)
+			}
+			if postProcess {
+				output = applyPostProcess(output, inputs.Structured, runReport)
+			}
+			if splitter != nil {
+				output, err = splitter.Split(output)
+				if err != nil {
+					return configError(err)
+				}
+			} else if conventions != nil {
+				var renames []internal.FileRename
+				output, renames = conventions.ApplyConventions(output)
+				for _, r := range renames {
+					fmt.Printf("📁 %s → %s\n", r.From, r.To)
+				}
 			}
-		} else if promptToAI && instruction == "" {
-			fmt.Println("⚠️  No instruction provided. Skipping AI call. Use --instruction to prompt the AI.")
+		}
+		gitInfo, withoutInfo := internal.ExtractGitInfo(output)
+		if gitInfo != nil {
+			fmt.Printf("🌿 Git metadata in %s: branch %s, %q\n", gitInfo.File, gitInfo.BranchName, gitInfo.PRTitle)
+			if gitCommit {
+				output = withoutInfo
+			}
+		}
+		if gitCommit {
+			if gitInfo == nil {
+				gitInfo = internal.DefaultGitInfo(time.Now())
+				fmt.Printf("🌿 No git metadata in the output, using branch %s\n", gitInfo.BranchName)
+				runReport.Warn("git", "no git metadata in the output, using branch %s", gitInfo.BranchName)
+			}
+			// Fail before anything is written.
+			if _, _, err := internal.CheckGitCommit(destination, gitInfo); err != nil {
+				return fmt.Errorf("git commit failed: %w", err)
+			}
+		}
+		if kustomize {
+			settings := internal.KustomizeSettings(inputs.Structured).Merge(internal.KustomizeOptions{
+				Namespace:    kustomizeNamespace,
+				CommonLabels: kustomizeLabels,
+				NameSuffix:   kustomizeNameSuffix,
+			})
+			var change *internal.KustomizationChange
+			output, change, err = internal.AddKustomization(output, destination, settings)
+			if err != nil {
+				return configError(err)
+			}
+			runReport.Kustomization = change
+			printKustomizationChange(change)
+		}
+		if auditRecord != nil {
+			auditRecord.Parsed = internal.ParseGeneratedFiles(output)
 		}
 
+		if err := writeGeneratedOutput(destination, output, refineFile != "", runReport); err != nil {
+			return err
+		}
+		if gitCommit {
+			if err := commitGeneratedFiles(destination, gitInfo, runReport); err != nil {
+				return err
+			}
+		}
+
+		if !result.Passed {
+			return validationError(fmt.Errorf("output failed validation after %d repair attempt(s)", maxRepairs))
+		}
+		return nil
 	},
 }
 
+// applyStructuredRules injects defaults and fixes rule violations in output and
+// reports what was changed. The report may be nil.
+func applyStructuredRules(output string, rulesets []*internal.StructuredRuleset, report *internal.Report) string {
+	fixed, violations := internal.ApplyStructuredRulesets(output, rulesets, true)
+	reportRuleFixes(violations, report)
+	return fixed
+}
+
+// reportRuleFixes prints the fixed violations and adds them to the report, if
+// there is one.
+func reportRuleFixes(violations []internal.RuleViolation, report *internal.Report) {
+	for _, v := range violations {
+		if v.Fixed {
+			fmt.Println("🛠️  " + v.String())
+			if report != nil {
+				report.Warn("rules", "%s", v)
+			}
+		}
+	}
+}
+
+// applyPostProcess runs the post-processing steps configured in the rulesets
+// and reports what was changed. The report may be nil.
+func applyPostProcess(output string, rulesets []*internal.StructuredRuleset, report *internal.Report) string {
+	processed, changes := internal.PostProcessOutput(output, internal.PostProcessSettings(rulesets))
+	for _, c := range changes {
+		fmt.Println("🧹 " + c.String())
+		if report != nil {
+			report.Warn("postprocess", "%s", c)
+		}
+	}
+	return processed
+}
+
+// validateGitCommit checks that --git-commit can commit to the destination
+// before the model is called.
+func validateGitCommit(dest string) error {
+	if dest == "" || dest == "stdout" {
+		return fmt.Errorf("--git-commit requires --destination in a git repository")
+	}
+	if planOutput {
+		return fmt.Errorf("--git-commit cannot be combined with --plan, which writes nothing")
+	}
+	_, err := internal.GitRepoRoot(dest)
+	return err
+}
+
+// commitGeneratedFiles commits the files written by this run on a new branch
+// named by the git metadata.
+func commitGeneratedFiles(dest string, info *internal.GitInfo, report *internal.Report) error {
+	var paths []string
+	for _, f := range report.Files {
+		paths = append(paths, f.Path)
+	}
+	commit, err := internal.CommitGeneratedFiles(dest, info, paths, prBodyFile)
+	if err != nil {
+		return fmt.Errorf("git commit failed: %w", err)
+	}
+	report.Git = commit
+	if commit.Commit == "" {
+		fmt.Println("🌿 Generated files are unchanged, nothing to commit")
+		return nil
+	}
+	fmt.Printf("🌿 Committed %d file(s) to branch %s as %s\n", len(commit.Files), commit.Branch, commit.Commit[:min(12, len(commit.Commit))])
+	fmt.Printf("📝 PR body written to %s\n", commit.BodyFile)
+	return nil
+}
+
+// validateKustomize checks that --kustomize writes into a directory.
+func validateKustomize(dest string) error {
+	if refineFile != "" {
+		return fmt.Errorf("--kustomize cannot be combined with --refine")
+	}
+	info, err := os.Stat(dest)
+	switch {
+	case err == nil && info.IsDir():
+		return nil
+	case os.IsNotExist(err) && strings.HasSuffix(dest, string(os.PathSeparator)):
+		return nil
+	}
+	return fmt.Errorf("--kustomize requires --destination to be a directory (an existing one or a path ending in %s)", string(os.PathSeparator))
+}
+
+func printKustomizationChange(change *internal.KustomizationChange) {
+	action := "Updating"
+	if change.Created {
+		action = "Creating"
+	}
+	if !change.Changed {
+		fmt.Printf("🧩 %s is up to date\n", change.Path)
+		return
+	}
+	fmt.Printf("🧩 %s %s with %d new resource(s)\n", action, change.Path, len(change.Added))
+	for _, r := range change.Added {
+		fmt.Printf("  + %s\n", r)
+	}
+}
+
+// learnConventions scans the destination directory for existing manifests and
+// prints what was learned.
+func learnConventions(dest string, verbose bool) (*internal.Conventions, error) {
+	info, err := os.Stat(dest)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("--learn-from-destination requires --destination to be an existing directory")
+	}
+	conventions, err := internal.LearnConventions(dest)
+	if err != nil {
+		return nil, err
+	}
+	if conventions.Empty() {
+		fmt.Printf("🧭 No conventions found in %d manifest(s) of %s\n", conventions.Manifests, dest)
+		return conventions, nil
+	}
+	fmt.Printf("🧭 Learned conventions from %d manifest(s) in %s\n", conventions.Manifests, dest)
+	if verbose {
+		fmt.Print(conventions.PromptText())
+	}
+	return conventions, nil
+}
+
+// printGitSources prints the commit every git source resolved to.
+func printGitSources(sources []internal.GitSource) {
+	for _, src := range sources {
+		fmt.Printf("📌 %s: %s at %s\n", src.URL, src.Ref, src.Commit)
+	}
+}
+
+// printSkippedFiles summarises the example files that were not loaded and,
+// when verbose, lists each with the reason.
+func printSkippedFiles(skipped []internal.SkippedFile, verbose bool) {
+	if len(skipped) == 0 {
+		return
+	}
+	if !verbose {
+		fmt.Printf("⏭️  Skipped %d example file(s), use --verbose to list them\n", len(skipped))
+		return
+	}
+	fmt.Printf("⏭️  Skipped %d example file(s):\n", len(skipped))
+	for _, f := range skipped {
+		fmt.Printf("   %s: %s\n", f.Path, f.Reason)
+	}
+}
+
+// printCollapsedExamples summarises the near-duplicate examples that were left
+// out and, when verbose, names the example each was collapsed into.
+func printCollapsedExamples(collapsed []internal.CollapsedExample, verbose bool) {
+	if len(collapsed) == 0 {
+		return
+	}
+	fmt.Printf("🧬 Collapsed %d near-duplicate example(s)\n", len(collapsed))
+	if verbose {
+		for _, c := range collapsed {
+			fmt.Printf("   %s ≈ %s (%.2f)\n", c.Path, c.Kept, c.Similarity)
+		}
+	}
+}
+
+// contextConfig collects the reference context flags.
+func contextConfig(files, dirs, maxSize string, keepSecrets bool) (internal.ContextConfig, error) {
+	limit, err := internal.ParseByteSize(maxSize)
+	if err != nil {
+		return internal.ContextConfig{}, fmt.Errorf("--context-max-size: %w", err)
+	}
+	return internal.ContextConfig{
+		Files:        internal.SplitAndTrimPaths(files),
+		Dirs:         internal.SplitAndTrimPaths(dirs),
+		MaxTotalSize: limit,
+		KeepSecrets:  keepSecrets,
+	}, nil
+}
+
+// printContextFiles lists the reference context files and the ones with
+// redacted credentials.
+func printContextFiles(files []internal.ContextFile) {
+	for _, f := range files {
+		if f.Redacted {
+			fmt.Printf("📎 Context %s (credentials redacted)\n", f.Path)
+		} else {
+			fmt.Printf("📎 Context %s\n", f.Path)
+		}
+	}
+}
+
+func contextPaths(files []internal.ContextFile) []string {
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return paths
+}
+
+// validateSimilarity checks an --example-similarity threshold.
+func validateSimilarity(threshold float64) error {
+	if threshold < 0 || threshold > 1 {
+		return fmt.Errorf("--example-similarity must be between 0 and 1, got %g", threshold)
+	}
+	return nil
+}
+
+// exampleSizeLimits parses the --example-max-size and --example-max-total values.
+func exampleSizeLimits(maxSize, maxTotal string) (int64, int64, error) {
+	size, err := internal.ParseByteSize(maxSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("--example-max-size: %w", err)
+	}
+	total, err := internal.ParseByteSize(maxTotal)
+	if err != nil {
+		return 0, 0, fmt.Errorf("--example-max-total: %w", err)
+	}
+	return size, total, nil
+}
+
+// genInputConfig collects the example and ruleset locations from the gen flags.
+func genInputConfig() (internal.InputConfig, error) {
+	sources, err := rulesetSources(rulesetLayers)
+	if err != nil {
+		return internal.InputConfig{}, err
+	}
+	maxSize, maxTotal, err := exampleSizeLimits(exampleMaxSize, exampleMaxTotal)
+	if err != nil {
+		return internal.InputConfig{}, err
+	}
+	if err := validateSimilarity(exampleSimilarity); err != nil {
+		return internal.InputConfig{}, err
+	}
+	reference, err := contextConfig(contextFiles, contextDirs, contextMaxSize, contextKeepSecrets)
+	if err != nil {
+		return internal.InputConfig{}, err
+	}
+	return internal.InputConfig{
+		ExamplesDirs:        internal.SplitAndTrimPaths(examplesDir),
+		ExampleFiles:        internal.SplitAndTrimPaths(exampleFiles),
+		ExampleFileExt:      internal.SplitAndTrimExts(exampleFileExt),
+		RulesetEnvDirs:      internal.SplitAndTrimPaths(rulesetEnvDir),
+		RulesetUsecaseDirs:  internal.SplitAndTrimPaths(rulesetUsecaseDir),
+		RulesetEnvFiles:     internal.SplitAndTrimPaths(rulesetEnvFiles),
+		RulesetUsecaseFiles: internal.SplitAndTrimPaths(rulesetUsecaseFiles),
+		Rulesets:            sources,
+		Usecase:             usecase,
+		ExampleTags:         internal.SplitAndTrimPaths(exampleTags),
+		ExampleInclude:      internal.SplitAndTrimPaths(exampleInclude),
+		ExampleExclude:      internal.SplitAndTrimPaths(exampleExclude),
+		ExampleMaxSize:      maxSize,
+		ExampleMaxTotal:     maxTotal,
+		ExampleSimilarity:   exampleSimilarity,
+		Context:             reference,
+	}, nil
+}
+
+// printRefineChanges lists the structural changes of a refined YAML file and
+// marks the ones outside the area the rendered instruction asks for.
+func printRefineChanges(original, refined, instruction string) {
+	ext := strings.ToLower(filepath.Ext(refineFile))
+	if ext != ".yaml" && ext != ".yml" {
+		return
+	}
+	changes, err := internal.CompareYAML(original, refined)
+	if err != nil || len(changes) == 0 {
+		return
+	}
+	unexpected := map[internal.YAMLChange]bool{}
+	for _, c := range internal.UnexpectedChanges(changes, instruction, refineAllow) {
+		unexpected[c] = true
+	}
+
+	fmt.Println("\n🔍 Structural changes:")
+	for _, c := range changes {
+		if unexpected[c] {
+			fmt.Printf("  ⚠️  %s (unexpected)\n", c)
+		} else {
+			fmt.Printf("  ✓ %s\n", c)
+		}
+	}
+	fmt.Println()
+}
+
+// writeGeneratedOutput saves the result directly or, in plan mode, renders a diff
+// against the destination and writes only what was applied. With showDiff the
+// diff is always shown and the files are written unless --plan is set.
+func writeGeneratedOutput(dest, content string, showDiff bool, report *internal.Report) error {
+	opts, err := newOutputOptions(overwritePolicy, dest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		saveJournal(opts)
+		report.AddJournal(opts.Journal)
+	}()
+
+	if !showDiff && !planOutput && !applyPlan && !interactiveApply {
+		return internal.SaveOutputWithOptions(dest, content, opts)
+	}
+
+	changes, err := internal.PlanOutput(dest, content)
+	if err != nil {
+		return err
+	}
+	internal.PrintPlan(changes)
+
+	if interactiveApply {
+		changes, err = selectChanges(changes)
+		if err != nil {
+			return err
+		}
+	} else if planOutput || (!applyPlan && !showDiff) {
+		fmt.Println("Plan only, nothing written. Re-run with --apply to write the files.")
+		return nil
+	}
+
+	return internal.ApplyChanges(changes, opts)
+}
+
+// selectChanges asks for every added or modified file whether it should be written.
+func selectChanges(changes []internal.FileChange) ([]internal.FileChange, error) {
+	var accepted []internal.FileChange
+	for _, c := range changes {
+		if c.Type == internal.ChangeUnchanged {
+			continue
+		}
+		write := true
+		if err := huh.NewConfirm().
+			Title(fmt.Sprintf("Write %s (%s)?", c.Path, c.Type)).
+			Affirmative("Accept").
+			Negative("Reject").
+			Value(&write).
+			Run(); err != nil {
+			return nil, err
+		}
+		if write {
+			accepted = append(accepted, c)
+		}
+	}
+	return accepted, nil
+}
+
 func init() {
 	rootCmd.AddCommand(genCmd)
 	genCmd.Flags().StringVar(&exampleFiles, "example-files", "", "Comma-separated list of example file paths")
@@ -223,13 +772,48 @@ func init() {
 	genCmd.Flags().StringVar(&rulesetUsecaseDir, "ruleset-usecase-dir", "", "Directory containing use case rulesets (optional)")
 	genCmd.Flags().StringVar(&rulesetEnvFiles, "ruleset-env-files", "", "Comma-separated list of environment ruleset files")
 	genCmd.Flags().StringVar(&rulesetUsecaseFiles, "ruleset-usecase-files", "", "Comma-separated list of usecase ruleset files")
+	genCmd.Flags().StringArrayVar(&rulesetLayers, "ruleset", nil, "Ruleset file or directory for a layer as layer=path, layers: org, platform, env, usecase, run (repeatable)")
 	genCmd.Flags().StringVar(&usecase, "usecase", "", "usecase context for generation")
-	genCmd.Flags().StringVar(&instruction, "instruction", "", "Specific instruction to guide the AI")
+	genCmd.Flags().StringVar(&instruction, "instruction", "", "Specific instruction to guide the AI, rendered as Go template (@file reads a file, - reads stdin)")
+	genCmd.Flags().StringArrayVar(&templateValues, "values", nil, "YAML file with values for the instruction template (repeatable)")
+	genCmd.Flags().StringArrayVar(&templateSets, "set", nil, "Value for the instruction template as key=value, nested keys with dots (repeatable)")
 	genCmd.Flags().StringVar(&destination, "destination", "", "Destination for generated files: stdout (default), a file (combined content), or a directory (separate files)")
 	genCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	genCmd.Flags().BoolVarP(&promptToAI, "prompt-to-ai", "p", true, "Prompt the AI with the generated content (default true)")
+	genCmd.Flags().StringVar(&exampleTags, "example-tags", "", "Comma-separated tags; only examples from --examples-dirs declaring one of them are used")
+	genCmd.Flags().StringVar(&exampleInclude, "example-include", "", "Comma-separated glob patterns relative to each examples dir; only matching files are loaded (e.g. claims/**/*.yaml)")
+	genCmd.Flags().StringVar(&exampleExclude, "example-exclude", "", "Comma-separated glob patterns relative to each examples dir that are not loaded (e.g. charts/**)")
+	genCmd.Flags().StringVar(&exampleMaxSize, "example-max-size", internal.DefaultExampleMaxSize, "Skip example files larger than this (e.g. 512KB, 0 for no limit)")
+	genCmd.Flags().StringVar(&exampleMaxTotal, "example-max-total", "", "Stop loading examples once their total size reaches this (e.g. 2MB, default no limit)")
+	genCmd.Flags().Float64Var(&exampleSimilarity, "example-similarity", 0, "Collapse examples at least this similar (0-1, e.g. 0.8) into the most representative one; 0 disables it")
+	genCmd.Flags().StringVar(&contextFiles, "context-files", "", "Comma-separated files with facts for the model (inventory, namespaces, versions), sent as reference context, not as examples")
+	genCmd.Flags().StringVar(&contextDirs, "context-dirs", "", "Comma-separated directories with reference context files")
+	genCmd.Flags().StringVar(&contextMaxSize, "context-max-size", internal.DefaultContextMaxSize, "Maximum total size of reference context (0 for no limit)")
+	genCmd.Flags().BoolVar(&contextKeepSecrets, "context-keep-secrets", false, "Do not redact credentials in reference context")
+	genCmd.Flags().BoolVar(&learnDestination, "learn-from-destination", false, "Learn directory layout, file naming, common labels and kustomization usage from the manifests in --destination and follow them")
+	genCmd.Flags().BoolVar(&gitCommit, "git-commit", false, "Create the branch from the git metadata in the output in the destination repository and commit the written files (never pushes)")
+	genCmd.Flags().StringVar(&prBodyFile, "pr-body-file", "", "File for the pull request description written by --git-commit (default k2n-pr-body.md in the .git directory)")
+	genCmd.Flags().StringVar(&splitMode, "split", "", "Name the Kubernetes objects of the output from --name-pattern: object (one file per object) or kind (one file per kind)")
+	genCmd.Flags().StringVar(&namePattern, "name-pattern", "", "Go template for file names with --split, e.g. {{.namespace}}/{{.kind | lower}}-{{.metadata.name}}.yaml")
+	genCmd.Flags().BoolVar(&kustomize, "kustomize", false, "Create or update kustomization.yaml in --destination listing the generated manifests")
+	genCmd.Flags().StringVar(&kustomizeNamespace, "kustomize-namespace", "", "namespace to set in the kustomization (overrides rulesets)")
+	genCmd.Flags().StringToStringVar(&kustomizeLabels, "kustomize-labels", nil, "commonLabels to set in the kustomization, e.g. team=platform,env=dev (overrides rulesets)")
+	genCmd.Flags().StringVar(&kustomizeNameSuffix, "kustomize-name-suffix", "", "nameSuffix to set in the kustomization (overrides rulesets)")
+	genCmd.Flags().BoolVar(&postProcess, "postprocess", true, "Run the post-processing steps configured in the postprocess section of structured rulesets")
 	genCmd.Flags().StringVar(&exampleFileExt, "example-file-ext", ".yaml,.tf", "Comma-separated list of allowed example file extensions (e.g., .yaml,.tf)")
 	genCmd.Flags().StringVar(&aiprovider, "ai-provider", "", "AI provider: openrouter or gemini (default: gemini, can also use AI_PROVIDER env var)")
 	genCmd.Flags().StringVar(&aiproviderModel, "ai-model", "", "Model name for the AI provider (e.g., openai/gpt-4 for OpenRouter, can also use AI_MODEL env var)")
 	genCmd.Flags().StringVar(&aiproviderBaseURL, "ai-base-url", "", "Base URL for OpenRouter API (can also use AI_BASE_URL env var)")
+	genCmd.Flags().IntVar(&maxRepairs, "max-repairs", 2, "Maximum number of times failed output is sent back to the AI for repair")
+	genCmd.Flags().BoolVar(&validateYAML, "validate-yaml", true, "Validate generated YAML files before writing them")
+	genCmd.Flags().BoolVar(&planOutput, "plan", false, "Show a diff of the files that would be written to --destination and write nothing")
+	genCmd.Flags().BoolVar(&applyPlan, "apply", false, "Show the plan and write all added and modified files")
+	genCmd.Flags().BoolVar(&interactiveApply, "interactive", false, "Show the plan and accept or reject each file before writing")
+	genCmd.Flags().StringVar(&overwritePolicy, "overwrite", "always", "What to do with existing files: always, never, prompt or backup")
+	genCmd.Flags().StringVar(&reportFormat, "report", "", "Write a machine-readable run report: json or yaml")
+	genCmd.Flags().StringVar(&reportFile, "report-file", "", "File for the run report (default stdout)")
+	genCmd.Flags().StringVar(&refineFile, "refine", "", "Existing file to modify according to --instruction; the change is shown as a diff and written back unless --destination or --plan is set")
+	genCmd.Flags().StringArrayVar(&refineAllow, "refine-allow", nil, "Dotted YAML path that --refine may change, e.g. spec.version (repeatable, default: paths mentioned in the instruction)")
+	genCmd.Flags().StringVar(&rulesMode, "rules", internal.RulesFix, "What to do with structured rulesets after generation: fix (apply defaults and fix violations), check (report violations only) or off")
+	genCmd.Flags().StringArrayVar(&checkCommands, "check", nil, "Shell command used to check the output (stdin: raw output, K2N_OUTPUT_DIR: parsed files); repeatable")
 }
@@ -0,0 +1,80 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/stuttgart-things/k2n/internal"
+)
+
+var historyLimit int
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past generation runs recorded in the journal",
+	Long: `The 'history' command lists the runs recorded in the write journal with their
+timestamp, command, destination and the files they created or modified.
+Use the run id with 'k2n undo' to roll a run back.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		journals, err := internal.LoadJournals(internal.JournalDir())
+		if err != nil {
+			return err
+		}
+		if len(journals) == 0 {
+			fmt.Println("No runs recorded yet.")
+			return nil
+		}
+		if historyLimit > 0 && len(journals) > historyLimit {
+			journals = journals[:historyLimit]
+		}
+
+		tableData := pterm.TableData{{"RUN", "TIMESTAMP", "COMMAND", "DESTINATION", "FILES", "STATUS"}}
+		for _, j := range journals {
+			status := "applied"
+			if j.UndoneAt != nil {
+				status = "undone"
+			}
+			tableData = append(tableData, []string{
+				j.ID,
+				j.Timestamp.Format(time.RFC3339),
+				truncateCommand(j.Command, 60),
+				j.Destination,
+				summarizeEntries(j.Entries),
+				status,
+			})
+		}
+
+		return pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+	},
+}
+
+// summarizeEntries lists the touched files with a marker for created (+) and modified (~).
+func summarizeEntries(entries []internal.JournalEntry) string {
+	var files []string
+	for _, e := range entries {
+		marker := "~"
+		if e.Action == internal.ActionCreated {
+			marker = "+"
+		}
+		files = append(files, marker+e.Path)
+	}
+	return strings.Join(files, "\n")
+}
+
+func truncateCommand(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Maximum number of runs to show (0 for all)")
+}
@@ -0,0 +1,29 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"os"
+
+	"github.com/stuttgart-things/k2n/internal"
+)
+
+// resolveInstruction reads the instruction from the flag value, a file (@path) or
+// stdin (-) and renders it as a Go template with --values files and --set pairs,
+// if any are given.
+func resolveInstruction(raw string, valuesFiles, sets []string) (string, error) {
+	text, err := internal.ReadInstruction(raw, os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", nil
+	}
+
+	values, err := internal.LoadTemplateValues(valuesFiles, sets)
+	if err != nil {
+		return "", err
+	}
+	return internal.RenderInstruction(text, values)
+}
@@ -0,0 +1,82 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"charm.land/huh/v2"
+	"github.com/pterm/pterm"
+	"github.com/stuttgart-things/k2n/internal"
+)
+
+// newOutputOptions builds the output options for a run writing to dest, including
+// a fresh journal so the run can be undone later.
+func newOutputOptions(policyName, dest string) (internal.OutputOptions, error) {
+	policy, err := internal.ParseOverwritePolicy(policyName)
+	if err != nil {
+		return internal.OutputOptions{}, err
+	}
+	opts := internal.OutputOptions{
+		Policy:  policy,
+		Journal: internal.NewJournal(strings.Join(os.Args, " "), dest),
+	}
+	if !ciMode {
+		opts.Confirm = confirmOverwrite
+	}
+	return opts, nil
+}
+
+// saveJournal persists the journal of a finished run and prints its id.
+func saveJournal(opts internal.OutputOptions) {
+	if opts.Journal == nil || len(opts.Journal.Entries) == 0 {
+		return
+	}
+	if err := opts.Journal.Save(internal.JournalDir()); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not save journal: %v\n", err)
+		return
+	}
+	fmt.Printf("📓 Run %s recorded in journal\n", opts.Journal.ID)
+}
+
+// confirmOverwrite asks whether an existing file may be overwritten.
+func confirmOverwrite(path string) (bool, error) {
+	overwrite := false
+	err := huh.NewConfirm().
+		Title(fmt.Sprintf("%s already exists. Overwrite?", path)).
+		Affirmative("Overwrite").
+		Negative("Skip").
+		Value(&overwrite).
+		Run()
+	return overwrite, err
+}
+
+// writeReport renders the run report if a format was requested.
+func writeReport(report *internal.Report, format, path string) {
+	if format == "" {
+		return
+	}
+	if err := report.Write(format, path); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not write report: %v\n", err)
+	}
+}
+
+// humanOutputToStderr sends everything printed for humans to stderr while a
+// report of format goes to stdout, so stdout only carries the report. The
+// returned function restores stdout and must be called before writing the
+// report.
+func humanOutputToStderr(format, path string) func() {
+	if format == "" || (path != "" && path != "-") {
+		return func() {}
+	}
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	pterm.SetDefaultOutput(os.Stderr)
+	return func() {
+		os.Stdout = stdout
+		pterm.SetDefaultOutput(stdout)
+	}
+}
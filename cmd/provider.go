@@ -0,0 +1,54 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stuttgart-things/k2n/internal/ai"
+)
+
+// resolveProviderConfig builds the AI provider configuration from flag values,
+// falling back to AI_PROVIDER, AI_MODEL and AI_BASE_URL and then to defaults.
+func resolveProviderConfig(provider, model, baseURL string) (*ai.ProviderConfig, error) {
+	apiKey := os.Getenv(envAPIKeyVar)
+	if apiKey == "" {
+		return nil, fmt.Errorf("%s is not set in environment", envAPIKeyVar)
+	}
+
+	providerConfig := &ai.ProviderConfig{APIKey: apiKey}
+
+	if provider != "" {
+		providerConfig.Type = ai.ProviderType(provider)
+	} else if envProvider := os.Getenv("AI_PROVIDER"); envProvider != "" {
+		providerConfig.Type = ai.ProviderType(envProvider)
+	} else {
+		providerConfig.Type = ai.ProviderOpenRouter
+	}
+
+	switch providerConfig.Type {
+	case ai.ProviderOpenRouter:
+		if model != "" {
+			providerConfig.Model = model
+		} else if envModel := os.Getenv("AI_MODEL"); envModel != "" {
+			providerConfig.Model = envModel
+		} else {
+			providerConfig.Model = "openai/gpt-3.5-turbo"
+		}
+		if baseURL != "" {
+			providerConfig.BaseURL = baseURL
+		} else if envURL := os.Getenv("AI_BASE_URL"); envURL != "" {
+			providerConfig.BaseURL = envURL
+		} else {
+			providerConfig.BaseURL = "https://openrouter.ai/api/v1/chat/completions"
+		}
+	case ai.ProviderGemini:
+		// Gemini doesn't require additional configuration
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q (supported: openrouter, gemini)", providerConfig.Type)
+	}
+
+	return providerConfig, nil
+}
@@ -22,27 +22,33 @@ effort and ensuring consistency across your infrastructure.
 
 Use k2n to generate Kubernetes manifests, Helm values, Crossplane compositions,
 KCL modules, and other infrastructure-as-code artifacts with ease.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("ci") {
+			ciMode = detectCI()
+		}
+		applyCIMode()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// If no subcommand or arguments are provided, launch the interactive menu
-		if len(args) == 0 && !cmd.Flags().Changed("toggle") {
-			if err := menu.ShowInteractiveMenu(cmd); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
-			return
+		if len(args) == 0 && !cmd.Flags().Changed("toggle") && !ciMode {
+			return menu.ShowInteractiveMenu(cmd)
 		}
 
 		// Otherwise, show help
-		cmd.Help()
+		return cmd.Help()
 	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Errors are printed once and mapped to the documented exit codes.
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -56,6 +62,10 @@ func init() {
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().BoolVar(&ciMode, "ci", false, "Non-interactive CI mode: no banner, spinners or colours (auto-detected from CI env var or missing TTY)")
+	rootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return configError(err)
+	})
 
 	// Disable default completion command for cleaner interface
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
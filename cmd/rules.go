@@ -0,0 +1,134 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/stuttgart-things/k2n/internal"
+)
+
+var (
+	explainEnvDir       string
+	explainUsecaseDir   string
+	explainEnvFiles     string
+	explainUsecaseFiles string
+	explainRulesets     []string
+	explainFormat       string
+	explainPrompt       bool
+)
+
+// rulesetSources returns the org and platform rulesets from the environment
+// followed by the layer=path specs of the --ruleset flag.
+func rulesetSources(specs []string) ([]internal.RulesetSource, error) {
+	sources, err := internal.ParseRulesetSources(specs)
+	if err != nil {
+		return nil, err
+	}
+	return append(internal.RulesetSourcesFromEnv(), sources...), nil
+}
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Inspect rulesets",
+}
+
+var rulesExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Show the effective ruleset after merging all layers and where each value came from",
+	Long: `The 'explain' command loads the ruleset layers org → platform → env → usecase → run,
+merges them like gen does and prints every effective value together with the
+layer and file that set it and the values of lower layers it overrides.
+
+Org and platform rulesets can be set with K2N_RULESET_ORG and K2N_RULESET_PLATFORM.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if explainFormat != "table" {
+			if err := internal.ValidateReportFormat(explainFormat); err != nil {
+				return configError(fmt.Errorf("unknown output format %q (supported: table, json, yaml)", explainFormat))
+			}
+		}
+		sources, err := rulesetSources(explainRulesets)
+		if err != nil {
+			return configError(err)
+		}
+		inputs, err := internal.LoadInputs(internal.InputConfig{
+			RulesetEnvDirs:      internal.SplitAndTrimPaths(explainEnvDir),
+			RulesetUsecaseDirs:  internal.SplitAndTrimPaths(explainUsecaseDir),
+			RulesetEnvFiles:     internal.SplitAndTrimPaths(explainEnvFiles),
+			RulesetUsecaseFiles: internal.SplitAndTrimPaths(explainUsecaseFiles),
+			Rulesets:            sources,
+		})
+		if err != nil {
+			return configError(err)
+		}
+		rules := inputs.Rules
+
+		if explainPrompt {
+			for _, text := range append(inputs.EnvRules, inputs.UsecaseRules...) {
+				fmt.Println(text + "\n---")
+			}
+			return nil
+		}
+		if explainFormat != "table" {
+			return internal.WriteStructured(rules, explainFormat, "")
+		}
+
+		if len(rules.Files) == 0 {
+			fmt.Println("No rulesets loaded.")
+			return nil
+		}
+		fmt.Printf("📚 Layers, lowest to highest precedence: %s\n\n", strings.Join(internal.RulesetLayers, " → "))
+
+		files := pterm.TableData{{"LAYER", "FILE", "TYPE"}}
+		for _, f := range rules.Files {
+			kind := "values"
+			switch {
+			case f.Structured != nil:
+				kind = "structured"
+			case slices.Contains(rules.Text, f.Path):
+				kind = "text"
+			}
+			files = append(files, []string{f.Layer, f.Path, kind})
+		}
+		if err := pterm.DefaultTable.WithHasHeader().WithData(files).Render(); err != nil {
+			return err
+		}
+		fmt.Println()
+
+		table := pterm.TableData{{"KEY", "VALUE", "LAYER", "SOURCE", "OVERRIDES"}}
+		for _, r := range rules.Rules {
+			var overrides []string
+			for _, o := range r.Overrides {
+				overrides = append(overrides, fmt.Sprintf("%s %s: %s", o.Layer, o.Source, o.Value))
+			}
+			table = append(table, []string{r.Key, r.Value, r.Layer, r.Source, strings.Join(overrides, "\n")})
+		}
+		if err := pterm.DefaultTable.WithHasHeader().WithData(table).Render(); err != nil {
+			return err
+		}
+
+		if len(rules.Text) > 0 {
+			fmt.Printf("\n%d ruleset(s) are free text and passed to the model as they are.\n", len(rules.Text))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rulesCmd)
+	rulesCmd.AddCommand(rulesExplainCmd)
+
+	rulesExplainCmd.Flags().StringVar(&explainEnvDir, "ruleset-env-dir", "", "Directory containing environment rulesets")
+	rulesExplainCmd.Flags().StringVar(&explainUsecaseDir, "ruleset-usecase-dir", "", "Directory containing use case rulesets")
+	rulesExplainCmd.Flags().StringVar(&explainEnvFiles, "ruleset-env-files", "", "Comma-separated list of environment ruleset files")
+	rulesExplainCmd.Flags().StringVar(&explainUsecaseFiles, "ruleset-usecase-files", "", "Comma-separated list of usecase ruleset files")
+	rulesExplainCmd.Flags().StringArrayVar(&explainRulesets, "ruleset", nil, "Ruleset file or directory for a layer as layer=path, layers: org, platform, env, usecase, run (repeatable)")
+	rulesExplainCmd.Flags().StringVarP(&explainFormat, "output", "o", "table", "Output format: table, json or yaml")
+	rulesExplainCmd.Flags().BoolVar(&explainPrompt, "prompt", false, "Print the rules as they are sent to the model")
+}
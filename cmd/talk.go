@@ -9,7 +9,6 @@ import (
 	"os"
 	"time"
 
-	"charm.land/huh/v2/spinner"
 	"github.com/spf13/cobra"
 	"github.com/stuttgart-things/k2n/internal"
 	"github.com/stuttgart-things/k2n/internal/ai"
@@ -25,6 +24,16 @@ var (
 	talkModel       string
 	talkBaseURL     string
 	talkVerbose     bool
+	talkOverwrite   string
+	talkReport      string
+	talkReportFile  string
+	talkValues      []string
+	talkSets        []string
+
+	talkContextFiles       string
+	talkContextDirs        string
+	talkContextMaxSize     string
+	talkContextKeepSecrets bool
 )
 
 var talkCmd = &cobra.Command{
@@ -34,29 +43,46 @@ var talkCmd = &cobra.Command{
 discovers available claim templates, and uses AI to match your natural language
 request to the right template and parameters. The result is a rendered Crossplane
 claim in YAML format.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) (runErr error) {
+		restoreStdout := humanOutputToStderr(talkReport, talkReportFile)
+		defer restoreStdout()
+
 		internal.PrintBanner()
 
+		if err := internal.ValidateReportFormat(talkReport); err != nil {
+			return configError(err)
+		}
+
+		runReport := internal.NewReport("talk")
+		var auditRecord *internal.AuditRecord
+		defer func() {
+			if runErr != nil {
+				runReport.Fail(errorStage(runErr), runErr)
+			}
+			saveAudit(auditRecord, runReport)
+			restoreStdout()
+			writeReport(runReport, talkReport, talkReportFile)
+		}()
+
+		if _, err := internal.ParseOverwritePolicy(talkOverwrite); err != nil {
+			return configError(err)
+		}
+
 		// Validate API URL
 		if talkAPIURL == "" {
 			talkAPIURL = os.Getenv("CLAIM_API_URL")
 		}
 		if talkAPIURL == "" {
-			fmt.Fprintln(os.Stderr, "Error: --api-url or CLAIM_API_URL is required")
-			os.Exit(1)
+			return configError(fmt.Errorf("--api-url or CLAIM_API_URL is required"))
 		}
 
 		// Validate instruction
-		if talkInstruction == "" {
-			fmt.Fprintln(os.Stderr, "Error: --instruction is required")
-			os.Exit(1)
+		talkInstruction, err := resolveInstruction(talkInstruction, talkValues, talkSets)
+		if err != nil {
+			return configError(err)
 		}
-
-		// Read API key
-		apiKey := os.Getenv(envAPIKeyVar)
-		if apiKey == "" {
-			fmt.Fprintln(os.Stderr, "Error: AI_API_KEY environment variable is required")
-			os.Exit(1)
+		if talkInstruction == "" {
+			return configError(fmt.Errorf("--instruction is required"))
 		}
 
 		// Auth token for claim-machinery-api
@@ -65,75 +91,68 @@ claim in YAML format.`,
 		}
 
 		// Setup AI provider
-		providerConfig := &ai.ProviderConfig{APIKey: apiKey}
-		if talkProvider != "" {
-			providerConfig.Type = ai.ProviderType(talkProvider)
-		} else if envProvider := os.Getenv("AI_PROVIDER"); envProvider != "" {
-			providerConfig.Type = ai.ProviderType(envProvider)
-		} else {
-			providerConfig.Type = ai.ProviderOpenRouter
-		}
-
-		switch providerConfig.Type {
-		case ai.ProviderOpenRouter:
-			if talkModel != "" {
-				providerConfig.Model = talkModel
-			} else if envModel := os.Getenv("AI_MODEL"); envModel != "" {
-				providerConfig.Model = envModel
-			} else {
-				providerConfig.Model = "openai/gpt-3.5-turbo"
-			}
-			if talkBaseURL != "" {
-				providerConfig.BaseURL = talkBaseURL
-			} else if envURL := os.Getenv("AI_BASE_URL"); envURL != "" {
-				providerConfig.BaseURL = envURL
-			} else {
-				providerConfig.BaseURL = "https://openrouter.ai/api/v1/chat/completions"
-			}
-		case ai.ProviderGemini:
-			// No additional config needed
+		providerConfig, err := resolveProviderConfig(talkProvider, talkModel, talkBaseURL)
+		if err != nil {
+			return configError(err)
 		}
 
 		// Print config
-		internal.PrintEnvTable(map[string]string{
+		config := map[string]string{
 			"CLAIM_API_URL": talkAPIURL,
 			"AI_PROVIDER":   string(providerConfig.Type),
 			"AI_MODEL":      providerConfig.Model,
 			"INSTRUCTION":   talkInstruction,
 			"DESTINATION":   talkDestination,
-		})
+		}
+		internal.PrintEnvTable(config)
+
+		config["CLAIM_API_TOKEN"] = talkAuthToken
+		config["AI_API_KEY"] = providerConfig.APIKey
+		config["AI_BASE_URL"] = providerConfig.BaseURL
+		runReport.SetConfig(config)
+		runReport.Provider = string(providerConfig.Type)
+		runReport.Model = providerConfig.Model
+		auditRecord = startAudit("talk", providerConfig)
+
+		contextCfg, err := contextConfig(talkContextFiles, talkContextDirs, talkContextMaxSize, talkContextKeepSecrets)
+		if err != nil {
+			return configError(err)
+		}
+		inputs, err := internal.LoadInputs(internal.InputConfig{Context: contextCfg})
+		if err != nil {
+			return configError(err)
+		}
+		referenceContext := inputs.Context
+		runReport.Context = contextPaths(referenceContext)
+		runReport.Sources = inputs.GitSources
+		runReport.Skipped = inputs.SkippedFiles
+		printSkippedFiles(inputs.SkippedFiles, talkVerbose)
+		printContextFiles(referenceContext)
 
 		// Step 1: Fetch templates from claim-machinery-api
 		client := talk.NewClient(talkAPIURL, talkAuthToken)
 
 		var templates []talk.ClaimTemplate
 		fmt.Println()
-		ctx1, cancel1 := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel1()
-		if err := spinner.New().
-			Context(ctx1).
-			Title("Fetching claim templates...").
-			Action(func() {
-				var fetchErr error
-				templates, fetchErr = client.ListTemplates()
-				if fetchErr != nil {
-					fmt.Fprintf(os.Stderr, "\nError fetching templates: %v\n", fetchErr)
-					os.Exit(1)
-				}
-			}).Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := runStep("Fetching claim templates...", 30*time.Second, func(context.Context) error {
+			var fetchErr error
+			templates, fetchErr = client.ListTemplates()
+			return fetchErr
+		}); err != nil {
+			return apiError(fmt.Errorf("fetching templates: %w", err))
 		}
 
 		if len(templates) == 0 {
 			fmt.Println("No claim templates found on the API.")
-			return
+			runReport.Warn("templates", "no claim templates found on the API")
+			return nil
 		}
 		fmt.Printf("Found %d claim template(s)\n\n", len(templates))
 
 		// Step 2: Build prompt and call AI
-		systemPrompt := talk.BuildSystemPrompt(templates)
+		systemPrompt := talk.BuildSystemPrompt(templates, internal.ReferenceContextSection(referenceContext))
 		fullPrompt := talk.BuildUserPrompt(systemPrompt, talkInstruction)
+		runReport.SetPrompt(fullPrompt)
 
 		if talkVerbose {
 			fmt.Println("--- PROMPT ---")
@@ -142,22 +161,18 @@ claim in YAML format.`,
 		}
 
 		var aiOutput string
-		ctx2, cancel2 := context.WithTimeout(context.Background(), 2*time.Minute)
-		defer cancel2()
-		if err := spinner.New().
-			Context(ctx2).
-			Title(fmt.Sprintf("Asking %s AI to select template and parameters...", string(providerConfig.Type))).
-			Action(func() {
-				var callErr error
-				aiOutput, callErr = ai.CallAI(providerConfig, fullPrompt)
-				if callErr != nil {
-					fmt.Fprintf(os.Stderr, "\nError calling AI: %v\n", callErr)
-					os.Exit(1)
-				}
-			}).Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		err = runStep(fmt.Sprintf("Asking %s AI to select template and parameters...", string(providerConfig.Type)), 2*time.Minute, func(context.Context) error {
+			var callErr error
+			aiOutput, runReport.Usage, callErr = ai.CallAIWithUsage(providerConfig, fullPrompt)
+			return callErr
+		})
+		if auditRecord != nil {
+			auditRecord.AddExchange(fullPrompt, aiOutput, runReport.Usage, err)
+		}
+		if err != nil {
+			return aiError(fmt.Errorf("calling AI: %w", err))
 		}
+		runReport.Attempts = 1
 
 		if talkVerbose {
 			fmt.Println("--- AI RESPONSE ---")
@@ -168,14 +183,19 @@ claim in YAML format.`,
 		// Step 3: Parse AI response
 		aiResp, parseErr := talk.ParseAIResponse(aiOutput)
 		if parseErr != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing AI response: %v\n", parseErr)
-			os.Exit(1)
+			return aiError(fmt.Errorf("parsing AI response: %w", parseErr))
+		}
+		if auditRecord != nil {
+			auditRecord.Parsed = aiResp
 		}
 
 		if aiResp.TemplateName == "" {
 			fmt.Printf("AI could not match your request to a template.\nReason: %s\n", aiResp.Explanation)
-			return
+			runReport.Warn("match", "no template matched: %s", aiResp.Explanation)
+			return nil
 		}
+		runReport.Template = aiResp.TemplateName
+		runReport.Parameters = aiResp.Parameters
 
 		fmt.Printf("Selected template: %s\n", aiResp.TemplateName)
 		fmt.Printf("Explanation: %s\n", aiResp.Explanation)
@@ -186,29 +206,27 @@ claim in YAML format.`,
 
 		// Step 4: Order the claim
 		var orderResp *talk.OrderResponse
-		ctx3, cancel3 := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancel3()
-		if err := spinner.New().
-			Context(ctx3).
-			Title("Rendering claim via claim-machinery-api...").
-			Action(func() {
-				var orderErr error
-				orderResp, orderErr = client.OrderClaim(aiResp.TemplateName, aiResp.Parameters, "k2n-talk")
-				if orderErr != nil {
-					fmt.Fprintf(os.Stderr, "\nError ordering claim: %v\n", orderErr)
-					os.Exit(1)
-				}
-			}).Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := runStep("Rendering claim via claim-machinery-api...", 60*time.Second, func(context.Context) error {
+			var orderErr error
+			orderResp, orderErr = client.OrderClaim(aiResp.TemplateName, aiResp.Parameters, "k2n-talk")
+			return orderErr
+		}); err != nil {
+			return apiError(fmt.Errorf("ordering claim: %w", err))
 		}
 
 		// Step 5: Output the rendered YAML
 		fmt.Println("\nClaim rendered successfully!")
-		if err := internal.SaveOutput(talkDestination, orderResp.Rendered); err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
-			os.Exit(1)
+		opts, err := newOutputOptions(talkOverwrite, talkDestination)
+		if err != nil {
+			return configError(err)
+		}
+		err = internal.SaveOutputWithOptions(talkDestination, orderResp.Rendered, opts)
+		saveJournal(opts)
+		runReport.AddJournal(opts.Journal)
+		if err != nil {
+			return fmt.Errorf("saving output: %w", err)
 		}
+		return nil
 	},
 }
 
@@ -216,10 +234,19 @@ func init() {
 	rootCmd.AddCommand(talkCmd)
 	talkCmd.Flags().StringVar(&talkAPIURL, "api-url", "", "Base URL of the claim-machinery-api (or CLAIM_API_URL env var)")
 	talkCmd.Flags().StringVar(&talkAuthToken, "api-token", "", "Auth token for claim-machinery-api (or CLAIM_API_TOKEN env var)")
-	talkCmd.Flags().StringVar(&talkInstruction, "instruction", "", "Natural language description of the claim you want")
+	talkCmd.Flags().StringVar(&talkInstruction, "instruction", "", "Natural language description of the claim you want, rendered as Go template (@file reads a file, - reads stdin)")
+	talkCmd.Flags().StringArrayVar(&talkValues, "values", nil, "YAML file with values for the instruction template (repeatable)")
+	talkCmd.Flags().StringArrayVar(&talkSets, "set", nil, "Value for the instruction template as key=value, nested keys with dots (repeatable)")
+	talkCmd.Flags().StringVar(&talkContextFiles, "context-files", "", "Comma-separated files with facts for the model (inventory, namespaces, versions), sent as reference context")
+	talkCmd.Flags().StringVar(&talkContextDirs, "context-dirs", "", "Comma-separated directories with reference context files")
+	talkCmd.Flags().StringVar(&talkContextMaxSize, "context-max-size", internal.DefaultContextMaxSize, "Maximum total size of reference context (0 for no limit)")
+	talkCmd.Flags().BoolVar(&talkContextKeepSecrets, "context-keep-secrets", false, "Do not redact credentials in reference context")
 	talkCmd.Flags().StringVar(&talkDestination, "destination", "", "Output destination: stdout (default), file path, or directory")
 	talkCmd.Flags().StringVar(&talkProvider, "ai-provider", "", "AI provider: openrouter or gemini (default from AI_PROVIDER env)")
 	talkCmd.Flags().StringVar(&talkModel, "ai-model", "", "AI model name (default from AI_MODEL env)")
 	talkCmd.Flags().StringVar(&talkBaseURL, "ai-base-url", "", "Base URL for OpenRouter API (default from AI_BASE_URL env)")
+	talkCmd.Flags().StringVar(&talkOverwrite, "overwrite", "always", "What to do with existing files: always, never, prompt or backup")
+	talkCmd.Flags().StringVar(&talkReport, "report", "", "Write a machine-readable run report: json or yaml")
+	talkCmd.Flags().StringVar(&talkReportFile, "report-file", "", "File for the run report (default stdout)")
 	talkCmd.Flags().BoolVarP(&talkVerbose, "verbose", "v", false, "Enable verbose output (show prompts and raw AI responses)")
 }
@@ -0,0 +1,49 @@
+// Package cmd provides the command-line interface for generating configurations using AI.
+//
+// Copyright © 2025 PATRICK HERMANN
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/stuttgart-things/k2n/internal"
+)
+
+var undoForce bool
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [run-id]",
+	Short: "Roll back the files written by a generation run",
+	Long: `The 'undo' command restores the previous content of files modified by a run
+and deletes files the run created. Without a run id the most recent run that has
+not been undone is rolled back. Files edited after the run are detected by their
+checksum and block the undo unless --force is given.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := internal.JournalDir()
+
+		var journal *internal.Journal
+		var err error
+		if len(args) == 1 {
+			journal, err = internal.LoadJournal(dir, args[0])
+		} else {
+			journal, err = internal.LatestUndoableJournal(dir)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Undoing run %s (%s)\n", journal.ID, journal.Command)
+		if err := internal.UndoJournal(dir, journal, undoForce); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Run %s undone\n", journal.ID)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().BoolVar(&undoForce, "force", false, "Undo even if files were edited after the run")
+}
@@ -11,10 +11,19 @@ import (
 )
 
 const (
-	GeminiURL = "https://generativelanguage.googleapis.com/v1beta/models/gemini-3-pro-preview:generateContent"
+	// GeminiModel is the model every Gemini call uses; it cannot be configured.
+	GeminiModel = "gemini-3-pro-preview"
+	GeminiURL   = "https://generativelanguage.googleapis.com/v1beta/models/" + GeminiModel + ":generateContent"
 )
 
 func CallGeminiAPI(apiKey, prompt string) (string, error) {
+	result, _, err := CallGeminiAPIWithUsage(apiKey, prompt)
+	return result, err
+}
+
+// CallGeminiAPIWithUsage is CallGeminiAPI that also returns the token usage
+// reported in the response metadata.
+func CallGeminiAPIWithUsage(apiKey, prompt string) (string, Usage, error) {
 	reqBody := map[string]interface{}{
 		"contents": []map[string]interface{}{
 			{
@@ -27,7 +36,7 @@ func CallGeminiAPI(apiKey, prompt string) (string, error) {
 
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", err
+		return "", Usage{}, err
 	}
 
 	resp, err := http.Post(
@@ -36,13 +45,13 @@ func CallGeminiAPI(apiKey, prompt string) (string, error) {
 		bytes.NewReader(bodyBytes),
 	)
 	if err != nil {
-		return "", err
+		return "", Usage{}, err
 	}
 	defer resp.Body.Close()
 
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return "", Usage{}, err
 	}
 
 	fmt.Println("Raw response:", string(respBody))
@@ -55,18 +64,28 @@ func CallGeminiAPI(apiKey, prompt string) (string, error) {
 				} `json:"parts"`
 			} `json:"content"`
 		} `json:"candidates"`
+		UsageMetadata struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+			TotalTokenCount      int `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
 	}
 
 	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
-		return "", err
+		return "", Usage{}, err
 	}
 
 	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no candidates returned")
+		return "", Usage{}, fmt.Errorf("no candidates returned")
 	}
 
 	text := geminiResp.Candidates[0].Content.Parts[0].Text
-	return cleanCodeBlock(text), nil
+	usage := Usage{
+		PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+		CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+	}
+	return cleanCodeBlock(text), usage, nil
 }
 
 // cleanCodeBlock removes surrounding triple backticks and optional language hints.
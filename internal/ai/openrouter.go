@@ -10,6 +10,13 @@ import (
 )
 
 func CallOpenRouterApi(apiKey, prompt, baseURL, model string) (string, error) {
+	result, _, err := CallOpenRouterApiWithUsage(apiKey, prompt, baseURL, model)
+	return result, err
+}
+
+// CallOpenRouterApiWithUsage is CallOpenRouterApi that also returns the token usage
+// reported by OpenRouter.
+func CallOpenRouterApiWithUsage(apiKey, prompt, baseURL, model string) (string, Usage, error) {
 	log.Printf("[OpenRouter] Starting API call with model: %s", model)
 	log.Printf("[OpenRouter] Base URL: %s", baseURL)
 	log.Printf("[OpenRouter] Prompt length: %d characters", len(prompt))
@@ -24,14 +31,14 @@ func CallOpenRouterApi(apiKey, prompt, baseURL, model string) (string, error) {
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		log.Printf("[OpenRouter] ERROR marshaling request body: %v", err)
-		return "", err
+		return "", Usage{}, err
 	}
 	log.Printf("[OpenRouter] Request body marshaled successfully (%d bytes)", len(bodyBytes))
 
 	req, err := http.NewRequest(http.MethodPost, baseURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		log.Printf("[OpenRouter] ERROR creating HTTP request: %v", err)
-		return "", err
+		return "", Usage{}, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -41,7 +48,7 @@ func CallOpenRouterApi(apiKey, prompt, baseURL, model string) (string, error) {
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Printf("[OpenRouter] ERROR executing HTTP request: %v", err)
-		return "", err
+		return "", Usage{}, err
 	}
 	defer resp.Body.Close()
 
@@ -50,7 +57,7 @@ func CallOpenRouterApi(apiKey, prompt, baseURL, model string) (string, error) {
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("[OpenRouter] ERROR reading response body: %v", err)
-		return "", err
+		return "", Usage{}, err
 	}
 	log.Printf("[OpenRouter] Response body read successfully (%d bytes)", len(respBody))
 	log.Printf("[OpenRouter] Response body content: %s", string(respBody))
@@ -64,25 +71,35 @@ func CallOpenRouterApi(apiKey, prompt, baseURL, model string) (string, error) {
 		Error *struct {
 			Message string `json:"message"`
 		} `json:"error"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.Unmarshal(respBody, &orResp); err != nil {
 		log.Printf("[OpenRouter] ERROR unmarshaling response: %v", err)
-		return "", err
+		return "", Usage{}, err
 	}
 	log.Printf("[OpenRouter] Response unmarshaled successfully")
 
 	if orResp.Error != nil {
 		log.Printf("[OpenRouter] API returned error: %s", orResp.Error.Message)
-		return "", fmt.Errorf("openrouter error: %s", orResp.Error.Message)
+		return "", Usage{}, fmt.Errorf("openrouter error: %s", orResp.Error.Message)
 	}
 
 	if len(orResp.Choices) == 0 {
 		log.Printf("[OpenRouter] ERROR: no choices returned in response")
-		return "", fmt.Errorf("no choices returned")
+		return "", Usage{}, fmt.Errorf("no choices returned")
 	}
 
 	result := cleanCodeBlock(orResp.Choices[0].Message.Content)
 	log.Printf("[OpenRouter] Response processed successfully. Result length: %d characters", len(result))
-	return result, nil
+	usage := Usage{
+		PromptTokens:     orResp.Usage.PromptTokens,
+		CompletionTokens: orResp.Usage.CompletionTokens,
+		TotalTokens:      orResp.Usage.TotalTokens,
+	}
+	return result, usage, nil
 }
@@ -37,3 +37,33 @@ func TestCallOpenRouterApi(t *testing.T) {
 		t.Errorf("expected %q but got %q", expected, result)
 	}
 }
+
+func TestCallOpenRouterApiWithUsage(t *testing.T) {
+	fakeResponse := map[string]interface{}{
+		"choices": []map[string]interface{}{
+			{"message": map[string]interface{}{"content": "kind: Test"}},
+		},
+		"usage": map[string]interface{}{
+			"prompt_tokens":     12,
+			"completion_tokens": 3,
+			"total_tokens":      15,
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(fakeResponse)
+	}))
+	defer server.Close()
+
+	result, usage, err := CallOpenRouterApiWithUsage("fake-api-key", "fake-prompt", server.URL, "openai/gpt-4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "kind: Test" {
+		t.Errorf("expected %q but got %q", "kind: Test", result)
+	}
+	expected := Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}
+	if usage != expected {
+		t.Errorf("expected usage %+v but got %+v", expected, usage)
+	}
+}
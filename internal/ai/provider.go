@@ -11,6 +11,25 @@ type AIProvider interface {
 	Call(apiKey, prompt string) (string, error)
 }
 
+// Usage holds the token counts reported by a provider for a single call.
+type Usage struct {
+	PromptTokens     int `json:"promptTokens" yaml:"promptTokens"`
+	CompletionTokens int `json:"completionTokens" yaml:"completionTokens"`
+	TotalTokens      int `json:"totalTokens" yaml:"totalTokens"`
+}
+
+// Add accumulates the token counts of another call.
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// UsageProvider is implemented by providers that report token usage.
+type UsageProvider interface {
+	CallWithUsage(apiKey, prompt string) (string, Usage, error)
+}
+
 // ProviderType represents the type of AI provider
 type ProviderType string
 
@@ -95,6 +114,20 @@ func CallAI(config *ProviderConfig, prompt string) (string, error) {
 	return provider.Call(config.APIKey, prompt)
 }
 
+// CallAIWithUsage calls the configured AI provider and returns the token usage if the
+// provider reports it.
+func CallAIWithUsage(config *ProviderConfig, prompt string) (string, Usage, error) {
+	provider, err := NewProvider(config)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if up, ok := provider.(UsageProvider); ok {
+		return up.CallWithUsage(config.APIKey, prompt)
+	}
+	res, err := provider.Call(config.APIKey, prompt)
+	return res, Usage{}, err
+}
+
 // CallAIWithProvider calls the configured AI provider using environment variables
 func CallAIWithProvider(prompt string) (string, error) {
 	config, err := GetProviderFromEnv()
@@ -116,6 +149,11 @@ func (p *OpenRouterProvider) Call(apiKey, prompt string) (string, error) {
 	return CallOpenRouterApi(apiKey, prompt, p.BaseURL, p.Model)
 }
 
+// CallWithUsage implements UsageProvider.CallWithUsage for OpenRouter
+func (p *OpenRouterProvider) CallWithUsage(apiKey, prompt string) (string, Usage, error) {
+	return CallOpenRouterApiWithUsage(apiKey, prompt, p.BaseURL, p.Model)
+}
+
 // GeminiProvider implements AIProvider for Gemini
 type GeminiProvider struct {
 	APIKey string
@@ -125,3 +163,8 @@ type GeminiProvider struct {
 func (p *GeminiProvider) Call(apiKey, prompt string) (string, error) {
 	return CallGeminiAPI(apiKey, prompt)
 }
+
+// CallWithUsage implements UsageProvider.CallWithUsage for Gemini
+func (p *GeminiProvider) CallWithUsage(apiKey, prompt string) (string, Usage, error) {
+	return CallGeminiAPIWithUsage(apiKey, prompt)
+}
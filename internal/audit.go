@@ -0,0 +1,270 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stuttgart-things/k2n/internal/ai"
+
+	// SQLite driver for the audit store, pure Go so k2n stays statically linked.
+	_ "modernc.org/sqlite"
+)
+
+// AuditExchange is one prompt sent to the AI and the raw answer.
+type AuditExchange struct {
+	Prompt   string   `json:"prompt"`
+	Response string   `json:"response"`
+	Usage    ai.Usage `json:"usage"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// AuditRecord documents what a run sent to the AI, what came back and what was
+// written. Prompts are redacted before they are stored.
+type AuditRecord struct {
+	ID        string          `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	User      string          `json:"user"`
+	Command   string          `json:"command"`
+	Provider  string          `json:"provider"`
+	Model     string          `json:"model"`
+	Status    string          `json:"status"`
+	ReplayOf  string          `json:"replayOf,omitempty"`
+	Exchanges []AuditExchange `json:"exchanges"`
+	Parsed    interface{}     `json:"parsed,omitempty"`
+	Files     []ReportFile    `json:"files"`
+}
+
+// NewAuditRecord starts a record for command with the current user.
+func NewAuditRecord(command, provider, model string) *AuditRecord {
+	now := time.Now()
+	return &AuditRecord{
+		ID:        fmt.Sprintf("%s-%04x", now.Format("20060102-150405"), now.Nanosecond()&0xffff),
+		Timestamp: now,
+		User:      currentUser(),
+		Command:   command,
+		Provider:  provider,
+		Model:     model,
+		Status:    ReportSuccess,
+		Exchanges: []AuditExchange{},
+		Files:     []ReportFile{},
+	}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// AddExchange records a prompt, after redaction, and the raw response.
+func (r *AuditRecord) AddExchange(prompt, response string, usage ai.Usage, err error) {
+	exchange := AuditExchange{Prompt: RedactSecrets(prompt), Response: response, Usage: usage}
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+	r.Exchanges = append(r.Exchanges, exchange)
+}
+
+// Finish copies status and written files from the run report.
+func (r *AuditRecord) Finish(report *Report) {
+	if report == nil {
+		return
+	}
+	r.Status = report.Status
+	r.Files = append(r.Files, report.Files...)
+}
+
+// AuditStore persists audit records.
+type AuditStore interface {
+	Save(record *AuditRecord) error
+	// List returns all records, newest first.
+	List() ([]*AuditRecord, error)
+	Load(id string) (*AuditRecord, error)
+	Close() error
+}
+
+// AuditLocation returns where audit records are stored: the given location or
+// K2N_AUDIT. An empty result means auditing is disabled.
+func AuditLocation(location string) string {
+	if location != "" {
+		return location
+	}
+	return os.Getenv("K2N_AUDIT")
+}
+
+// OpenAuditStore opens the store at location. "sqlite:<file>" or a file ending in
+// .db, .sqlite or .sqlite3 is a SQLite database; anything else is a directory of
+// JSON files.
+func OpenAuditStore(location string) (AuditStore, error) {
+	if location == "" {
+		return nil, fmt.Errorf("no audit store configured, use --audit or K2N_AUDIT")
+	}
+	if path, ok := strings.CutPrefix(location, "sqlite:"); ok {
+		return openSQLiteAuditStore(path)
+	}
+	switch strings.ToLower(filepath.Ext(location)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return openSQLiteAuditStore(location)
+	}
+	return &dirAuditStore{dir: location}, nil
+}
+
+// dirAuditStore keeps one JSON file per record in a directory.
+type dirAuditStore struct {
+	dir string
+}
+
+func (s *dirAuditStore) Save(record *AuditRecord) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create audit directory %s: %w", s.dir, err)
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	path := filepath.Join(s.dir, record.ID+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write audit record %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *dirAuditStore) List() ([]*AuditRecord, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit directory %s: %w", s.dir, err)
+	}
+
+	var records []*AuditRecord
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		r, err := s.Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(a, b int) bool {
+		return records[a].Timestamp.After(records[b].Timestamp)
+	})
+	return records, nil
+}
+
+func (s *dirAuditStore) Load(id string) (*AuditRecord, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.Base(id)+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit record %s: %w", id, err)
+	}
+	var r AuditRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode audit record %s: %w", id, err)
+	}
+	return &r, nil
+}
+
+func (s *dirAuditStore) Close() error { return nil }
+
+// sqliteAuditStore keeps records in a SQLite table. Searchable fields have their
+// own columns, the full record is stored as JSON.
+type sqliteAuditStore struct {
+	db *sql.DB
+}
+
+func openSQLiteAuditStore(path string) (*sqliteAuditStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create directory for audit database %s: %w", path, err)
+		}
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit database %s: %w", path, err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS audit (
+		id        TEXT PRIMARY KEY,
+		timestamp TEXT NOT NULL,
+		user      TEXT,
+		command   TEXT,
+		provider  TEXT,
+		model     TEXT,
+		status    TEXT,
+		record    TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare audit database %s: %w", path, err)
+	}
+	return &sqliteAuditStore{db: db}, nil
+}
+
+// auditTimeLayout has a fixed width so timestamps sort as text.
+const auditTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func (s *sqliteAuditStore) Save(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	_, err = s.db.Exec(
+		`INSERT OR REPLACE INTO audit (id, timestamp, user, command, provider, model, status, record) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.ID, record.Timestamp.UTC().Format(auditTimeLayout), record.User, record.Command,
+		record.Provider, record.Model, record.Status, string(data),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store audit record %s: %w", record.ID, err)
+	}
+	return nil
+}
+
+func (s *sqliteAuditStore) List() ([]*AuditRecord, error) {
+	rows, err := s.db.Query(`SELECT record FROM audit ORDER BY timestamp DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*AuditRecord
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var r AuditRecord
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, fmt.Errorf("failed to decode audit record: %w", err)
+		}
+		records = append(records, &r)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqliteAuditStore) Load(id string) (*AuditRecord, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT record FROM audit WHERE id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("audit record %s not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit record %s: %w", id, err)
+	}
+	var r AuditRecord
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, fmt.Errorf("failed to decode audit record %s: %w", id, err)
+	}
+	return &r, nil
+}
+
+func (s *sqliteAuditStore) Close() error { return s.db.Close() }
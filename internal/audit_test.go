@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stuttgart-things/k2n/internal/ai"
+)
+
+func TestAuditStores(t *testing.T) {
+	dir := t.TempDir()
+	locations := map[string]string{
+		"directory":     filepath.Join(dir, "audit"),
+		"sqlite prefix": "sqlite:" + filepath.Join(dir, "prefixed"),
+		"sqlite file":   filepath.Join(dir, "nested", "audit.db"),
+	}
+
+	for name, location := range locations {
+		t.Run(name, func(t *testing.T) {
+			store, err := OpenAuditStore(location)
+			if err != nil {
+				t.Fatalf("OpenAuditStore returned error: %v", err)
+			}
+			defer store.Close()
+
+			if records, err := store.List(); err != nil || len(records) != 0 {
+				t.Fatalf("expected empty store, got %v, %v", records, err)
+			}
+
+			older := NewAuditRecord("gen", "openrouter", "model-a")
+			older.ID = "older"
+			older.Timestamp = time.Now().Add(-time.Hour)
+			older.AddExchange("token: abc", "answer", ai.Usage{TotalTokens: 3}, nil)
+			older.AddExchange("repair", "", ai.Usage{}, errors.New("boom"))
+			older.Parsed = []GeneratedFile{{Name: "a.yaml", Content: "kind: A"}}
+
+			report := NewReport("gen")
+			report.Files = []ReportFile{{Path: "out/a.yaml", Action: ActionCreated, Checksum: "sha256:x"}}
+			report.Fail("ai", errors.New("boom"))
+			older.Finish(report)
+
+			newer := NewAuditRecord("talk", "gemini", "model-b")
+			newer.ID = "newer"
+
+			for _, r := range []*AuditRecord{older, newer} {
+				if err := store.Save(r); err != nil {
+					t.Fatalf("Save returned error: %v", err)
+				}
+			}
+
+			records, err := store.List()
+			if err != nil {
+				t.Fatalf("List returned error: %v", err)
+			}
+			if len(records) != 2 || records[0].ID != "newer" || records[1].ID != "older" {
+				t.Fatalf("expected newest first, got %v", records)
+			}
+
+			loaded, err := store.Load("older")
+			if err != nil {
+				t.Fatalf("Load returned error: %v", err)
+			}
+			if loaded.Status != ReportFailed || len(loaded.Files) != 1 || len(loaded.Exchanges) != 2 {
+				t.Errorf("unexpected record: %+v", loaded)
+			}
+			if strings.Contains(loaded.Exchanges[0].Prompt, "abc") {
+				t.Error("prompt must be redacted")
+			}
+			if loaded.Exchanges[0].Response != "answer" || loaded.Exchanges[1].Error != "boom" || loaded.Exchanges[0].Usage.TotalTokens != 3 {
+				t.Errorf("unexpected exchanges: %+v", loaded.Exchanges)
+			}
+			if loaded.Parsed == nil {
+				t.Error("parsed result missing")
+			}
+
+			if _, err := store.Load("missing"); err == nil {
+				t.Error("expected error for unknown id")
+			}
+		})
+	}
+}
+
+func TestAuditLocation(t *testing.T) {
+	t.Setenv("K2N_AUDIT", "/from/env")
+	if got := AuditLocation(""); got != "/from/env" {
+		t.Errorf("got %q, want env value", got)
+	}
+	if got := AuditLocation("/flag"); got != "/flag" {
+		t.Errorf("got %q, flag should win", got)
+	}
+	if _, err := OpenAuditStore(""); err == nil {
+		t.Error("expected error without location")
+	}
+}
@@ -0,0 +1,626 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stuttgart-things/k2n/internal/ai"
+	"gopkg.in/yaml.v3"
+)
+
+// BatchJob is one generation of a batch manifest. Empty fields are taken from
+// the manifest defaults.
+type BatchJob struct {
+	Name                string                 `json:"name" yaml:"name"`
+	Instruction         string                 `json:"instruction,omitempty" yaml:"instruction,omitempty"`
+	Usecase             string                 `json:"usecase,omitempty" yaml:"usecase,omitempty"`
+	ExamplesDirs        []string               `json:"examplesDirs,omitempty" yaml:"examplesDirs,omitempty"`
+	ExampleFiles        []string               `json:"exampleFiles,omitempty" yaml:"exampleFiles,omitempty"`
+	ExampleFileExt      []string               `json:"exampleFileExt,omitempty" yaml:"exampleFileExt,omitempty"`
+	ExampleInclude      []string               `json:"exampleInclude,omitempty" yaml:"exampleInclude,omitempty"`
+	ExampleExclude      []string               `json:"exampleExclude,omitempty" yaml:"exampleExclude,omitempty"`
+	ExampleMaxSize      string                 `json:"exampleMaxSize,omitempty" yaml:"exampleMaxSize,omitempty"`
+	ExampleMaxTotal     string                 `json:"exampleMaxTotal,omitempty" yaml:"exampleMaxTotal,omitempty"`
+	ExampleSimilarity   *float64               `json:"exampleSimilarity,omitempty" yaml:"exampleSimilarity,omitempty"`
+	RulesetEnvDirs      []string               `json:"rulesetEnvDirs,omitempty" yaml:"rulesetEnvDirs,omitempty"`
+	RulesetUsecaseDirs  []string               `json:"rulesetUsecaseDirs,omitempty" yaml:"rulesetUsecaseDirs,omitempty"`
+	RulesetEnvFiles     []string               `json:"rulesetEnvFiles,omitempty" yaml:"rulesetEnvFiles,omitempty"`
+	RulesetUsecaseFiles []string               `json:"rulesetUsecaseFiles,omitempty" yaml:"rulesetUsecaseFiles,omitempty"`
+	Rulesets            []string               `json:"rulesets,omitempty" yaml:"rulesets,omitempty"`
+	Destination         string                 `json:"destination,omitempty" yaml:"destination,omitempty"`
+	Values              map[string]interface{} `json:"values,omitempty" yaml:"values,omitempty"`
+	MaxRepairs          *int                   `json:"maxRepairs,omitempty" yaml:"maxRepairs,omitempty"`
+	PostProcess         *bool                  `json:"postprocess,omitempty" yaml:"postprocess,omitempty"`
+	Overwrite           string                 `json:"overwrite,omitempty" yaml:"overwrite,omitempty"`
+}
+
+// BatchManifest is the file read by 'k2n batch'.
+type BatchManifest struct {
+	Defaults BatchJob   `yaml:"defaults"`
+	Jobs     []BatchJob `yaml:"jobs"`
+}
+
+// LoadBatchManifest reads a manifest and returns its jobs with the defaults
+// applied and relative paths resolved against the manifest directory.
+func LoadBatchManifest(path string) ([]BatchJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+
+	var manifest BatchManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if len(manifest.Jobs) == 0 {
+		return nil, fmt.Errorf("manifest %s contains no jobs", path)
+	}
+
+	baseDir := filepath.Dir(path)
+	seen := map[string]bool{}
+	jobs := make([]BatchJob, 0, len(manifest.Jobs))
+	for i, job := range manifest.Jobs {
+		job = mergeBatchJob(manifest.Defaults, job)
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("job-%d", i+1)
+		}
+		if seen[job.Name] {
+			return nil, fmt.Errorf("duplicate job name %q", job.Name)
+		}
+		seen[job.Name] = true
+
+		if job.Instruction == "" {
+			return nil, fmt.Errorf("job %q: instruction is required", job.Name)
+		}
+		if job.Destination == "" {
+			return nil, fmt.Errorf("job %q: destination is required", job.Name)
+		}
+		if job.Overwrite == "" {
+			job.Overwrite = string(OverwriteAlways)
+		}
+		policy, err := ParseOverwritePolicy(job.Overwrite)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		if policy == OverwritePrompt {
+			return nil, fmt.Errorf("job %q: overwrite policy %q is not available in batch mode", job.Name, policy)
+		}
+		if _, err := ParseRulesetSources(job.Rulesets); err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		if _, err := ParseByteSize(job.ExampleMaxSize); err != nil {
+			return nil, fmt.Errorf("job %q: exampleMaxSize: %w", job.Name, err)
+		}
+		if _, err := ParseByteSize(job.ExampleMaxTotal); err != nil {
+			return nil, fmt.Errorf("job %q: exampleMaxTotal: %w", job.Name, err)
+		}
+		if s := job.ExampleSimilarity; s != nil && (*s < 0 || *s > 1) {
+			return nil, fmt.Errorf("job %q: exampleSimilarity must be between 0 and 1", job.Name)
+		}
+
+		resolveBatchPaths(&job, baseDir)
+		// Jobs run in parallel, so they must not write to the same files.
+		for _, other := range jobs {
+			if destinationsOverlap(other.Destination, job.Destination) {
+				return nil, fmt.Errorf("jobs %q and %q write to overlapping destinations %s and %s", other.Name, job.Name, other.Destination, job.Destination)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// mergeBatchJob fills the empty fields of job from defaults. Values are merged
+// deeply with the job values taking precedence.
+func mergeBatchJob(defaults, job BatchJob) BatchJob {
+	pickString := func(v, d string) string {
+		if v != "" {
+			return v
+		}
+		return d
+	}
+	pickSlice := func(v, d []string) []string {
+		if v != nil {
+			return v
+		}
+		return d
+	}
+
+	merged := job
+	merged.Instruction = pickString(job.Instruction, defaults.Instruction)
+	merged.Usecase = pickString(job.Usecase, defaults.Usecase)
+	merged.Destination = pickString(job.Destination, defaults.Destination)
+	merged.Overwrite = pickString(job.Overwrite, defaults.Overwrite)
+	merged.ExamplesDirs = pickSlice(job.ExamplesDirs, defaults.ExamplesDirs)
+	merged.ExampleFiles = pickSlice(job.ExampleFiles, defaults.ExampleFiles)
+	merged.ExampleFileExt = pickSlice(job.ExampleFileExt, defaults.ExampleFileExt)
+	merged.ExampleInclude = pickSlice(job.ExampleInclude, defaults.ExampleInclude)
+	merged.ExampleExclude = pickSlice(job.ExampleExclude, defaults.ExampleExclude)
+	merged.ExampleMaxSize = pickString(job.ExampleMaxSize, defaults.ExampleMaxSize)
+	merged.ExampleMaxTotal = pickString(job.ExampleMaxTotal, defaults.ExampleMaxTotal)
+	if merged.ExampleSimilarity == nil {
+		merged.ExampleSimilarity = defaults.ExampleSimilarity
+	}
+	merged.RulesetEnvDirs = pickSlice(job.RulesetEnvDirs, defaults.RulesetEnvDirs)
+	merged.RulesetUsecaseDirs = pickSlice(job.RulesetUsecaseDirs, defaults.RulesetUsecaseDirs)
+	merged.RulesetEnvFiles = pickSlice(job.RulesetEnvFiles, defaults.RulesetEnvFiles)
+	merged.RulesetUsecaseFiles = pickSlice(job.RulesetUsecaseFiles, defaults.RulesetUsecaseFiles)
+	merged.Rulesets = pickSlice(job.Rulesets, defaults.Rulesets)
+	if merged.MaxRepairs == nil {
+		merged.MaxRepairs = defaults.MaxRepairs
+	}
+	if merged.PostProcess == nil {
+		merged.PostProcess = defaults.PostProcess
+	}
+
+	values := cloneValues(defaults.Values)
+	mergeValues(values, cloneValues(job.Values))
+	merged.Values = values
+	return merged
+}
+
+// cloneValues deep-copies the nested maps of template values, so merging into
+// the copy leaves the shared defaults untouched.
+func cloneValues(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = cloneValues(m)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// isDirDestination reports whether a destination is a directory, because it
+// ends in a separator or exists as one.
+func isDirDestination(dest string) bool {
+	if strings.HasSuffix(dest, "/") || strings.HasSuffix(dest, string(os.PathSeparator)) {
+		return true
+	}
+	info, err := os.Stat(dest)
+	return err == nil && info.IsDir()
+}
+
+// destinationsOverlap reports whether two destinations are the same or one is
+// a directory containing the other.
+func destinationsOverlap(a, b string) bool {
+	ca, cb := filepath.Clean(a), filepath.Clean(b)
+	return ca == cb || (isDirDestination(a) && isWithin(ca, cb)) || (isDirDestination(b) && isWithin(cb, ca))
+}
+
+// resolveBatchPaths makes all relative paths of job relative to baseDir.
+func resolveBatchPaths(job *BatchJob, baseDir string) {
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		resolved := filepath.Join(baseDir, p)
+		// Keep a trailing separator, it marks a directory destination.
+		if strings.HasSuffix(p, "/") || strings.HasSuffix(p, string(os.PathSeparator)) {
+			resolved += string(os.PathSeparator)
+		}
+		return resolved
+	}
+	resolveAll := func(paths []string) []string {
+		if paths == nil {
+			return nil
+		}
+		out := make([]string, len(paths))
+		for i, p := range paths {
+			out[i] = resolve(p)
+		}
+		return out
+	}
+
+	job.ExamplesDirs = resolveAll(job.ExamplesDirs)
+	job.ExampleFiles = resolveAll(job.ExampleFiles)
+	job.RulesetEnvDirs = resolveAll(job.RulesetEnvDirs)
+	job.RulesetUsecaseDirs = resolveAll(job.RulesetUsecaseDirs)
+	job.RulesetEnvFiles = resolveAll(job.RulesetEnvFiles)
+	job.RulesetUsecaseFiles = resolveAll(job.RulesetUsecaseFiles)
+	job.Destination = resolve(job.Destination)
+
+	if job.Rulesets != nil {
+		rulesets := make([]string, len(job.Rulesets))
+		for i, spec := range job.Rulesets {
+			rulesets[i] = spec
+			if layer, path, ok := strings.Cut(spec, "="); ok {
+				rulesets[i] = layer + "=" + resolve(strings.TrimSpace(path))
+			}
+		}
+		job.Rulesets = rulesets
+	}
+}
+
+// Checksum identifies the job definition, so a resumed batch reruns jobs that
+// were edited since the last run.
+func (j BatchJob) Checksum() string {
+	data, _ := json.Marshal(j)
+	return Checksum(string(data))
+}
+
+// BatchStatus is the outcome of a single batch job.
+type BatchStatus string
+
+const (
+	BatchSucceeded BatchStatus = "succeeded"
+	BatchInvalid   BatchStatus = "invalid" // written, but still failing validation
+	BatchFailed    BatchStatus = "failed"
+	BatchSkipped   BatchStatus = "skipped" // succeeded in a previous run
+)
+
+// BatchResult is the outcome of a single batch job together with its run report.
+type BatchResult struct {
+	Job      BatchJob
+	Status   BatchStatus
+	Err      error
+	Duration time.Duration
+	Report   *Report
+}
+
+// BatchRunner runs batch jobs on a bounded pool of workers.
+type BatchRunner struct {
+	// Workers is the number of jobs generated concurrently (at least 1).
+	Workers int
+	// Call sends a prompt to the AI provider.
+	Call func(prompt string) (string, ai.Usage, error)
+	// Validate checks generated output before it is written.
+	Validate Validator
+	// Rulesets are added to the rulesets of every job, e.g. org-wide rules.
+	Rulesets []RulesetSource
+	// RulesMode says what happens with the structured rulesets of a job:
+	// RulesFix, RulesCheck or RulesOff. Empty means RulesFix.
+	RulesMode string
+	// MaxRepairs applies to jobs that do not set their own limit.
+	MaxRepairs int
+	// JournalDir is where the write journal of each job is saved. Empty disables journaling.
+	JournalDir string
+	// Command is recorded in the journal of each job.
+	Command string
+	// Skip reports whether a job already succeeded and can be skipped.
+	Skip func(job BatchJob) bool
+	// OnDone is called after each job finished. Calls are serialized.
+	OnDone func(result BatchResult)
+}
+
+// Run executes all jobs and returns their results in the order of jobs.
+func (r *BatchRunner) Run(jobs []BatchJob) []BatchResult {
+	workers := r.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]BatchResult, len(jobs))
+	indexes := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := r.runJob(jobs[i])
+				mu.Lock()
+				results[i] = result
+				if r.OnDone != nil {
+					r.OnDone(result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// runJob loads the inputs of a job, generates, validates and writes its output.
+func (r *BatchRunner) runJob(job BatchJob) (result BatchResult) {
+	start := time.Now()
+	report := NewReport("batch")
+	result = BatchResult{Job: job, Report: report}
+	defer func() {
+		result.Duration = time.Since(start)
+		report.FinishedAt = time.Now()
+	}()
+
+	fail := func(stage string, err error) BatchResult {
+		report.Fail(stage, err)
+		result.Status = BatchFailed
+		result.Err = err
+		return result
+	}
+
+	if r.Skip != nil && r.Skip(job) {
+		result.Status = BatchSkipped
+		return result
+	}
+
+	report.SetConfig(map[string]string{
+		"JOB":         job.Name,
+		"USECASE":     job.Usecase,
+		"DESTINATION": job.Destination,
+		"OVERWRITE":   job.Overwrite,
+	})
+
+	instruction, err := RenderInstruction(job.Instruction, job.Values)
+	if err != nil {
+		return fail("config", err)
+	}
+
+	sources, err := ParseRulesetSources(job.Rulesets)
+	if err != nil {
+		return fail("config", err)
+	}
+	// Sizes were validated when the manifest was loaded.
+	maxSize, _ := ParseByteSize(DefaultExampleMaxSize)
+	if job.ExampleMaxSize != "" {
+		maxSize, _ = ParseByteSize(job.ExampleMaxSize)
+	}
+	maxTotal, _ := ParseByteSize(job.ExampleMaxTotal)
+	var similarity float64
+	if job.ExampleSimilarity != nil {
+		similarity = *job.ExampleSimilarity
+	}
+	inputs, err := LoadInputs(InputConfig{
+		ExamplesDirs:        job.ExamplesDirs,
+		ExampleFiles:        job.ExampleFiles,
+		ExampleFileExt:      job.ExampleFileExt,
+		RulesetEnvDirs:      job.RulesetEnvDirs,
+		RulesetUsecaseDirs:  job.RulesetUsecaseDirs,
+		RulesetEnvFiles:     job.RulesetEnvFiles,
+		RulesetUsecaseFiles: job.RulesetUsecaseFiles,
+		Rulesets:            append(append([]RulesetSource(nil), r.Rulesets...), sources...),
+		Usecase:             job.Usecase,
+		ExampleInclude:      job.ExampleInclude,
+		ExampleExclude:      job.ExampleExclude,
+		ExampleMaxSize:      maxSize,
+		ExampleMaxTotal:     maxTotal,
+		ExampleSimilarity:   similarity,
+	})
+	if err != nil {
+		return fail("config", err)
+	}
+	report.Examples = inputs.ExamplePaths
+	report.Rulesets = inputs.RulesetPaths
+	report.Sources = inputs.GitSources
+	report.Skipped = inputs.SkippedFiles
+	report.Collapsed = inputs.CollapsedExamples
+	sort.Strings(report.Examples)
+	sort.Strings(report.Rulesets)
+	for _, w := range inputs.Warnings {
+		report.Warn("examples", "%s", w)
+	}
+	if len(inputs.Examples) == 0 {
+		report.Warn("examples", "no examples provided")
+	}
+
+	prompt := BuildPromptFromExamples(inputs.Examples, inputs.Context, inputs.EnvRules, inputs.UsecaseRules, job.Usecase, instruction)
+	report.SetPrompt(prompt)
+
+	maxRepairs := r.MaxRepairs
+	if job.MaxRepairs != nil {
+		maxRepairs = *job.MaxRepairs
+	}
+
+	call := func(p string) (string, error) {
+		out, usage, err := r.Call(p)
+		report.Usage.Add(usage)
+		return out, err
+	}
+	rulesMode := r.RulesMode
+	if rulesMode == "" {
+		rulesMode = RulesFix
+	}
+	validate := r.Validate
+	if len(inputs.Structured) > 0 && rulesMode != RulesOff {
+		validate = CombineValidators(validate, StructuredRulesValidator(inputs.Structured, rulesMode == RulesFix))
+	}
+	gen, err := GenerateWithRepair(prompt, maxRepairs, call, validate, nil)
+	if err != nil {
+		return fail("ai", err)
+	}
+	if len(inputs.Structured) > 0 && rulesMode == RulesFix {
+		var violations []RuleViolation
+		gen.Output, violations = ApplyStructuredRulesets(gen.Output, inputs.Structured, true)
+		for _, v := range violations {
+			if v.Fixed {
+				report.Warn("rules", "%s", v)
+			}
+		}
+	}
+	if job.PostProcess == nil || *job.PostProcess {
+		var changes []PostProcessChange
+		gen.Output, changes = PostProcessOutput(gen.Output, PostProcessSettings(inputs.Structured))
+		for _, c := range changes {
+			report.Warn("postprocess", "%s", c)
+		}
+	}
+	report.Attempts = len(gen.Attempts)
+	if !gen.Passed {
+		for _, p := range gen.Attempts[len(gen.Attempts)-1].Problems {
+			report.Warn("validation", "%s", p)
+		}
+	}
+
+	policy, _ := ParseOverwritePolicy(job.Overwrite)
+	opts := OutputOptions{Policy: policy, Journal: NewJournal(r.Command, job.Destination)}
+	err = SaveOutputWithOptions(job.Destination, gen.Output, opts)
+	if r.JournalDir != "" {
+		if jerr := opts.Journal.Save(r.JournalDir); jerr != nil {
+			report.Warn("journal", "could not save journal: %v", jerr)
+		}
+	}
+	report.AddJournal(opts.Journal)
+	if err != nil {
+		return fail("output", err)
+	}
+
+	if !gen.Passed {
+		err := fmt.Errorf("output failed validation after %d repair attempt(s)", maxRepairs)
+		report.Fail("validation", err)
+		result.Status = BatchInvalid
+		result.Err = err
+		return result
+	}
+
+	result.Status = BatchSucceeded
+	return result
+}
+
+// SummarizeBatch counts the results per status.
+func SummarizeBatch(results []BatchResult) map[BatchStatus]int {
+	summary := map[BatchStatus]int{
+		BatchSucceeded: 0,
+		BatchInvalid:   0,
+		BatchFailed:    0,
+		BatchSkipped:   0,
+	}
+	for _, r := range results {
+		summary[r.Status]++
+	}
+	return summary
+}
+
+// BatchState remembers the outcome of each job between batch runs so failed
+// jobs can be resumed.
+type BatchState struct {
+	Manifest  string                     `json:"manifest"`
+	UpdatedAt time.Time                  `json:"updatedAt"`
+	Jobs      map[string]BatchStateEntry `json:"jobs"`
+}
+
+// BatchStateEntry is the last known outcome of a job.
+type BatchStateEntry struct {
+	Status   BatchStatus `json:"status"`
+	Checksum string      `json:"checksum"`
+	RunID    string      `json:"runId,omitempty"`
+}
+
+// BatchStatePath returns the default state file for a manifest.
+func BatchStatePath(manifest string) string {
+	return manifest + ".state.json"
+}
+
+// LoadBatchState reads a state file. A missing file yields an empty state.
+func LoadBatchState(path string) (*BatchState, error) {
+	state := &BatchState{Jobs: map[string]BatchStateEntry{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse batch state %s: %w", path, err)
+	}
+	if state.Jobs == nil {
+		state.Jobs = map[string]BatchStateEntry{}
+	}
+	return state, nil
+}
+
+// Succeeded reports whether job succeeded in a previous run and has not been
+// changed since.
+func (s *BatchState) Succeeded(job BatchJob) bool {
+	entry, ok := s.Jobs[job.Name]
+	return ok && entry.Status == BatchSucceeded && entry.Checksum == job.Checksum()
+}
+
+// Record stores the outcome of the given results. Skipped jobs keep their entry.
+func (s *BatchState) Record(results []BatchResult) {
+	for _, r := range results {
+		if r.Status == BatchSkipped {
+			continue
+		}
+		s.Jobs[r.Job.Name] = BatchStateEntry{
+			Status:   r.Status,
+			Checksum: r.Job.Checksum(),
+			RunID:    r.Report.RunID,
+		}
+	}
+}
+
+// Save writes the state to path.
+func (s *BatchState) Save(path string) error {
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write batch state %s: %w", path, err)
+	}
+	return nil
+}
+
+// BatchReport is the combined run report of a batch.
+type BatchReport struct {
+	Command    string              `json:"command" yaml:"command"`
+	Manifest   string              `json:"manifest" yaml:"manifest"`
+	Status     string              `json:"status" yaml:"status"`
+	StartedAt  time.Time           `json:"startedAt" yaml:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt" yaml:"finishedAt"`
+	Workers    int                 `json:"workers" yaml:"workers"`
+	Provider   string              `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Model      string              `json:"model,omitempty" yaml:"model,omitempty"`
+	Usage      ai.Usage            `json:"usage" yaml:"usage"`
+	Summary    map[BatchStatus]int `json:"summary" yaml:"summary"`
+	Jobs       []BatchJobReport    `json:"jobs" yaml:"jobs"`
+}
+
+// BatchJobReport is the part of a batch report describing one job.
+type BatchJobReport struct {
+	Name     string  `json:"name" yaml:"name"`
+	Status   string  `json:"status" yaml:"status"`
+	Duration string  `json:"duration" yaml:"duration"`
+	Error    string  `json:"error,omitempty" yaml:"error,omitempty"`
+	Report   *Report `json:"report,omitempty" yaml:"report,omitempty"`
+}
+
+// NewBatchReport combines the job results into one report. The batch fails if
+// any job failed or produced invalid output.
+func NewBatchReport(manifest string, startedAt time.Time, workers int, results []BatchResult) *BatchReport {
+	report := &BatchReport{
+		Command:    "batch",
+		Manifest:   manifest,
+		Status:     ReportSuccess,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+		Workers:    workers,
+		Summary:    SummarizeBatch(results),
+		Jobs:       []BatchJobReport{},
+	}
+	for _, r := range results {
+		job := BatchJobReport{
+			Name:     r.Job.Name,
+			Status:   string(r.Status),
+			Duration: r.Duration.Round(time.Millisecond).String(),
+		}
+		if r.Err != nil {
+			job.Error = r.Err.Error()
+		}
+		if r.Status != BatchSkipped {
+			job.Report = r.Report
+			report.Usage.Add(r.Report.Usage)
+		}
+		if r.Status == BatchFailed || r.Status == BatchInvalid {
+			report.Status = ReportFailed
+		}
+		report.Jobs = append(report.Jobs, job)
+	}
+	return report
+}
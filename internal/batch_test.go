@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stuttgart-things/k2n/internal/ai"
+)
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jobs.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBatchManifest(t *testing.T) {
+	path := writeManifest(t, `
+defaults:
+  usecase: github-runner
+  instruction: "Create a runner for {{ .repo }} in {{ .cluster.name }}"
+  examplesDirs: [examples]
+  rulesets: [org=rules/org/, run=/abs/run.yaml]
+  destination: out/
+  maxRepairs: 1
+  exampleSimilarity: 0.8
+  postprocess: false
+  values:
+    cluster:
+      name: dev
+      region: eu
+jobs:
+  - values:
+      repo: k2n
+  - name: special
+    usecase: crossplane
+    destination: /abs/out.yaml
+    exampleSimilarity: 0
+    postprocess: true
+    values:
+      repo: other
+      cluster:
+        name: prod
+`)
+	jobs, err := LoadBatchManifest(path)
+	if err != nil {
+		t.Fatalf("LoadBatchManifest returned error: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+
+	baseDir := filepath.Dir(path)
+	first := jobs[0]
+	if first.Name != "job-1" || first.Usecase != "github-runner" || first.Overwrite != "always" {
+		t.Errorf("defaults not applied: %+v", first)
+	}
+	if first.ExamplesDirs[0] != filepath.Join(baseDir, "examples") {
+		t.Errorf("examples dir not resolved: %v", first.ExamplesDirs)
+	}
+	if first.Destination != filepath.Join(baseDir, "out")+string(os.PathSeparator) {
+		t.Errorf("destination should keep trailing separator, got %q", first.Destination)
+	}
+	if len(first.Rulesets) != 2 || first.Rulesets[0] != "org="+filepath.Join(baseDir, "rules", "org")+string(os.PathSeparator) || first.Rulesets[1] != "run=/abs/run.yaml" {
+		t.Errorf("ruleset paths not resolved: %v", first.Rulesets)
+	}
+	if first.MaxRepairs == nil || *first.MaxRepairs != 1 {
+		t.Errorf("maxRepairs not inherited: %v", first.MaxRepairs)
+	}
+	if first.PostProcess == nil || *first.PostProcess {
+		t.Errorf("postprocess not inherited: %v", first.PostProcess)
+	}
+	if first.ExampleSimilarity == nil || *first.ExampleSimilarity != 0.8 {
+		t.Errorf("exampleSimilarity not inherited: %v", first.ExampleSimilarity)
+	}
+
+	second := jobs[1]
+	if second.Usecase != "crossplane" || second.Destination != "/abs/out.yaml" {
+		t.Errorf("job fields should override defaults: %+v", second)
+	}
+	if second.PostProcess == nil || !*second.PostProcess {
+		t.Errorf("postprocess should override the default: %v", second.PostProcess)
+	}
+	if second.ExampleSimilarity == nil || *second.ExampleSimilarity != 0 {
+		t.Errorf("exampleSimilarity 0 should disable the default: %v", second.ExampleSimilarity)
+	}
+	cluster := second.Values["cluster"].(map[string]interface{})
+	if cluster["name"] != "prod" || cluster["region"] != "eu" {
+		t.Errorf("values not deep-merged: %v", cluster)
+	}
+	if firstCluster := first.Values["cluster"].(map[string]interface{}); firstCluster["name"] != "dev" {
+		t.Errorf("merging a job must not change the defaults of other jobs: %v", firstCluster)
+	}
+}
+
+func TestLoadBatchManifestErrors(t *testing.T) {
+	tests := map[string]string{
+		"no jobs":            "jobs: []\n",
+		"no instruction":     "jobs:\n  - destination: out\n",
+		"no destination":     "jobs:\n  - instruction: x\n",
+		"duplicate names":    "defaults: {instruction: x, destination: out}\njobs:\n  - name: a\n  - name: a\n",
+		"prompt policy":      "jobs:\n  - {instruction: x, destination: out, overwrite: prompt}\n",
+		"unknown overwrite":  "jobs:\n  - {instruction: x, destination: out, overwrite: sometimes}\n",
+		"unknown layer":      "jobs:\n  - {instruction: x, destination: out, rulesets: [team=rules]}\n",
+		"invalid size":       "jobs:\n  - {instruction: x, destination: out, exampleMaxSize: huge}\n",
+		"invalid similarity": "jobs:\n  - {instruction: x, destination: out, exampleSimilarity: 1.5}\n",
+		"same destination":   "defaults: {instruction: x}\njobs:\n  - {name: a, destination: out.yaml}\n  - {name: b, destination: ./out.yaml}\n",
+		"same directory":     "defaults: {instruction: x, destination: out/}\njobs:\n  - name: a\n  - name: b\n",
+		"nested destination": "defaults: {instruction: x}\njobs:\n  - {name: a, destination: out/}\n  - {name: b, destination: out/apps/web.yaml}\n",
+	}
+	for name, manifest := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadBatchManifest(writeManifest(t, manifest)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestBatchRunner(t *testing.T) {
+	dir := t.TempDir()
+	jobs := []BatchJob{
+		{Name: "a", Instruction: "make {{ .name }}", Values: map[string]interface{}{"name": "a"}, Destination: filepath.Join(dir, "a.yaml")},
+		{Name: "b", Instruction: "make {{ .name }}", Values: map[string]interface{}{"name": "b"}, Destination: filepath.Join(dir, "b.yaml")},
+		{Name: "broken", Instruction: "make broken", Destination: filepath.Join(dir, "broken.yaml")},
+		{Name: "error", Instruction: "trigger-error", Destination: filepath.Join(dir, "error.yaml")},
+		{Name: "bad-template", Instruction: "{{ .missing }}", Values: map[string]interface{}{"name": "x"}, Destination: filepath.Join(dir, "x.yaml")},
+	}
+	for i := range jobs {
+		jobs[i].Overwrite = "always"
+	}
+
+	var running, maxRunning int32
+	call := func(prompt string) (string, ai.Usage, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		usage := ai.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}
+		switch {
+		case strings.Contains(prompt, "trigger-error"):
+			return "", usage, errors.New("boom")
+		case strings.Contains(prompt, "make broken"):
+			return "broken", usage, nil
+		}
+		return "kind: ok\n", usage, nil
+	}
+
+	var mu sync.Mutex
+	var done []string
+	runner := &BatchRunner{
+		Workers:    2,
+		Call:       call,
+		Validate:   func(content string) []string { return map[bool][]string{true: {"broken"}}[content == "broken"] },
+		MaxRepairs: 1,
+		Command:    "k2n batch",
+		OnDone: func(r BatchResult) {
+			mu.Lock()
+			done = append(done, r.Job.Name)
+			mu.Unlock()
+		},
+	}
+	results := runner.Run(jobs)
+
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent calls, got %d", maxRunning)
+	}
+	if len(done) != len(jobs) {
+		t.Errorf("OnDone called %d times, want %d", len(done), len(jobs))
+	}
+
+	want := []BatchStatus{BatchSucceeded, BatchSucceeded, BatchInvalid, BatchFailed, BatchFailed}
+	for i, r := range results {
+		if r.Job.Name != jobs[i].Name {
+			t.Errorf("results out of order: %d is %s", i, r.Job.Name)
+		}
+		if r.Status != want[i] {
+			t.Errorf("job %s: status %s, want %s (err %v)", r.Job.Name, r.Status, want[i], r.Err)
+		}
+	}
+
+	if results[2].Report.Attempts != 2 {
+		t.Errorf("invalid job should have used its repair, attempts=%d", results[2].Report.Attempts)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken.yaml")); err != nil {
+		t.Error("invalid output should still be written")
+	}
+	if results[0].Report.Usage.TotalTokens != 2 || len(results[0].Report.Files) != 1 {
+		t.Errorf("unexpected report for job a: %+v", results[0].Report)
+	}
+
+	summary := SummarizeBatch(results)
+	if summary[BatchSucceeded] != 2 || summary[BatchInvalid] != 1 || summary[BatchFailed] != 2 {
+		t.Errorf("unexpected summary: %v", summary)
+	}
+
+	report := NewBatchReport("jobs.yaml", time.Now(), 2, results)
+	if report.Status != ReportFailed || len(report.Jobs) != len(jobs) || report.Usage.TotalTokens != 10 {
+		t.Errorf("unexpected batch report: status=%s jobs=%d usage=%+v", report.Status, len(report.Jobs), report.Usage)
+	}
+}
+
+func TestBatchStateResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.yaml.state.json")
+	state, err := LoadBatchState(path)
+	if err != nil {
+		t.Fatalf("LoadBatchState on missing file returned error: %v", err)
+	}
+
+	ok := BatchJob{Name: "ok", Instruction: "a"}
+	failed := BatchJob{Name: "failed", Instruction: "b"}
+	state.Record([]BatchResult{
+		{Job: ok, Status: BatchSucceeded, Report: NewReport("batch")},
+		{Job: failed, Status: BatchFailed, Report: NewReport("batch")},
+	})
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	loaded, err := LoadBatchState(path)
+	if err != nil {
+		t.Fatalf("LoadBatchState returned error: %v", err)
+	}
+	if !loaded.Succeeded(ok) {
+		t.Error("succeeded job should be skipped on resume")
+	}
+	if loaded.Succeeded(failed) {
+		t.Error("failed job should run again on resume")
+	}
+	changed := ok
+	changed.Instruction = "changed"
+	if loaded.Succeeded(changed) {
+		t.Error("changed job should run again on resume")
+	}
+
+	runner := &BatchRunner{Skip: loaded.Succeeded}
+	results := runner.Run([]BatchJob{ok})
+	if results[0].Status != BatchSkipped {
+		t.Errorf("expected skipped, got %s", results[0].Status)
+	}
+	loaded.Record(results)
+	if !loaded.Succeeded(ok) {
+		t.Error("recording a skipped job must keep its previous state")
+	}
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChatTurn is one instruction of a chat session and the answer to it.
+type ChatTurn struct {
+	Instruction string
+	Output      string
+}
+
+// ChatSession keeps the inputs, the conversation and the current set of
+// generated files of an interactive chat.
+type ChatSession struct {
+	Inputs  *Inputs
+	Usecase string
+	History []ChatTurn
+	Files   []GeneratedFile
+
+	// previous holds the file sets before each turn, used by Undo and Diff.
+	previous [][]GeneratedFile
+}
+
+// NewChatSession starts a session with loaded examples and rulesets.
+func NewChatSession(inputs *Inputs, usecase string) *ChatSession {
+	if inputs == nil {
+		inputs = &Inputs{}
+	}
+	return &ChatSession{Inputs: inputs, Usecase: usecase}
+}
+
+// Prompt builds the prompt for the next instruction. The first turn is a plain
+// generation prompt; later turns add the conversation so far and the current
+// files and ask for the files that change.
+func (s *ChatSession) Prompt(instruction string) string {
+	base := BuildPromptFromExamples(s.Inputs.Examples, s.Inputs.Context, s.Inputs.EnvRules, s.Inputs.UsecaseRules, s.Usecase, instruction)
+	if len(s.History) == 0 {
+		return base
+	}
+
+	var builder strings.Builder
+	builder.WriteString(base)
+
+	builder.WriteString("\nEarlier instructions in this conversation:\n")
+	for i, turn := range s.History {
+		builder.WriteString(fmt.Sprintf("%d. %s\n", i+1, turn.Instruction))
+	}
+
+	builder.WriteString("\nCurrent files:\n")
+	builder.WriteString(s.Render())
+	builder.WriteString("\n\nApply the instruction to the current files. Return every file you change or add in full, with its file header. Files you do not return are kept unchanged.\n")
+
+	return builder.String()
+}
+
+// Apply records the answer to instruction and merges the returned files into the
+// current set: files with a known name are replaced, new files are appended.
+// It returns the names of the files that changed.
+func (s *ChatSession) Apply(instruction, output string) []string {
+	parsed := ParseGeneratedFiles(output)
+
+	snapshot := make([]GeneratedFile, len(s.Files))
+	copy(snapshot, s.Files)
+	s.previous = append(s.previous, snapshot)
+	s.History = append(s.History, ChatTurn{Instruction: instruction, Output: output})
+
+	index := make(map[string]int, len(s.Files))
+	for i, f := range s.Files {
+		index[f.Name] = i
+	}
+
+	var changed []string
+	for _, f := range parsed {
+		i, ok := index[f.Name]
+		switch {
+		case !ok:
+			index[f.Name] = len(s.Files)
+			s.Files = append(s.Files, f)
+		case s.Files[i].Content != f.Content:
+			s.Files[i] = f
+		default:
+			continue
+		}
+		changed = append(changed, f.Name)
+	}
+	return changed
+}
+
+// Undo reverts the last turn. It returns false if there is nothing to undo.
+func (s *ChatSession) Undo() bool {
+	if len(s.previous) == 0 {
+		return false
+	}
+	last := len(s.previous) - 1
+	s.Files = s.previous[last]
+	s.previous = s.previous[:last]
+	s.History = s.History[:len(s.History)-1]
+	return true
+}
+
+// Render joins the current files into one output with file headers, as
+// understood by ParseGeneratedFiles and SaveOutput.
+func (s *ChatSession) Render() string {
+	return RenderGeneratedFiles(s.Files)
+}
+
+// Diff renders the changes of the last turn as unified diffs.
+func (s *ChatSession) Diff() string {
+	if len(s.previous) == 0 {
+		return ""
+	}
+	before := map[string]string{}
+	for _, f := range s.previous[len(s.previous)-1] {
+		before[f.Name] = f.Content
+	}
+
+	var b strings.Builder
+	for _, f := range s.Files {
+		old, existed := before[f.Name]
+		oldName := "a/" + f.Name
+		if !existed {
+			oldName = "/dev/null"
+		}
+		b.WriteString(UnifiedDiff(oldName, "b/"+f.Name, withNewline(old), withNewline(f.Content), 3))
+	}
+	return b.String()
+}
+
+// withNewline terminates non-empty content with a newline, so parsed files
+// diff cleanly against each other.
+func withNewline(content string) string {
+	if content == "" || strings.HasSuffix(content, "\n") {
+		return content
+	}
+	return content + "\n"
+}
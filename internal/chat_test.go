@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChatSession(t *testing.T) {
+	session := NewChatSession(&Inputs{EnvRules: []string{"always set a namespace"}}, "kubernetes")
+
+	first := session.Prompt("create a deployment")
+	if strings.Contains(first, "Current files:") || !strings.Contains(first, "always set a namespace") {
+		t.Errorf("first prompt should be a plain generation prompt, got %q", first)
+	}
+
+	changed := session.Apply("create a deployment", "# file: deploy.yaml\nkind: Deployment\n# file: svc.yaml\nkind: Service\n")
+	if len(changed) != 2 || len(session.Files) != 2 {
+		t.Fatalf("expected two new files, changed=%v files=%v", changed, session.Files)
+	}
+
+	second := session.Prompt("add replicas")
+	for _, want := range []string{"1. create a deployment", "Current files:", FileHeaderPrefix + "svc.yaml", "Instruction:\nadd replicas"} {
+		if !strings.Contains(second, want) {
+			t.Errorf("follow-up prompt should contain %q", want)
+		}
+	}
+
+	changed = session.Apply("add replicas", "# file: deploy.yaml\nkind: Deployment\nreplicas: 2\n# file: svc.yaml\nkind: Service\n")
+	if len(changed) != 1 || changed[0] != "deploy.yaml" {
+		t.Errorf("only deploy.yaml should have changed, got %v", changed)
+	}
+	if len(session.Files) != 2 {
+		t.Errorf("files not returned must be kept, got %v", session.Files)
+	}
+
+	diff := session.Diff()
+	if !strings.Contains(diff, "+replicas: 2") || strings.Contains(diff, "svc.yaml") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+
+	if got := ParseGeneratedFiles(session.Render()); len(got) != 2 || got[0].Content != "kind: Deployment\nreplicas: 2" {
+		t.Errorf("rendered files do not round-trip: %v", got)
+	}
+
+	if !session.Undo() {
+		t.Fatal("Undo returned false")
+	}
+	if len(session.History) != 1 || session.Files[0].Content != "kind: Deployment" {
+		t.Errorf("undo should restore the previous turn, got %v", session.Files)
+	}
+	if !session.Undo() || session.Undo() {
+		t.Error("expected exactly one more undo")
+	}
+	if len(session.Files) != 0 || session.Diff() != "" {
+		t.Errorf("session should be empty after undoing everything, got %v", session.Files)
+	}
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultContextMaxSize is the total size of reference context loaded unless
+// configured otherwise.
+const DefaultContextMaxSize = "256KB"
+
+// ContextConfig lists reference context: files with facts for the model, like
+// a cluster inventory or a versions matrix, as opposed to style examples.
+type ContextConfig struct {
+	Files []string
+	Dirs  []string
+	// MaxTotalSize limits the size of all context files, 0 means no limit.
+	MaxTotalSize int64
+	// KeepSecrets turns off the redaction of credentials.
+	KeepSecrets bool
+}
+
+// ContextFile is a loaded reference context file.
+type ContextFile struct {
+	Path string
+	// Title names the context in the prompt instead of the file name.
+	Title   string
+	Content string
+	Size    int64
+	// Redacted is set if credentials were replaced in Content.
+	Redacted bool
+}
+
+// LoadContextFiles loads the context files and every text file below the
+// context directories, in that order. Directories honor .k2nignore files.
+// Files beyond the size budget and binary files are skipped and returned.
+// Content is used as it is, k2n metadata comments are not removed.
+func LoadContextFiles(cfg ContextConfig) ([]ContextFile, []SkippedFile, error) {
+	loader := NewExampleLoader(ExampleFilter{MaxTotalSize: cfg.MaxTotalSize})
+	loader.Raw = true
+
+	var loaded []Example
+	for _, p := range cfg.Files {
+		ex, ok, err := loader.LoadFile(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load context file: %w", err)
+		}
+		if ok {
+			loaded = append(loaded, ex)
+		}
+	}
+	for _, dir := range cfg.Dirs {
+		examples, err := loader.LoadDir(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load context from dir %s: %w", dir, err)
+		}
+		loaded = append(loaded, examples...)
+	}
+
+	var files []ContextFile
+	for _, ex := range DeduplicateExamples(loaded) {
+		f := ContextFile{Path: ex.Path, Content: ex.Content, Size: ex.Size}
+		if !cfg.KeepSecrets {
+			f.Content = RedactSecrets(ex.Content)
+			f.Redacted = f.Content != ex.Content
+		}
+		files = append(files, f)
+	}
+	return files, loader.Skipped, nil
+}
+
+// ReferenceContextSection renders context files for a prompt. It is empty if
+// there are none.
+func ReferenceContextSection(files []ContextFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString("Reference context:\n")
+	builder.WriteString("The following files describe the target environment. Treat them as facts to use, e.g. existing names, namespaces and versions. They are not examples of the output format and must not be returned as files.\n\n")
+	for i, f := range files {
+		title := f.Title
+		if title == "" {
+			title = filepath.Base(f.Path)
+		}
+		builder.WriteString(fmt.Sprintf("Context %d (%s):\n%s\n---\n", i+1, title, strings.TrimRight(f.Content, "\n")))
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
@@ -0,0 +1,307 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FilePatterns are the file naming schemes LearnConventions recognizes, in
+// order of preference. {kind} is the lowercase kind.
+var FilePatterns = []string{
+	"{name}{ext}",
+	"{kind}-{name}{ext}",
+	"{name}-{kind}{ext}",
+	"{kind}{ext}",
+}
+
+// Conventions are the layout and naming of the manifests in an existing
+// repository, learned so generated files fit in.
+type Conventions struct {
+	Root string `json:"root" yaml:"root"`
+	// Manifests is the number of Kubernetes manifests found.
+	Manifests int `json:"manifests" yaml:"manifests"`
+	// NamespaceDirs is set if manifests live in a directory named after their
+	// namespace, below NamespaceParent.
+	NamespaceDirs   bool   `json:"namespaceDirs" yaml:"namespaceDirs"`
+	NamespaceParent string `json:"namespaceParent,omitempty" yaml:"namespaceParent,omitempty"`
+	// FilePattern is the naming scheme of most files, one of FilePatterns.
+	FilePattern string `json:"filePattern,omitempty" yaml:"filePattern,omitempty"`
+	Extension   string `json:"extension,omitempty" yaml:"extension,omitempty"`
+	// CommonLabels are labels at least three quarters of the manifests carry.
+	CommonLabels map[string]string `json:"commonLabels,omitempty" yaml:"commonLabels,omitempty"`
+	// Kustomize is set if directories with manifests have a kustomization.
+	Kustomize bool `json:"kustomize" yaml:"kustomize"`
+	// Samples are a few existing manifest paths, relative to Root.
+	Samples []string `json:"samples,omitempty" yaml:"samples,omitempty"`
+}
+
+// manifestInfo identifies the first Kubernetes object of a file.
+type manifestInfo struct {
+	Kind, Name, Namespace string
+	Labels                map[string]string
+}
+
+// kustomizationFiles are the file names kustomize looks for.
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// LearnConventions scans the YAML files below root and infers where manifests
+// are stored and how they are named. Conventions need a majority: a pattern
+// followed by less than half of the manifests is not reported, a label must be
+// on three quarters of them.
+func LearnConventions(root string) (*Conventions, error) {
+	maxSize, _ := ParseByteSize(DefaultExampleMaxSize)
+	loader := NewExampleLoader(ExampleFilter{Extensions: []string{".yaml", ".yml"}, MaxFileSize: maxSize})
+	files, err := loader.LoadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	c := &Conventions{Root: root}
+	var (
+		patterns   = map[string]int{}
+		exts       = map[string]int{}
+		parents    = map[string]int{}
+		labels     = map[string]int{}
+		kustomized = map[string]bool{}
+		dirs       = map[string]bool{}
+		namespaced int
+	)
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.Path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		dir := path.Dir(rel)
+		if containsFold(kustomizationFiles, path.Base(rel)) {
+			kustomized[dir] = true
+			continue
+		}
+		info, ok := parseManifestInfo(f.Content)
+		if !ok {
+			continue
+		}
+
+		c.Manifests++
+		dirs[dir] = true
+		if len(c.Samples) < 3 {
+			c.Samples = append(c.Samples, rel)
+		}
+		ext := path.Ext(rel)
+		exts[ext]++
+		for _, p := range FilePatterns {
+			if renderFilePattern(p, info, ext) == path.Base(rel) {
+				patterns[p]++
+			}
+		}
+		if info.Namespace != "" {
+			namespaced++
+			segments := strings.Split(dir, "/")
+			for i, s := range segments {
+				if s == info.Namespace {
+					parents[strings.Join(segments[:i], "/")]++
+					break
+				}
+			}
+		}
+		for k, v := range info.Labels {
+			labels[k+"="+v]++
+		}
+	}
+	if c.Manifests == 0 {
+		return c, nil
+	}
+
+	majority := func(n, of int) bool { return of > 0 && n*2 >= of }
+	if p, n := mostCommon(patterns, FilePatterns); majority(n, c.Manifests) {
+		c.FilePattern = p
+	}
+	c.Extension, _ = mostCommon(exts, []string{".yaml", ".yml"})
+	total := 0
+	for _, n := range parents {
+		total += n
+	}
+	if majority(total, namespaced) {
+		c.NamespaceDirs = true
+		c.NamespaceParent, _ = mostCommon(parents, nil)
+	}
+	if c.Manifests >= 2 {
+		for kv, n := range labels {
+			if n*4 >= c.Manifests*3 {
+				if c.CommonLabels == nil {
+					c.CommonLabels = map[string]string{}
+				}
+				k, v, _ := strings.Cut(kv, "=")
+				c.CommonLabels[k] = v
+			}
+		}
+	}
+	withKustomization := 0
+	for dir := range dirs {
+		if kustomized[dir] {
+			withKustomization++
+		}
+	}
+	c.Kustomize = majority(withKustomization, len(dirs))
+	return c, nil
+}
+
+// Empty reports whether nothing was learned.
+func (c *Conventions) Empty() bool {
+	return c == nil || (!c.NamespaceDirs && c.FilePattern == "" && len(c.CommonLabels) == 0 && !c.Kustomize)
+}
+
+// PromptText summarizes the conventions for the model.
+func (c *Conventions) PromptText() string {
+	if c.Empty() {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("The destination already contains %d manifests, e.g. %s. New files must follow its conventions:\n", c.Manifests, strings.Join(c.Samples, ", ")))
+	if c.NamespaceDirs {
+		b.WriteString(fmt.Sprintf("- Every manifest is stored in a directory named after its namespace: %s\n", path.Join(c.NamespaceParent, "<namespace>")+"/"))
+	}
+	if c.FilePattern != "" {
+		b.WriteString(fmt.Sprintf("- Files are named %s, with the kind in lowercase\n", c.FilePattern))
+	}
+	if len(c.CommonLabels) > 0 {
+		var pairs []string
+		for k, v := range c.CommonLabels {
+			pairs = append(pairs, k+": "+v)
+		}
+		sort.Strings(pairs)
+		b.WriteString("- Manifests carry the labels " + strings.Join(pairs, ", ") + "\n")
+	}
+	if c.Kustomize {
+		b.WriteString("- Directories with manifests have a kustomization.yaml listing them in resources\n")
+	}
+	return b.String()
+}
+
+// MapFileName returns where a generated file belongs in the learned layout.
+// Files that are not Kubernetes manifests keep their name.
+func (c *Conventions) MapFileName(f GeneratedFile) string {
+	if c.Empty() || !isYAMLPath(f.Name) {
+		return f.Name
+	}
+	info, ok := parseManifestInfo(f.Content)
+	if !ok {
+		return f.Name
+	}
+
+	dir, base := path.Split(f.Name)
+	if c.NamespaceDirs && info.Namespace != "" {
+		dir = path.Join(c.NamespaceParent, info.Namespace)
+	}
+	if c.FilePattern != "" {
+		base = renderFilePattern(c.FilePattern, info, c.Extension)
+	}
+	return path.Join(dir, base)
+}
+
+// FileRename is a generated file moved into the learned layout.
+type FileRename struct {
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+}
+
+// ApplyConventions renames the generated files in output to fit the learned
+// layout. A file keeps its name if the new name is already taken.
+func (c *Conventions) ApplyConventions(output string) (string, []FileRename) {
+	if c.Empty() {
+		return output, nil
+	}
+	files := ParseGeneratedFiles(output)
+	taken := map[string]bool{}
+	for _, f := range files {
+		taken[f.Name] = true
+	}
+
+	var renames []FileRename
+	for i, f := range files {
+		name := c.MapFileName(f)
+		if name == f.Name || taken[name] {
+			continue
+		}
+		taken[name] = true
+		renames = append(renames, FileRename{From: f.Name, To: name})
+		files[i].Name = name
+	}
+	if len(renames) == 0 {
+		return output, nil
+	}
+	return RenderGeneratedFiles(files), renames
+}
+
+// parseManifestInfo reads kind, name, namespace and labels of the first
+// document that has a kind and a name.
+func parseManifestInfo(content string) (manifestInfo, bool) {
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var doc struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string            `yaml:"name"`
+				Namespace string            `yaml:"namespace"`
+				Labels    map[string]string `yaml:"labels"`
+			} `yaml:"metadata"`
+		}
+		if err := dec.Decode(&doc); err != nil {
+			return manifestInfo{}, false
+		}
+		if doc.Kind != "" && doc.Metadata.Name != "" {
+			return manifestInfo{
+				Kind:      doc.Kind,
+				Name:      doc.Metadata.Name,
+				Namespace: doc.Metadata.Namespace,
+				Labels:    doc.Metadata.Labels,
+			}, true
+		}
+	}
+}
+
+func renderFilePattern(pattern string, info manifestInfo, ext string) string {
+	if ext == "" {
+		ext = ".yaml"
+	}
+	return strings.NewReplacer(
+		"{kind}", strings.ToLower(info.Kind),
+		"{name}", info.Name,
+		"{ext}", ext,
+	).Replace(pattern)
+}
+
+// mostCommon returns the key with the highest count. Ties go to the key listed
+// first in order, then to the smallest key.
+func mostCommon(counts map[string]int, order []string) (string, int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	rank := func(k string) int {
+		for i, o := range order {
+			if o == k {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if counts[keys[a]] != counts[keys[b]] {
+			return counts[keys[a]] > counts[keys[b]]
+		}
+		if rank(keys[a]) != rank(keys[b]) {
+			return rank(keys[a]) < rank(keys[b])
+		}
+		return keys[a] < keys[b]
+	})
+	if len(keys) == 0 {
+		return "", 0
+	}
+	return keys[0], counts[keys[0]]
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func manifest(kind, name, namespace string) string {
+	return "apiVersion: v1\nkind: " + kind + "\nmetadata:\n  name: " + name + "\n  namespace: " + namespace +
+		"\n  labels:\n    app.kubernetes.io/managed-by: flux\n    app.kubernetes.io/name: " + name + "\n"
+}
+
+func TestLearnConventions(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"apps/runners/deployment-runner.yaml":    manifest("Deployment", "runner", "runners"),
+		"apps/runners/service-runner.yaml":       manifest("Service", "runner", "runners"),
+		"apps/runners/kustomization.yaml":        "resources:\n  - deployment-runner.yaml\n",
+		"apps/machinery/configmap-api.yaml":      manifest("ConfigMap", "api", "machinery"),
+		"apps/machinery/kustomization.yaml":      "resources:\n  - configmap-api.yaml\n",
+		"apps/machinery/README.md":               "not yaml",
+		"apps/machinery/values/helm-values.yaml": "replicas: 2\n",
+	})
+
+	c, err := LearnConventions(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Manifests != 3 {
+		t.Errorf("expected 3 manifests, got %d", c.Manifests)
+	}
+	if !c.NamespaceDirs || c.NamespaceParent != "apps" {
+		t.Errorf("expected namespace directories below apps, got %+v", c)
+	}
+	if c.FilePattern != "{kind}-{name}{ext}" || c.Extension != ".yaml" {
+		t.Errorf("unexpected file pattern %q %q", c.FilePattern, c.Extension)
+	}
+	if !c.Kustomize {
+		t.Error("expected kustomization usage")
+	}
+	if len(c.CommonLabels) != 1 || c.CommonLabels["app.kubernetes.io/managed-by"] != "flux" {
+		t.Errorf("expected only the shared label, got %v", c.CommonLabels)
+	}
+
+	text := c.PromptText()
+	for _, want := range []string{"apps/<namespace>/", "{kind}-{name}{ext}", "app.kubernetes.io/managed-by: flux", "kustomization.yaml"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("prompt text should mention %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestLearnConventionsEmpty(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"values.yaml": "replicas: 1\n"})
+	c, err := LearnConventions(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Empty() || c.PromptText() != "" {
+		t.Errorf("nothing should be learned from a tree without manifests, got %+v", c)
+	}
+	if out, renames := c.ApplyConventions("# file: a.yaml\n" + manifest("Service", "x", "y")); renames != nil || !strings.HasPrefix(out, "# file: a.yaml") {
+		t.Error("empty conventions should not rename files")
+	}
+}
+
+func TestApplyConventions(t *testing.T) {
+	c := &Conventions{NamespaceDirs: true, NamespaceParent: "apps", FilePattern: "{kind}-{name}{ext}", Extension: ".yaml"}
+	output := RenderGeneratedFiles([]GeneratedFile{
+		{Name: "runner.yaml", Content: manifest("Deployment", "dagger", "runners")},
+		{Name: "notes/values.yaml", Content: "replicas: 1\n"},
+		{Name: "README.md", Content: "# readme\n"},
+		{Name: "cluster-wide.yaml", Content: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: runners\n"},
+	})
+
+	out, renames := c.ApplyConventions(output)
+	if len(renames) != 2 {
+		t.Fatalf("expected 2 renames, got %+v", renames)
+	}
+	if renames[0] != (FileRename{From: "runner.yaml", To: "apps/runners/deployment-dagger.yaml"}) {
+		t.Errorf("unexpected rename %+v", renames[0])
+	}
+	if renames[1] != (FileRename{From: "cluster-wide.yaml", To: "namespace-runners.yaml"}) {
+		t.Errorf("files without namespace keep their directory, got %+v", renames[1])
+	}
+
+	var names []string
+	for _, f := range ParseGeneratedFiles(out) {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "apps/runners/deployment-dagger.yaml,notes/values.yaml,README.md,namespace-runners.yaml" {
+		t.Errorf("unexpected files %v", names)
+	}
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	if got := UnifiedDiff("a", "b", "same\n", "same\n", 3); got != "" {
+		t.Errorf("expected empty diff for equal content, got %q", got)
+	}
+
+	oldContent := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	newContent := "a\nb\nc\nD\ne\nf\ng\nh\ni\n"
+
+	got := UnifiedDiff("a/x.yaml", "b/x.yaml", oldContent, newContent, 1)
+	expected := `--- a/x.yaml
++++ b/x.yaml
+@@ -3,3 +3,3 @@
+ c
+-d
++D
+ e
+@@ -8,1 +8,2 @@
+ h
++i
+`
+	if got != expected {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestUnifiedDiffAddedFile(t *testing.T) {
+	got := UnifiedDiff("/dev/null", "b/new.yaml", "", "x: 1\ny: 2\n", 3)
+	if !strings.Contains(got, "@@ -0,0 +1,2 @@") || !strings.Contains(got, "+x: 1") {
+		t.Errorf("unexpected diff for added file:\n%s", got)
+	}
+}
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExampleSidecarSuffix is appended to an example file name to get the file with
+// its metadata, e.g. runner.yaml.k2n.yaml.
+const ExampleSidecarSuffix = ".k2n.yaml"
+
+// ExampleMeta describes what an example is for. It is declared in a comment
+// block at the top of the example:
+//
+//	# k2n:
+//	#   usecases: [github-runner]
+//	#   tags: [helm, crossplane]
+//	#   kind: GithubRunner
+//	#   description: Runner claim for a Helm chart repository
+//	#   priority: 10
+//
+// or in a sidecar file next to it with the same fields.
+type ExampleMeta struct {
+	Usecases    []string `json:"usecases,omitempty" yaml:"usecases,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Kind        string   `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Priority    int      `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Example is a loaded example file.
+type Example struct {
+	Path string
+	// Content is the file content without the metadata block.
+	Content string
+	Meta    ExampleMeta
+	// HasMeta is set if the example declares metadata.
+	HasMeta bool
+	// Size is the size of the file in bytes.
+	Size int64
+	// Hash is the hex sha256 of Content, used to drop duplicates.
+	Hash string
+}
+
+// IsExampleSidecar reports whether path is a metadata sidecar file.
+func IsExampleSidecar(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ExampleSidecarSuffix)
+}
+
+// LoadExample reads an example file with its metadata. A sidecar file takes
+// precedence over a metadata block in the file.
+func LoadExample(path string) (Example, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Example{}, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return parseExample(path, data)
+}
+
+// parseExample splits the metadata off the content of the example at path and
+// reads its sidecar file.
+func parseExample(path string, data []byte) (Example, error) {
+	meta, content, ok, err := ParseExampleFrontmatter(string(data))
+	if err != nil {
+		return Example{}, fmt.Errorf("invalid k2n metadata in %s: %w", path, err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	ex := Example{
+		Path:    path,
+		Content: content,
+		Meta:    meta,
+		HasMeta: ok,
+		Size:    int64(len(data)),
+		Hash:    hex.EncodeToString(sum[:]),
+	}
+
+	sidecar, err := os.ReadFile(path + ExampleSidecarSuffix)
+	if err == nil {
+		var meta ExampleMeta
+		if err := yaml.Unmarshal(sidecar, &meta); err != nil {
+			return Example{}, fmt.Errorf("invalid k2n metadata in %s: %w", path+ExampleSidecarSuffix, err)
+		}
+		ex.Meta, ex.HasMeta = meta, true
+	} else if !os.IsNotExist(err) {
+		return Example{}, fmt.Errorf("failed to read file %s: %w", path+ExampleSidecarSuffix, err)
+	}
+	return ex, nil
+}
+
+// rawExample is the file at path with its content unchanged and no metadata.
+func rawExample(path string, data []byte) Example {
+	sum := sha256.Sum256(data)
+	return Example{Path: path, Content: string(data), Size: int64(len(data)), Hash: hex.EncodeToString(sum[:])}
+}
+
+// ParseExampleFrontmatter splits a leading "# k2n:" (or "// k2n:") comment block
+// off content. The block ends at the first line that is not a comment or not
+// indented below k2n. It returns the remaining content and whether a block was found.
+func ParseExampleFrontmatter(content string) (ExampleMeta, string, bool, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) == 0 {
+		return ExampleMeta{}, content, false, nil
+	}
+
+	var prefix string
+	first := strings.TrimSpace(lines[0])
+	for _, p := range []string{"#", "//"} {
+		if strings.HasPrefix(first, p) && strings.TrimSpace(strings.TrimPrefix(first, p)) == "k2n:" {
+			prefix = p
+			break
+		}
+	}
+	if prefix == "" {
+		return ExampleMeta{}, content, false, nil
+	}
+
+	block := []string{"k2n:\n"}
+	end := 1
+	for ; end < len(lines); end++ {
+		line := strings.TrimRight(lines[end], "\r\n")
+		if !strings.HasPrefix(line, prefix) {
+			break
+		}
+		body := strings.TrimPrefix(strings.TrimPrefix(line, prefix), " ")
+		if strings.TrimSpace(body) != "" && !strings.HasPrefix(body, " ") {
+			break
+		}
+		block = append(block, body+"\n")
+	}
+
+	var doc struct {
+		K2N ExampleMeta `yaml:"k2n"`
+	}
+	if err := yaml.Unmarshal([]byte(strings.Join(block, "")), &doc); err != nil {
+		return ExampleMeta{}, content, false, err
+	}
+	return doc.K2N, strings.Join(lines[end:], ""), true, nil
+}
+
+// Matches reports whether the example is declared for usecase and carries one
+// of tags. An empty usecase or empty tags match everything.
+func (e Example) Matches(usecase string, tags []string) bool {
+	if usecase != "" && !containsFold(e.Meta.Usecases, usecase) && !strings.EqualFold(e.Meta.Kind, usecase) {
+		return false
+	}
+	if len(tags) == 0 {
+		return true
+	}
+	for _, t := range tags {
+		if containsFold(e.Meta.Tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectExamples picks the examples matching usecase and tags, ordered by
+// priority. Selection only applies if some example declares metadata; if no
+// example matches, all are returned and ok is false.
+func SelectExamples(examples []Example, usecase string, tags []string) (selected []Example, ok bool) {
+	if usecase == "" && len(tags) == 0 {
+		return examples, true
+	}
+	withMeta := false
+	for _, e := range examples {
+		if e.HasMeta {
+			withMeta = true
+		}
+		if e.HasMeta && e.Matches(usecase, tags) {
+			selected = append(selected, e)
+		}
+	}
+	if !withMeta {
+		return examples, true
+	}
+	if len(selected) == 0 {
+		return examples, false
+	}
+	sort.SliceStable(selected, func(a, b int) bool {
+		return selected[a].Meta.Priority > selected[b].Meta.Priority
+	})
+	return selected, true
+}
+
+// promptHeader names the example in the prompt: its file name and description.
+func (e Example) promptHeader(n int) string {
+	header := fmt.Sprintf("Example %d", n)
+	if e.Path != "" {
+		header += " (" + filepath.Base(e.Path) + ")"
+	}
+	if e.Meta.Description != "" {
+		header += ": " + e.Meta.Description
+	} else {
+		header += ":"
+	}
+	return header
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseExampleFrontmatter(t *testing.T) {
+	content := `# k2n:
+#   usecases: [github-runner]
+#   tags: [helm]
+#   description: Runner for helm
+#   priority: 3
+# a normal comment
+---
+kind: GithubRunner
+`
+	meta, rest, ok, err := ParseExampleFrontmatter(content)
+	if err != nil || !ok {
+		t.Fatalf("expected metadata, got ok=%v err=%v", ok, err)
+	}
+	if meta.Usecases[0] != "github-runner" || meta.Tags[0] != "helm" || meta.Description != "Runner for helm" || meta.Priority != 3 {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+	if rest != "# a normal comment\n---\nkind: GithubRunner\n" {
+		t.Errorf("unexpected remaining content %q", rest)
+	}
+
+	meta, rest, ok, err = ParseExampleFrontmatter("// k2n:\n//   kind: module\nresource \"x\" \"y\" {}\n")
+	if err != nil || !ok || meta.Kind != "module" || rest != "resource \"x\" \"y\" {}\n" {
+		t.Errorf("unexpected // frontmatter result %+v %q %v %v", meta, rest, ok, err)
+	}
+
+	plain := "# just a comment\nkind: A\n"
+	if _, rest, ok, _ := ParseExampleFrontmatter(plain); ok || rest != plain {
+		t.Error("content without metadata should be unchanged")
+	}
+
+	if _, _, _, err := ParseExampleFrontmatter("# k2n:\n#   priority: high\n"); err == nil {
+		t.Error("expected error for invalid metadata")
+	}
+}
+
+func TestLoadExampleSidecar(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.yaml")
+	if err := os.WriteFile(path, []byte("# k2n:\n#   description: inline\nprojectName: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+ExampleSidecarSuffix, []byte("description: from sidecar\nusecases: [git]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ex, err := LoadExample(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ex.HasMeta || ex.Meta.Description != "from sidecar" || ex.Content != "projectName: x\n" {
+		t.Errorf("unexpected example %+v", ex)
+	}
+
+	files, err := ListFiles(dir, []string{".yaml"})
+	if err != nil || len(files) != 1 {
+		t.Errorf("sidecar files should not be listed, got %v", files)
+	}
+}
+
+func TestSelectExamples(t *testing.T) {
+	examples := []Example{
+		{Path: "a.yaml", HasMeta: true, Meta: ExampleMeta{Usecases: []string{"github-runner"}, Tags: []string{"helm"}, Priority: 1}},
+		{Path: "b.yaml", HasMeta: true, Meta: ExampleMeta{Usecases: []string{"GitHub-Runner"}, Priority: 5}},
+		{Path: "c.yaml", HasMeta: true, Meta: ExampleMeta{Kind: "Terraform"}},
+		{Path: "d.yaml"},
+	}
+
+	selected, ok := SelectExamples(examples, "github-runner", nil)
+	if !ok || len(selected) != 2 || selected[0].Path != "b.yaml" {
+		t.Errorf("expected b and a ordered by priority, got %+v", selected)
+	}
+	if selected, _ := SelectExamples(examples, "terraform", nil); len(selected) != 1 || selected[0].Path != "c.yaml" {
+		t.Errorf("kind should match the usecase, got %+v", selected)
+	}
+	if selected, _ := SelectExamples(examples, "", []string{"helm"}); len(selected) != 1 || selected[0].Path != "a.yaml" {
+		t.Errorf("expected selection by tag, got %+v", selected)
+	}
+	if selected, ok := SelectExamples(examples, "ansible", nil); ok || len(selected) != 4 {
+		t.Errorf("without a match all examples should be used, got %d, ok=%v", len(selected), ok)
+	}
+	if selected, ok := SelectExamples([]Example{{Path: "x"}}, "github-runner", nil); !ok || len(selected) != 1 {
+		t.Error("examples without any metadata should all be used")
+	}
+}
+
+func TestBuildPromptFromExamples(t *testing.T) {
+	prompt := BuildPromptFromExamples([]Example{
+		{Path: "dir/runner.yaml", Content: "kind: GithubRunner", Meta: ExampleMeta{Description: "Runner claim"}},
+		{Content: "kind: Other"},
+	}, nil, nil, nil, "", "x")
+
+	if !strings.Contains(prompt, "Example 1 (runner.yaml): Runner claim\nkind: GithubRunner") {
+		t.Errorf("example should be introduced with file name and description:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "Example 2:\nkind: Other") {
+		t.Errorf("anonymous example expected:\n%s", prompt)
+	}
+}
+
+func TestLoadInputsSelectsExamples(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"runner.yaml": "# k2n:\n#   usecases: [github-runner]\nkind: GithubRunner\n",
+		"other.yaml":  "# k2n:\n#   usecases: [ansible]\nkind: Playbook\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	extra := filepath.Join(t.TempDir(), "extra.yaml")
+	if err := os.WriteFile(extra, []byte("kind: Extra\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := LoadInputs(InputConfig{
+		ExamplesDirs:   []string{dir},
+		ExampleFiles:   []string{extra},
+		ExampleFileExt: []string{".yaml"},
+		Usecase:        "github-runner",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(in.Examples) != 2 || in.Examples[0].Content != "kind: GithubRunner\n" || in.Examples[1].Path != extra {
+		t.Errorf("unexpected examples %+v", in.Examples)
+	}
+	if in.SkippedExamples != 1 || len(in.ExamplePaths) != 2 {
+		t.Errorf("expected one skipped example, got %d (%v)", in.SkippedExamples, in.ExamplePaths)
+	}
+}
@@ -2,10 +2,16 @@
 package internal
 
 import (
+	"bytes"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
 )
 
 // LoadCodeExamples loads all files from the given directory and returns them as strings.
@@ -67,23 +73,19 @@ func FilterFilesByExtension(files []string, allowedExts []string) []string {
 	return filtered
 }
 
-// LoadCodeExamplesWithExtensions loads files from a directory that match the allowed extensions.
+// LoadCodeExamplesWithExtensions loads files from a directory that match the
+// allowed extensions. .k2nignore files, version control directories and binary
+// files are skipped.
 func LoadCodeExamplesWithExtensions(dir string, allowedExts []string) ([]string, error) {
+	loaded, err := NewExampleLoader(ExampleFilter{Extensions: allowedExts}).LoadDir(dir)
+	if err != nil {
+		return nil, err
+	}
 	var examples []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && hasAllowedExtension(path, allowedExts) {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			examples = append(examples, string(content))
-		}
-		return nil
-	})
-	return examples, err
+	for _, ex := range loaded {
+		examples = append(examples, ex.Content)
+	}
+	return examples, nil
 }
 
 // LoadExampleFilesWithExtensions loads files from provided paths that match the allowed extensions.
@@ -133,3 +135,295 @@ func SplitAndTrimExts(input string) []string {
 	}
 	return exts
 }
+
+// ListFiles returns the paths of all files below dir that match the allowed
+// extensions. With no extensions every file is listed. Example metadata
+// sidecar files are never listed.
+func ListFiles(dir string, allowedExts []string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && (len(allowedExts) == 0 || hasAllowedExtension(path, allowedExts)) && !IsExampleSidecar(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// ExampleFilter restricts which files of an examples directory are loaded.
+// Include and Exclude are doublestar patterns relative to the directory, e.g.
+// "claims/**/*.yaml". Zero sizes mean no limit.
+type ExampleFilter struct {
+	Extensions   []string
+	Include      []string
+	Exclude      []string
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+// DefaultExampleMaxSize is the largest example file loaded unless configured
+// otherwise.
+const DefaultExampleMaxSize = "1MB"
+
+// SkippedFile is an example file that was not loaded and why.
+type SkippedFile struct {
+	Path   string `json:"path" yaml:"path"`
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+// binarySniffLen is how much of a file is checked for NUL bytes, like git does.
+const binarySniffLen = 8000
+
+// IsBinary reports whether content looks like a binary file.
+func IsBinary(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// ParseByteSize parses sizes like 512KB, 1MiB or 2000. An empty string is 0.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	return int64(n), nil
+}
+
+// ExampleLoader loads example files through an ExampleFilter. Files are read
+// and hashed by a bounded pool of workers while the directory is walked, and
+// returned in walk order so prompts are stable between runs. The total size
+// limit applies to all files loaded by the same loader.
+type ExampleLoader struct {
+	Filter ExampleFilter
+	// Raw keeps the content as it is, without reading k2n metadata from it.
+	Raw bool
+	// Workers is the number of files read at the same time, by default
+	// GOMAXPROCS.
+	Workers int
+	// Skipped lists the files that were left out, in the order they were seen.
+	Skipped []SkippedFile
+
+	total int64
+}
+
+// NewExampleLoader returns a loader for filter.
+func NewExampleLoader(filter ExampleFilter) *ExampleLoader {
+	return &ExampleLoader{Filter: filter}
+}
+
+// exampleEntry is a file seen while walking an examples directory. Workers
+// fill in the example, entries are accepted in the order they were seen.
+type exampleEntry struct {
+	path     string
+	dirEntry fs.DirEntry
+	size     int64
+	skip     string
+	example  Example
+	err      error
+}
+
+// LoadDir walks dir and loads every file that passes the filter. Version
+// control directories are never entered, and .k2nignore files anywhere in the
+// tree exclude paths like a .gitignore.
+func (l *ExampleLoader) LoadDir(dir string) ([]Example, error) {
+	workers := l.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		entries []*exampleEntry
+		ignore  ignoreMatcher
+		wg      sync.WaitGroup
+	)
+	// The walk only filters paths; stat, read and hash happen in the workers.
+	// The buffer keeps the walk from waiting for a free worker on every file.
+	pending := make(chan *exampleEntry, workers*exampleQueuePerWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range pending {
+				l.load(e)
+			}
+		}()
+	}
+	skip := func(p, reason string) {
+		entries = append(entries, &exampleEntry{path: p, skip: reason})
+	}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel == "." {
+				rel = ""
+			} else if d.Name() == ".git" {
+				return filepath.SkipDir
+			} else if ignored, source := ignore.match(rel, true); ignored {
+				skip(p, "ignored by "+source)
+				return filepath.SkipDir
+			} else if pattern, ok := matchAny(l.Filter.Exclude, rel); ok {
+				skip(p, "matches exclude pattern "+pattern)
+				return filepath.SkipDir
+			}
+			ignoreFile := filepath.Join(p, IgnoreFileName)
+			if content, err := os.ReadFile(ignoreFile); err == nil {
+				ignore.add(parseIgnoreFile(rel, ignoreFile, string(content)))
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read %s: %w", ignoreFile, err)
+			}
+			return nil
+		}
+
+		if d.Name() == IgnoreFileName || IsExampleSidecar(p) {
+			return nil
+		}
+		if len(l.Filter.Extensions) > 0 && !hasAllowedExtension(p, l.Filter.Extensions) {
+			return nil
+		}
+		if len(l.Filter.Include) > 0 {
+			if _, ok := matchAny(l.Filter.Include, rel); !ok {
+				return nil
+			}
+		}
+		if ignored, source := ignore.match(rel, false); ignored {
+			skip(p, "ignored by "+source)
+			return nil
+		}
+		if pattern, ok := matchAny(l.Filter.Exclude, rel); ok {
+			skip(p, "matches exclude pattern "+pattern)
+			return nil
+		}
+
+		e := &exampleEntry{path: p, dirEntry: d}
+		entries = append(entries, e)
+		pending <- e
+		return nil
+	})
+	close(pending)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	var examples []Example
+	for _, e := range entries {
+		ex, ok, err := l.accept(e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			examples = append(examples, ex)
+		}
+	}
+	return examples, nil
+}
+
+// exampleQueuePerWorker is how many files the walk may queue per worker.
+const exampleQueuePerWorker = 64
+
+// load reads the size of a walked entry and, within the size limit, its file.
+// It runs in the workers and only reads the filter of the loader.
+func (l *ExampleLoader) load(e *exampleEntry) {
+	info, err := e.dirEntry.Info()
+	if err != nil {
+		e.err = err
+		return
+	}
+	e.size = info.Size()
+	if e.skip = l.checkSize(e.size); e.skip == "" {
+		e.read(l.Raw)
+	}
+}
+
+// LoadFile loads a single example if it is within the size limits and not
+// binary. Patterns and extensions are not checked.
+func (l *ExampleLoader) LoadFile(p string) (Example, bool, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return Example{}, false, fmt.Errorf("failed to read file %s: %w", p, err)
+	}
+	e := &exampleEntry{path: p, size: info.Size()}
+	if e.skip = l.checkSize(e.size); e.skip == "" {
+		e.read(l.Raw)
+	}
+	return l.accept(e)
+}
+
+// checkSize returns why a file of size bytes is too large, if it is.
+func (l *ExampleLoader) checkSize(size int64) string {
+	if l.Filter.MaxFileSize > 0 && size > l.Filter.MaxFileSize {
+		return fmt.Sprintf("%s exceeds the maximum file size of %s", formatBytes(size), formatBytes(l.Filter.MaxFileSize))
+	}
+	return ""
+}
+
+// accept applies the total size limit to a read entry and records skipped
+// files. It runs in walk order, so the same files are kept on every run.
+func (l *ExampleLoader) accept(e *exampleEntry) (Example, bool, error) {
+	if e.err != nil {
+		return Example{}, false, e.err
+	}
+	if e.skip == "" && l.Filter.MaxTotalSize > 0 && l.total+e.example.Size > l.Filter.MaxTotalSize {
+		e.skip = fmt.Sprintf("the total size of examples would exceed %s", formatBytes(l.Filter.MaxTotalSize))
+	}
+	if e.skip != "" {
+		l.Skipped = append(l.Skipped, SkippedFile{Path: e.path, Reason: e.skip})
+		return Example{}, false, nil
+	}
+	l.total += e.example.Size
+	return e.example, true, nil
+}
+
+// read loads the file of the entry and, unless raw, parses its metadata.
+func (e *exampleEntry) read(raw bool) {
+	content, err := os.ReadFile(e.path)
+	if err != nil {
+		e.err = fmt.Errorf("failed to read file %s: %w", e.path, err)
+		return
+	}
+	if IsBinary(content) {
+		e.skip = "binary file"
+		return
+	}
+	if raw {
+		e.example = rawExample(e.path, content)
+		return
+	}
+	e.example, e.err = parseExample(e.path, content)
+}
+
+// DeduplicateExamples removes examples whose content hash was seen before,
+// keeping the first.
+func DeduplicateExamples(examples []Example) []Example {
+	seen := make(map[string]struct{})
+	var result []Example
+	for _, ex := range examples {
+		if _, exists := seen[ex.Hash]; !exists {
+			seen[ex.Hash] = struct{}{}
+			result = append(result, ex)
+		}
+	}
+	return result
+}
+
+func formatBytes(n int64) string {
+	return humanize.Bytes(uint64(n))
+}
@@ -1,9 +1,14 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -151,3 +156,209 @@ func TestFilterFilesByExtension(t *testing.T) {
 		t.Errorf("Expected %v, but got %v", expected, result)
 	}
 }
+
+func TestExampleLoader(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".k2nignore", "generated/\n*.tmp.yaml\n")
+	write("claims/a.yaml", "kind: A\n")
+	write("claims/b.yaml", "kind: B\n")
+	write("claims/c.tmp.yaml", "kind: C\n")
+	write("claims/big.yaml", "kind: Big\n"+strings.Repeat("# padding\n", 20))
+	write("claims/logo.yaml", "kind: \x00binary")
+	write("generated/x.yaml", "kind: X\n")
+	write("charts/nginx/values.yaml", "kind: Chart\n")
+	write("claims/.k2nignore", "b.yaml\n")
+	write(".git/config.yaml", "kind: Git\n")
+	write("notes.md", "notes")
+
+	loader := NewExampleLoader(ExampleFilter{
+		Extensions:  []string{".yaml"},
+		Exclude:     []string{"charts/**"},
+		MaxFileSize: 100,
+	})
+	examples, err := loader.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 1 || examples[0].Content != "kind: A\n" {
+		t.Fatalf("expected only claims/a.yaml, got %+v", examples)
+	}
+
+	reasons := map[string]string{}
+	for _, s := range loader.Skipped {
+		rel, _ := filepath.Rel(dir, s.Path)
+		reasons[filepath.ToSlash(rel)] = s.Reason
+	}
+	want := map[string]string{
+		"claims/b.yaml":     "ignored by",
+		"claims/c.tmp.yaml": "ignored by",
+		"claims/big.yaml":   "maximum file size",
+		"claims/logo.yaml":  "binary",
+		"generated":         "ignored by",
+		"charts":            "exclude pattern charts/**",
+	}
+	for path, reason := range want {
+		if !strings.Contains(reasons[path], reason) {
+			t.Errorf("expected %s to be skipped with %q, got %q", path, reason, reasons[path])
+		}
+	}
+	if len(reasons) != len(want) {
+		t.Errorf("unexpected skipped files %v", reasons)
+	}
+
+	include := NewExampleLoader(ExampleFilter{Include: []string{"charts/**/*.yaml"}})
+	examples, err = include.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 1 || examples[0].Content != "kind: Chart\n" {
+		t.Errorf("expected only the chart values, got %+v", examples)
+	}
+}
+
+func TestExampleLoaderTotalSize(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.yaml", "b.yaml", "c.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("kind: Example\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := NewExampleLoader(ExampleFilter{MaxTotalSize: 30})
+	examples, err := loader.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 2 {
+		t.Errorf("expected 2 examples within 30 bytes, got %d", len(examples))
+	}
+	if len(loader.Skipped) != 1 || filepath.Base(loader.Skipped[0].Path) != "c.yaml" {
+		t.Errorf("expected c.yaml to be skipped, got %+v", loader.Skipped)
+	}
+
+	// The limit is shared by everything the loader loads.
+	if _, ok, err := loader.LoadFile(filepath.Join(dir, "a.yaml")); ok || err != nil {
+		t.Errorf("expected explicit file to exceed the total, got %v, %v", ok, err)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for in, want := range map[string]int64{"": 0, "0": 0, "2000": 2000, "1KB": 1000, "1MiB": 1 << 20} {
+		if got, err := ParseByteSize(in); err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := ParseByteSize("lots"); err == nil {
+		t.Error("expected error for invalid size")
+	}
+}
+
+// writeExampleTree creates dirs×files small YAML examples below root.
+func writeExampleTree(tb testing.TB, root string, dirs, files int) {
+	tb.Helper()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("team-%02d", d))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			content := fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app-%02d-%03d\ndata:\n  team: team-%02d\n", d, f, d)
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("app-%03d.yaml", f)), []byte(content), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestExampleLoaderOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeExampleTree(t, dir, 5, 40)
+
+	var first []string
+	for run := 0; run < 5; run++ {
+		examples, err := (&ExampleLoader{Workers: 8}).LoadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, ex := range examples {
+			paths = append(paths, ex.Path)
+		}
+		if run == 0 {
+			first = paths
+			if !sort.StringsAreSorted(paths) || len(paths) != 200 {
+				t.Fatalf("expected 200 examples in lexical order, got %d", len(paths))
+			}
+			continue
+		}
+		if !reflect.DeepEqual(paths, first) {
+			t.Fatalf("run %d returned a different order", run)
+		}
+	}
+}
+
+func TestExampleHashAndDedup(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.yaml": "kind: A\n",
+		"b.yaml": "# k2n:\n#   tags: [x]\nkind: A\n",
+		"c.yaml": "kind: C\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	examples, err := NewExampleLoader(ExampleFilter{}).LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 3 {
+		t.Fatalf("expected 3 examples, got %d", len(examples))
+	}
+	if examples[0].Size != 8 || examples[1].Size != 29 {
+		t.Errorf("expected file sizes 8 and 29, got %d and %d", examples[0].Size, examples[1].Size)
+	}
+	sum := sha256.Sum256([]byte("kind: A\n"))
+	if examples[0].Hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected hash %s", examples[0].Hash)
+	}
+	if examples[1].Hash != examples[0].Hash {
+		t.Error("examples differing only in metadata should have the same hash")
+	}
+
+	deduped := DeduplicateExamples(examples)
+	if len(deduped) != 2 || deduped[0].Path != examples[0].Path || deduped[1].Path != examples[2].Path {
+		t.Errorf("expected a.yaml and c.yaml, got %+v", deduped)
+	}
+}
+
+func BenchmarkExampleLoader(b *testing.B) {
+	dir := b.TempDir()
+	writeExampleTree(b, dir, 50, 100)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				loader := &ExampleLoader{Filter: ExampleFilter{Extensions: []string{".yaml"}}, Workers: workers}
+				examples, err := loader.LoadDir(dir)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(DeduplicateExamples(examples)) != 5000 {
+					b.Fatal("unexpected number of examples")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GitInfo is the branch, commit and pull request metadata the model returns as
+// a document with projectName, branchName, prTitle and description, see
+// _examples/examples/git-information.yaml.
+type GitInfo struct {
+	ProjectName string `json:"projectName,omitempty" yaml:"projectName,omitempty"`
+	BranchName  string `json:"branchName" yaml:"branchName"`
+	PRTitle     string `json:"prTitle" yaml:"prTitle"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// File is the generated file the metadata was read from.
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+// GitCommit is the result of committing generated files.
+type GitCommit struct {
+	Info GitInfo `json:"info" yaml:"info"`
+	Repo string  `json:"repo,omitempty" yaml:"repo,omitempty"`
+	// Branch, Commit and Files are empty if the generated files changed
+	// nothing.
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Commit string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	// Files are the committed paths, relative to Repo.
+	Files    []string `json:"files,omitempty" yaml:"files,omitempty"`
+	BodyFile string   `json:"prBodyFile,omitempty" yaml:"prBodyFile,omitempty"`
+}
+
+// parseGitInfo reads a file consisting of a single metadata document. A
+// Kubernetes manifest or a document without branchName and prTitle is not
+// metadata.
+func parseGitInfo(f GeneratedFile) (*GitInfo, bool) {
+	if !isYAMLPath(f.Name) {
+		return nil, false
+	}
+	docs, err := decodeYAMLDocuments(f.Content)
+	if err != nil || len(docs) != 1 || docs[0].Kind != yaml.MappingNode {
+		return nil, false
+	}
+	var doc struct {
+		GitInfo `yaml:",inline"`
+		Kind    string `yaml:"kind"`
+	}
+	if err := docs[0].Decode(&doc); err != nil || doc.Kind != "" {
+		return nil, false
+	}
+	if strings.TrimSpace(doc.BranchName) == "" || strings.TrimSpace(doc.PRTitle) == "" {
+		return nil, false
+	}
+	info := doc.GitInfo
+	info.BranchName = strings.TrimSpace(info.BranchName)
+	info.PRTitle = strings.TrimSpace(info.PRTitle)
+	info.Description = strings.TrimSpace(info.Description)
+	info.File = f.Name
+	return &info, true
+}
+
+// ExtractGitInfo finds the git metadata document in the generated output and
+// returns it with the output without that file. The output is returned
+// unchanged if there is no metadata.
+func ExtractGitInfo(output string) (*GitInfo, string) {
+	files := ParseGeneratedFiles(output)
+	for i, f := range files {
+		info, ok := parseGitInfo(f)
+		if !ok {
+			continue
+		}
+		rest := append(append([]GeneratedFile{}, files[:i]...), files[i+1:]...)
+		if len(rest) == 0 {
+			return info, ""
+		}
+		return info, RenderGeneratedFiles(rest)
+	}
+	return nil, output
+}
+
+var invalidBranchChars = regexp.MustCompile(`[^A-Za-z0-9._/-]+`)
+
+// DefaultGitInfo is used when the output has no metadata document.
+func DefaultGitInfo(now time.Time) *GitInfo {
+	return &GitInfo{
+		BranchName: "k2n/" + now.Format("20060102-150405"),
+		PRTitle:    "chore: add generated files",
+	}
+}
+
+// sanitizeBranchName turns a model supplied name into a valid branch name.
+func sanitizeBranchName(name string) string {
+	name = invalidBranchChars.ReplaceAllString(strings.TrimSpace(name), "-")
+	for strings.Contains(name, "..") || strings.Contains(name, "//") {
+		name = strings.NewReplacer("..", ".", "//", "/").Replace(name)
+	}
+	return strings.Trim(name, "/.-")
+}
+
+// PRBody renders the pull request description for the committed files.
+func (c *GitCommit) PRBody() string {
+	var b strings.Builder
+	b.WriteString("# " + c.Info.PRTitle + "\n\n")
+	if c.Info.Description != "" {
+		b.WriteString(c.Info.Description + "\n\n")
+	}
+	b.WriteString("## Files\n\n")
+	for _, f := range c.Files {
+		b.WriteString("- `" + f + "`\n")
+	}
+	return b.String()
+}
+
+// CheckGitCommit verifies that the branch of info can be created in the git
+// repository containing dir and that its index has no staged changes. Run it
+// before writing files, so a failing commit leaves the working tree alone. It
+// returns the repository root and the sanitized branch name.
+func CheckGitCommit(dir string, info *GitInfo) (string, string, error) {
+	repo, err := GitRepoRoot(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	branch := sanitizeBranchName(info.BranchName)
+	if branch == "" {
+		return "", "", fmt.Errorf("invalid branch name %q", info.BranchName)
+	}
+	if _, err := runGit(repo, "check-ref-format", "--branch", branch); err != nil {
+		return "", "", fmt.Errorf("invalid branch name %q: %w", branch, err)
+	}
+	if _, err := runGit(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		return "", "", fmt.Errorf("branch %s already exists", branch)
+	}
+	if staged, err := runGit(repo, "diff", "--cached", "--name-only"); err != nil {
+		return "", "", err
+	} else if len(strings.TrimSpace(string(staged))) > 0 {
+		return "", "", fmt.Errorf("the index of %s has staged changes, commit or unstage them first", repo)
+	}
+	return repo, branch, nil
+}
+
+// CommitGeneratedFiles creates the branch of info in the git repository
+// containing dir, starting at the current HEAD, and commits paths with the PR
+// title as subject and the description as body. Other changes in the working
+// tree are left alone and nothing is pushed. The PR body is written to
+// bodyFile, by default k2n-pr-body.md in the git directory. If the files do
+// not change anything, no branch is created and the result has no Branch or
+// Commit.
+func CommitGeneratedFiles(dir string, info *GitInfo, paths []string, bodyFile string) (*GitCommit, error) {
+	repo, branch, err := CheckGitCommit(dir, info)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GitCommit{Info: *info, Repo: repo, Branch: branch}
+	for _, p := range paths {
+		rel, err := repoRelative(repo, p)
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, rel)
+	}
+	unchanged := &GitCommit{Info: *info, Repo: repo}
+	if len(result.Files) == 0 {
+		return unchanged, nil
+	}
+
+	// The index was clean, so nothing staged means the files are unchanged.
+	if _, err := runGit(repo, append([]string{"add", "--"}, result.Files...)...); err != nil {
+		return nil, fmt.Errorf("failed to stage files: %w", err)
+	}
+	if _, err := runGit(repo, "diff", "--cached", "--quiet"); err == nil {
+		return unchanged, nil
+	}
+
+	// An unborn branch cannot be checked out with -b, switch it instead.
+	checkout := []string{"checkout", "-b", branch}
+	if _, err := runGit(repo, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		checkout = []string{"symbolic-ref", "HEAD", "refs/heads/" + branch}
+	}
+	if _, err := runGit(repo, checkout...); err != nil {
+		return nil, fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+	message := []string{"commit", "--quiet", "-m", info.PRTitle}
+	if info.Description != "" {
+		message = append(message, "-m", info.Description)
+	}
+	if _, err := runGit(repo, message...); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	out, err := runGit(repo, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	result.Commit = strings.TrimSpace(string(out))
+
+	if bodyFile == "" {
+		out, err := runGit(repo, "rev-parse", "--absolute-git-dir")
+		if err != nil {
+			return nil, err
+		}
+		bodyFile = filepath.Join(strings.TrimSpace(string(out)), "k2n-pr-body.md")
+	}
+	if err := os.WriteFile(bodyFile, []byte(result.PRBody()), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write PR body: %w", err)
+	}
+	result.BodyFile = bodyFile
+	return result, nil
+}
+
+// GitRepoRoot returns the top level directory of the git repository containing
+// path. The path itself does not need to exist yet.
+func GitRepoRoot(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not in a git repository: %w", path, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// repoRelative returns p relative to the repository root, resolving symlinks
+// on both sides so temporary directories compare equal.
+func repoRelative(repo, p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	root := repo
+	if resolved, err := filepath.EvalSymlinks(repo); err == nil {
+		root = resolved
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the repository %s", p, repo)
+	}
+	return filepath.ToSlash(rel), nil
+}
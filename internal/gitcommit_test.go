@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const gitInfoOutput = `# file: claims/runner.yaml
+kind: GithubRunner
+metadata:
+  name: runner
+# file: git-information.yaml
+projectName: ansible-in-cluster
+branchName: feat/add-github-runner
+prTitle: "feat: add GithubRunner claim"
+description: |
+  Adds a GithubRunner claim.
+  The runner uses the default image.
+`
+
+func TestExtractGitInfo(t *testing.T) {
+	info, rest := ExtractGitInfo(gitInfoOutput)
+	if info == nil {
+		t.Fatal("metadata not recognized")
+	}
+	want := GitInfo{
+		ProjectName: "ansible-in-cluster",
+		BranchName:  "feat/add-github-runner",
+		PRTitle:     "feat: add GithubRunner claim",
+		Description: "Adds a GithubRunner claim.\nThe runner uses the default image.",
+		File:        "git-information.yaml",
+	}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+	files := ParseGeneratedFiles(rest)
+	if len(files) != 1 || files[0].Name != "claims/runner.yaml" {
+		t.Errorf("metadata file not removed: %+v", files)
+	}
+
+	for name, output := range map[string]string{
+		"no metadata":   "# file: a.yaml\nkind: A\n",
+		"manifest":      "# file: a.yaml\nkind: A\nbranchName: x\nprTitle: y\n",
+		"missing title": "# file: a.yaml\nbranchName: x\n",
+		"not yaml":      "# file: notes.md\nbranchName: x\nprTitle: y\n",
+	} {
+		if info, rest := ExtractGitInfo(output); info != nil || rest != output {
+			t.Errorf("%s: got %+v", name, info)
+		}
+	}
+}
+
+func TestSanitizeBranchName(t *testing.T) {
+	tests := map[string]string{
+		"feat/add-runner":     "feat/add-runner",
+		" feat: add runner ":  "feat-add-runner",
+		"/feat//x..y.":        "feat/x.y",
+		"fix/ümlaut~^name.go": "fix/-mlaut-name.go",
+	}
+	for in, want := range tests {
+		if got := sanitizeBranchName(in); got != want {
+			t.Errorf("sanitizeBranchName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCommitGeneratedFiles(t *testing.T) {
+	repo := newGitRepo(t)
+	t.Setenv("GIT_AUTHOR_NAME", "k2n")
+	t.Setenv("GIT_AUTHOR_EMAIL", "k2n@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "k2n")
+	t.Setenv("GIT_COMMITTER_EMAIL", "k2n@example.com")
+
+	dest := filepath.Join(repo, "out")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	generated := filepath.Join(dest, "runner.yaml")
+	if err := os.WriteFile(generated, []byte("kind: GithubRunner\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Unrelated changes stay uncommitted.
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := ExtractGitInfo(gitInfoOutput)
+	commit, err := CommitGeneratedFiles(dest, info, []string{generated}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Branch != "feat/add-github-runner" || len(commit.Files) != 1 || commit.Files[0] != "out/runner.yaml" {
+		t.Errorf("unexpected result %+v", commit)
+	}
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if got := git("rev-parse", "--abbrev-ref", "HEAD"); got != commit.Branch {
+		t.Errorf("HEAD is on %s", got)
+	}
+	if got := git("rev-parse", "HEAD"); got != commit.Commit {
+		t.Errorf("commit %s, HEAD %s", commit.Commit, got)
+	}
+	if got := git("log", "-1", "--format=%s%n%b"); got != "feat: add GithubRunner claim\nAdds a GithubRunner claim.\nThe runner uses the default image." {
+		t.Errorf("commit message %q", got)
+	}
+	if got := git("show", "--name-only", "--format=", "HEAD"); got != "out/runner.yaml" {
+		t.Errorf("committed files %q", got)
+	}
+	if got := git("status", "--porcelain"); !strings.Contains(got, "M README.md") || strings.Contains(got, "out/") {
+		t.Errorf("working tree %q", got)
+	}
+	if repo, branch, err := CheckGitCommit(dest, info); err == nil || repo != "" || branch != "" {
+		t.Errorf("expected existing branch error, got %v", err)
+	}
+
+	body, err := os.ReadFile(commit.BodyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(body), "# feat: add GithubRunner claim\n\nAdds a GithubRunner claim.") || !strings.Contains(string(body), "- `out/runner.yaml`") {
+		t.Errorf("PR body:\n%s", body)
+	}
+	if filepath.Base(filepath.Dir(commit.BodyFile)) != ".git" {
+		t.Errorf("PR body written to %s", commit.BodyFile)
+	}
+
+	if _, err := CommitGeneratedFiles(dest, info, []string{generated}, ""); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected existing branch error, got %v", err)
+	}
+
+	// Files identical to the committed ones are not an error, but no branch
+	// is created.
+	again := &GitInfo{BranchName: "feat/again", PRTitle: "feat: again"}
+	unchanged, err := CommitGeneratedFiles(dest, again, []string{generated}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.Commit != "" || unchanged.Branch != "" || len(unchanged.Files) != 0 {
+		t.Errorf("expected no commit, got %+v", unchanged)
+	}
+	if got := git("rev-parse", "--abbrev-ref", "HEAD"); got != commit.Branch {
+		t.Errorf("HEAD moved to %s", got)
+	}
+	if got := git("branch", "--list", "feat/again"); got != "" {
+		t.Errorf("branch created for unchanged files: %q", got)
+	}
+
+	git("add", "README.md")
+	if _, _, err := CheckGitCommit(dest, again); err == nil || !strings.Contains(err.Error(), "staged changes") {
+		t.Errorf("expected staged changes error, got %v", err)
+	}
+	if _, err := CommitGeneratedFiles(t.TempDir(), info, []string{generated}, ""); err == nil {
+		t.Error("expected error outside of a repository")
+	}
+}
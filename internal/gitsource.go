@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitSourcePrefix starts an example or ruleset location in a local git
+// repository: git+file:///path/repo//subdir?ref=v1.2.0
+const GitSourcePrefix = "git+file://"
+
+// GitSource is a directory of a local git repository at a ref.
+type GitSource struct {
+	URL    string `json:"url" yaml:"url"`
+	Repo   string `json:"repo" yaml:"repo"`
+	Subdir string `json:"subdir,omitempty" yaml:"subdir,omitempty"`
+	Ref    string `json:"ref" yaml:"ref"`
+	// Commit is the SHA the ref resolved to.
+	Commit string `json:"commit" yaml:"commit"`
+}
+
+// IsGitSource reports whether location refers to a git repository.
+func IsGitSource(location string) bool {
+	return strings.HasPrefix(location, GitSourcePrefix)
+}
+
+// ParseGitSource parses git+file:///path/repo//subdir?ref=v1.2.0. The subdir
+// is optional and the ref defaults to HEAD.
+func ParseGitSource(location string) (*GitSource, error) {
+	rest, ok := strings.CutPrefix(location, GitSourcePrefix)
+	if !ok {
+		return nil, fmt.Errorf("invalid git source %q: must start with %s", location, GitSourcePrefix)
+	}
+	rest, query, _ := strings.Cut(rest, "?")
+	if !strings.HasPrefix(rest, "/") {
+		return nil, fmt.Errorf("invalid git source %q: the repository path must be absolute", location)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git source %q: %w", location, err)
+	}
+
+	src := &GitSource{URL: location, Ref: params.Get("ref")}
+	if src.Ref == "" {
+		src.Ref = "HEAD"
+	}
+	// The repository path starts with "/", the subdir follows the next "//".
+	if i := strings.Index(rest[1:], "//"); i >= 0 {
+		src.Repo, src.Subdir = rest[:i+1], strings.Trim(rest[i+3:], "/")
+	} else {
+		src.Repo = rest
+	}
+	if src.Repo == "" || src.Repo == "/" {
+		return nil, fmt.Errorf("invalid git source %q: missing repository path", location)
+	}
+	if strings.Contains(src.Subdir, "..") {
+		return nil, fmt.Errorf("invalid git source %q: subdir must not contain ..", location)
+	}
+	return src, nil
+}
+
+// GitCacheDir is where directories read from git are stored, by commit and
+// subdir. K2N_GIT_CACHE overrides the default below the user cache directory.
+func GitCacheDir() string {
+	if dir := os.Getenv("K2N_GIT_CACHE"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "k2n", "git")
+}
+
+// Fetch resolves the ref and returns a local directory with the files of the
+// subdir at that commit. Files are read from the object store with git archive,
+// the working tree of the repository is not touched. Directories are cached by
+// commit, so a ref is only read once.
+func (s *GitSource) Fetch() (string, error) {
+	commit, err := runGit(s.Repo, "rev-parse", "--verify", s.Ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve ref %s in %s: %w", s.Ref, s.Repo, err)
+	}
+	s.Commit = strings.TrimSpace(string(commit))
+
+	// Each subdir gets its own entry, so a partly extracted tree is never
+	// mistaken for another subdir.
+	key := sha256.Sum256([]byte(s.Subdir))
+	dir := filepath.Join(GitCacheDir(), s.Commit, hex.EncodeToString(key[:6]))
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	args := []string{"archive", "--format=tar", s.Commit}
+	if s.Subdir != "" {
+		args = append(args, "--", s.Subdir)
+	}
+	archive, err := runGit(s.Repo, args...)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s at %s from %s: %w", s.Subdir, s.Ref, s.Repo, err)
+	}
+
+	// Extract next to the final directory and rename, so concurrent runs never
+	// see a half-written cache entry.
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create git cache: %w", err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".extract-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create git cache: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extractTar(archive, s.Subdir, tmp); err != nil {
+		return "", fmt.Errorf("cannot read %s at %s from %s: %w", s.Subdir, s.Ref, s.Repo, err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr != nil {
+			return "", fmt.Errorf("failed to fill git cache: %w", err)
+		}
+	}
+	return dir, nil
+}
+
+// extractTar writes the regular files of a tar archive below prefix to dir.
+func extractTar(data []byte, prefix, dir string) error {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := hdr.Name
+		if prefix != "" {
+			name = strings.TrimPrefix(name, prefix+"/")
+		}
+		if name == "" || strings.Contains(name, "..") {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+	}
+}
+
+func runGit(repo string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// resolveGitSources replaces git sources in locations by their local
+// directories and records the resolved sources.
+func resolveGitSources(locations []string, resolved *[]GitSource) ([]string, error) {
+	out := make([]string, len(locations))
+	for i, loc := range locations {
+		if !IsGitSource(loc) {
+			out[i] = loc
+			continue
+		}
+		src, err := ParseGitSource(loc)
+		if err != nil {
+			return nil, err
+		}
+		dir, err := src.Fetch()
+		if err != nil {
+			return nil, err
+		}
+		*resolved = append(*resolved, *src)
+		out[i] = dir
+	}
+	return out, nil
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newGitRepo creates a repository with two commits tagged v1 and v2 and
+// returns its path.
+func newGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=k2n", "-c", "user.email=k2n@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("examples/runner.yaml", "kind: GithubRunner\nversion: 1\n")
+	write("rules/env.yaml", "namespace: v1\n")
+	write("README.md", "readme\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "first")
+	git("tag", "v1")
+
+	write("examples/runner.yaml", "kind: GithubRunner\nversion: 2\n")
+	write("examples/nested/extra.yaml", "kind: Extra\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "second")
+	git("tag", "v2")
+
+	// Uncommitted changes must not be visible.
+	write("examples/runner.yaml", "kind: GithubRunner\nversion: dirty\n")
+	return repo
+}
+
+func TestParseGitSource(t *testing.T) {
+	src, err := ParseGitSource("git+file:///srv/repo//examples/runner/?ref=v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Repo != "/srv/repo" || src.Subdir != "examples/runner" || src.Ref != "v1.2.0" {
+		t.Errorf("unexpected source %+v", src)
+	}
+
+	src, err = ParseGitSource("git+file:///srv/repo")
+	if err != nil || src.Repo != "/srv/repo" || src.Subdir != "" || src.Ref != "HEAD" {
+		t.Errorf("unexpected source %+v, %v", src, err)
+	}
+
+	for _, bad := range []string{"file:///srv/repo", "git+file://", "git+file://relative//x", "git+file:///srv/repo//../x"} {
+		if _, err := ParseGitSource(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestGitSourceFetch(t *testing.T) {
+	repo := newGitRepo(t)
+	t.Setenv("K2N_GIT_CACHE", t.TempDir())
+
+	v1, err := ParseGitSource("git+file://" + repo + "//examples?ref=v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := v1.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v1.Commit) != 40 {
+		t.Errorf("expected a commit SHA, got %q", v1.Commit)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "runner.yaml"))
+	if err != nil || string(content) != "kind: GithubRunner\nversion: 1\n" {
+		t.Errorf("expected the file at v1, got %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nested")); !os.IsNotExist(err) {
+		t.Error("files of later commits must not be present")
+	}
+
+	v2, _ := ParseGitSource("git+file://" + repo + "//examples?ref=v2")
+	dir2, err := v2.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Commit == v1.Commit || dir2 == dir {
+		t.Error("different refs should resolve to different commits and directories")
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir2, "nested", "extra.yaml")); string(content) != "kind: Extra\n" {
+		t.Errorf("expected nested file at v2, got %q", content)
+	}
+
+	// The whole tree is cached separately from the subdir.
+	root, _ := ParseGitSource("git+file://" + repo + "?ref=v2")
+	rootDir, err := root.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "README.md")); err != nil {
+		t.Errorf("expected the full tree: %v", err)
+	}
+
+	missing, _ := ParseGitSource("git+file://" + repo + "//examples?ref=v9")
+	if _, err := missing.Fetch(); err == nil || !strings.Contains(err.Error(), "v9") {
+		t.Errorf("expected error for unknown ref, got %v", err)
+	}
+}
+
+func TestLoadInputsFromGit(t *testing.T) {
+	repo := newGitRepo(t)
+	t.Setenv("K2N_GIT_CACHE", t.TempDir())
+
+	in, err := LoadInputs(InputConfig{
+		ExamplesDirs:   []string{"git+file://" + repo + "//examples?ref=v1"},
+		ExampleFileExt: []string{".yaml"},
+		RulesetEnvDirs: []string{"git+file://" + repo + "//rules?ref=v1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(in.Examples) != 1 || !strings.Contains(in.Examples[0].Content, "version: 1") {
+		t.Errorf("unexpected examples %+v", in.Examples)
+	}
+	if len(in.EnvRules) != 1 || !strings.Contains(in.EnvRules[0], "namespace: v1") {
+		t.Errorf("unexpected rules %v", in.EnvRules)
+	}
+	if len(in.GitSources) != 2 || in.GitSources[0].Commit == "" || in.GitSources[0].Ref != "v1" {
+		t.Errorf("git sources should be recorded, got %+v", in.GitSources)
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// IgnoreFileName is the file listing paths of an examples directory that are
+// not loaded. It uses the syntax of .gitignore and applies to the directory it
+// is in and everything below.
+const IgnoreFileName = ".k2nignore"
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	// base is the directory of the ignore file, relative to the walked root.
+	base    string
+	pattern string
+	negate  bool
+	dirOnly bool
+	source  string
+}
+
+// ignoreMatcher holds the rules of all ignore files seen so far. Later rules,
+// from deeper directories or further down a file, take precedence.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// parseIgnoreFile reads the patterns of an ignore file in the directory base.
+func parseIgnoreFile(base, source, content string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ") + " "
+		} else {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base, source: source}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// A pattern without a slash matches at any depth, otherwise it is
+		// relative to the directory of the ignore file.
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		if line == "" || !doublestar.ValidatePattern(line) {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// add appends the rules of another ignore file.
+func (m *ignoreMatcher) add(rules []ignoreRule) {
+	m.rules = append(m.rules, rules...)
+}
+
+// match reports whether the slash-separated path rel is ignored and by which
+// ignore file.
+func (m *ignoreMatcher) match(rel string, isDir bool) (bool, string) {
+	ignored, source := false, ""
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if r.base != "" {
+			var ok bool
+			if p, ok = strings.CutPrefix(rel, r.base+"/"); !ok {
+				continue
+			}
+		}
+		if ok, _ := doublestar.Match(r.pattern, p); ok {
+			ignored, source = !r.negate, r.source
+		}
+	}
+	return ignored, source
+}
+
+// matchAny returns the first of patterns matching the slash-separated path rel.
+func matchAny(patterns []string, rel string) (string, bool) {
+	for _, p := range patterns {
+		if ok, _ := doublestar.Match(path.Clean(p), rel); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,47 @@
+package internal
+
+import "testing"
+
+func TestIgnoreMatcher(t *testing.T) {
+	var m ignoreMatcher
+	m.add(parseIgnoreFile("", ".k2nignore", `# generated files
+*.gen.yaml
+!keep.gen.yaml
+build/
+/top.yaml
+charts/**/templates
+\#literal.yaml
+`))
+	m.add(parseIgnoreFile("apps", "apps/.k2nignore", "secret.yaml\n!top.yaml\n"))
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.gen.yaml", false, true},
+		{"deep/dir/a.gen.yaml", false, true},
+		{"keep.gen.yaml", false, false},
+		{"build", true, true},
+		{"sub/build", true, true},
+		{"build", false, false},
+		{"top.yaml", false, true},
+		{"sub/top.yaml", false, false},
+		{"charts/nginx/templates", true, true},
+		{"charts/templates", true, true},
+		{"#literal.yaml", false, true},
+		{"apps/secret.yaml", false, true},
+		{"apps/x/secret.yaml", false, true},
+		{"secret.yaml", false, false},
+		{"a.yaml", false, false},
+	}
+	for _, tt := range tests {
+		if got, _ := m.match(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("match(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+
+	if _, source := m.match("apps/secret.yaml", false); source != "apps/.k2nignore" {
+		t.Errorf("expected the nested ignore file as source, got %q", source)
+	}
+}
@@ -0,0 +1,168 @@
+package internal
+
+import "fmt"
+
+// InputConfig lists where examples and rulesets for a generation are loaded from.
+// Example and ruleset directories can also be git sources (see ParseGitSource).
+type InputConfig struct {
+	ExamplesDirs        []string
+	ExampleFiles        []string
+	ExampleFileExt      []string
+	RulesetEnvDirs      []string
+	RulesetUsecaseDirs  []string
+	RulesetEnvFiles     []string
+	RulesetUsecaseFiles []string
+	// Rulesets are additional rulesets assigned to a layer, e.g. org or run.
+	Rulesets []RulesetSource
+	// Usecase and ExampleTags select examples from ExamplesDirs by their
+	// metadata. Examples without metadata are only used if no example has any.
+	Usecase     string
+	ExampleTags []string
+	// ExampleInclude and ExampleExclude are doublestar patterns relative to
+	// each examples directory. Sizes are in bytes, zero means no limit.
+	ExampleInclude  []string
+	ExampleExclude  []string
+	ExampleMaxSize  int64
+	ExampleMaxTotal int64
+	// ExampleSimilarity collapses examples that are at least this similar
+	// (0-1) into one. 0 disables it.
+	ExampleSimilarity float64
+	// Context is reference context for the prompt, kept apart from examples.
+	Context ContextConfig
+}
+
+// Inputs are the loaded examples and rulesets together with the paths they came from.
+type Inputs struct {
+	Examples     []Example
+	EnvRules     []string
+	UsecaseRules []string
+	ExamplePaths []string
+	RulesetPaths []string
+
+	// Rules is the merged ruleset with the origin of every value.
+	Rules *EffectiveRuleset
+	// Structured are the rulesets with machine-checkable rules, applied to
+	// the generated output.
+	Structured []*StructuredRuleset
+
+	// SkippedExamples is the number of examples in ExamplesDirs not selected
+	// for the usecase and tags.
+	SkippedExamples int
+	// SkippedFiles are the example files left out by ignore files, patterns,
+	// size limits or because they are binary.
+	SkippedFiles []SkippedFile
+	// CollapsedExamples are near-duplicate examples left out in favour of a
+	// similar one.
+	CollapsedExamples []CollapsedExample
+	// Context are the reference context files, with credentials redacted.
+	Context []ContextFile
+	// GitSources are the git repositories examples and rulesets were read
+	// from, with the commit each ref resolved to.
+	GitSources []GitSource
+	// Warnings are problems that do not stop the run.
+	Warnings []string
+}
+
+// LoadInputs loads, selects and deduplicates examples and loads and merges the ruleset
+// layers. Missing environment and use case ruleset directories are skipped.
+func LoadInputs(cfg InputConfig) (*Inputs, error) {
+	in := &Inputs{}
+
+	var err error
+	if cfg.ExamplesDirs, err = resolveGitSources(cfg.ExamplesDirs, &in.GitSources); err != nil {
+		return nil, err
+	}
+	if cfg.Context.Dirs, err = resolveGitSources(cfg.Context.Dirs, &in.GitSources); err != nil {
+		return nil, err
+	}
+	if cfg.RulesetEnvDirs, err = resolveGitSources(cfg.RulesetEnvDirs, &in.GitSources); err != nil {
+		return nil, err
+	}
+	if cfg.RulesetUsecaseDirs, err = resolveGitSources(cfg.RulesetUsecaseDirs, &in.GitSources); err != nil {
+		return nil, err
+	}
+	rulesets := make([]RulesetSource, len(cfg.Rulesets))
+	for i, src := range cfg.Rulesets {
+		paths, err := resolveGitSources([]string{src.Path}, &in.GitSources)
+		if err != nil {
+			return nil, err
+		}
+		src.Path = paths[0]
+		rulesets[i] = src
+	}
+	cfg.Rulesets = rulesets
+
+	loader := NewExampleLoader(ExampleFilter{
+		Extensions:   cfg.ExampleFileExt,
+		Include:      cfg.ExampleInclude,
+		Exclude:      cfg.ExampleExclude,
+		MaxFileSize:  cfg.ExampleMaxSize,
+		MaxTotalSize: cfg.ExampleMaxTotal,
+	})
+	var dirExamples []Example
+	for _, dir := range cfg.ExamplesDirs {
+		examples, err := loader.LoadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load examples from dir %s: %w", dir, err)
+		}
+		dirExamples = append(dirExamples, examples...)
+	}
+	selected, ok := SelectExamples(dirExamples, cfg.Usecase, cfg.ExampleTags)
+	if !ok {
+		in.Warnings = append(in.Warnings, fmt.Sprintf("no example is declared for usecase %q, using all %d examples", cfg.Usecase, len(dirExamples)))
+	}
+	in.SkippedExamples = len(dirExamples) - len(selected)
+
+	// Explicitly listed files are always used.
+	for _, p := range FilterFilesByExtension(cfg.ExampleFiles, cfg.ExampleFileExt) {
+		ex, ok, err := loader.LoadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			selected = append(selected, ex)
+		}
+	}
+	in.SkippedFiles = loader.Skipped
+
+	in.Examples, in.CollapsedExamples = CollapseSimilarExamples(DeduplicateExamples(selected), cfg.ExampleSimilarity)
+	for _, ex := range in.Examples {
+		in.ExamplePaths = append(in.ExamplePaths, ex.Path)
+	}
+
+	var skipped []SkippedFile
+	if in.Context, skipped, err = LoadContextFiles(cfg.Context); err != nil {
+		return nil, err
+	}
+	in.SkippedFiles = append(in.SkippedFiles, skipped...)
+
+	var sources []RulesetSource
+	add := func(layer string, paths []string, optional bool) {
+		for _, p := range paths {
+			sources = append(sources, RulesetSource{Layer: layer, Path: p, Optional: optional})
+		}
+	}
+	add(LayerEnv, cfg.RulesetEnvDirs, true)
+	add(LayerEnv, cfg.RulesetEnvFiles, false)
+	add(LayerUsecase, cfg.RulesetUsecaseDirs, true)
+	add(LayerUsecase, cfg.RulesetUsecaseFiles, false)
+	sources = append(sources, cfg.Rulesets...)
+
+	files, err := LoadRuleFiles(sources)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ResolveRulesets(files)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		in.RulesetPaths = append(in.RulesetPaths, f.Path)
+	}
+	in.Rules = rules
+	in.EnvRules = rules.PromptTexts(LayerOrg, LayerPlatform, LayerEnv)
+	in.UsecaseRules = rules.PromptTexts(LayerUsecase, LayerRun)
+	in.Structured = rules.Structured()
+
+	return in, nil
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadInstruction returns the instruction text for a flag value. A value of "-"
+// reads the instruction from stdin and "@path" reads it from a file; anything
+// else is used as is.
+func ReadInstruction(value string, stdin io.Reader) (string, error) {
+	switch {
+	case value == "-":
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read instruction from stdin: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(value, "@"):
+		path := strings.TrimPrefix(value, "@")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read instruction file %s: %w", path, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return value, nil
+	}
+}
+
+// LoadTemplateValues merges the YAML values files in order and applies the
+// key=value pairs from sets on top. Keys in sets may be nested with dots
+// (cluster.name=sthings).
+func LoadTemplateValues(valuesFiles, sets []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	for _, path := range valuesFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file %s: %w", path, err)
+		}
+		var fileValues map[string]interface{}
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("failed to parse values file %s: %w", path, err)
+		}
+		mergeValues(values, fileValues)
+	}
+
+	for _, set := range sets {
+		key, value, ok := strings.Cut(set, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --set %q, expected key=value", set)
+		}
+		setNestedValue(values, strings.Split(key, "."), value)
+	}
+
+	return values, nil
+}
+
+// mergeValues deep-merges src into dst. Maps are merged, other values replaced.
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func setNestedValue(values map[string]interface{}, path []string, value interface{}) {
+	current := values
+	for _, key := range path[:len(path)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[key] = next
+		}
+		current = next
+	}
+	current[path[len(path)-1]] = value
+}
+
+// instructionFuncs are the helper functions available in instruction templates.
+var instructionFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"default": func(def, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// RenderInstruction renders the instruction as a Go template with the given
+// values. Referencing a value that is not set is an error. Without values the
+// instruction is returned as is, so it may contain literal template syntax like
+// Helm's {{ .Values.x }}.
+func RenderInstruction(text string, values map[string]interface{}) (string, error) {
+	if len(values) == 0 {
+		return text, nil
+	}
+	tmpl, err := template.New("instruction").
+		Funcs(instructionFuncs).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse instruction template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, values); err != nil {
+		return "", fmt.Errorf("failed to render instruction template: %w", err)
+	}
+	return b.String(), nil
+}
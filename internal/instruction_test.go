@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadInstruction(t *testing.T) {
+	got, err := ReadInstruction("plain text", nil)
+	if err != nil || got != "plain text" {
+		t.Errorf("expected plain text, got %q (%v)", got, err)
+	}
+
+	got, err = ReadInstruction("-", strings.NewReader("from stdin\n"))
+	if err != nil || got != "from stdin" {
+		t.Errorf("expected stdin content, got %q (%v)", got, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "issue.md")
+	if err := os.WriteFile(path, []byte("from file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ReadInstruction("@"+path, nil)
+	if err != nil || got != "from file" {
+		t.Errorf("expected file content, got %q (%v)", got, err)
+	}
+
+	if _, err := ReadInstruction("@/does/not/exist", nil); err == nil {
+		t.Error("expected error for missing instruction file")
+	}
+}
+
+func TestLoadTemplateValuesAndRender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "values.yaml")
+	content := "repo: dagger\ncluster:\n  name: sthings\n  region: eu\nversion: 0.12.0\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := LoadTemplateValues([]string{path}, []string{"cluster.name=cicd", "version=0.13.0"})
+	if err != nil {
+		t.Fatalf("LoadTemplateValues returned error: %v", err)
+	}
+
+	got, err := RenderInstruction("runner for {{ .repo }} on {{ .cluster.name }} ({{ .cluster.region | upper }}) version {{ .version }}", values)
+	if err != nil {
+		t.Fatalf("RenderInstruction returned error: %v", err)
+	}
+	expected := "runner for dagger on cicd (EU) version 0.13.0"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if _, err := RenderInstruction("{{ .missing }}", values); err == nil {
+		t.Error("expected error for missing value")
+	}
+	if _, err := LoadTemplateValues(nil, []string{"novalue"}); err == nil {
+		t.Error("expected error for invalid --set")
+	}
+}
+
+func TestRenderInstructionWithoutValues(t *testing.T) {
+	literal := "add a helm chart whose deployment uses {{ .Values.image.tag }} and {{ include \"name\" . }}"
+	for _, values := range []map[string]interface{}{nil, {}} {
+		got, err := RenderInstruction(literal, values)
+		if err != nil {
+			t.Fatalf("RenderInstruction returned error: %v", err)
+		}
+		if got != literal {
+			t.Errorf("expected %q unchanged, got %q", literal, got)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KustomizeOptions are the fields --kustomize sets in the kustomization, from
+// flags or the kustomize section of structured rulesets:
+//
+//	kind: Ruleset
+//	name: kustomize
+//	kustomize:
+//	  namespace: crossplane-system
+//	  commonLabels:
+//	    team: platform
+//	  nameSuffix: -dev
+type KustomizeOptions struct {
+	Namespace    string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	CommonLabels map[string]string `json:"commonLabels,omitempty" yaml:"commonLabels,omitempty"`
+	NameSuffix   string            `json:"nameSuffix,omitempty" yaml:"nameSuffix,omitempty"`
+}
+
+// Merge returns o with the values set in other. Labels are merged key by key.
+func (o KustomizeOptions) Merge(other KustomizeOptions) KustomizeOptions {
+	if other.Namespace != "" {
+		o.Namespace = other.Namespace
+	}
+	if other.NameSuffix != "" {
+		o.NameSuffix = other.NameSuffix
+	}
+	o.CommonLabels = mergeStringMaps(o.CommonLabels, other.CommonLabels)
+	return o
+}
+
+// KustomizeSettings merges the kustomize sections of the rulesets, which are
+// ordered by layer, so higher layers win.
+func KustomizeSettings(rulesets []*StructuredRuleset) KustomizeOptions {
+	var opts KustomizeOptions
+	for _, rs := range rulesets {
+		if rs.Kustomize != nil {
+			opts = opts.Merge(*rs.Kustomize)
+		}
+	}
+	return opts
+}
+
+// KustomizationChange describes what AddKustomization did.
+type KustomizationChange struct {
+	// Path is the kustomization file, relative to the destination.
+	Path    string `json:"path" yaml:"path"`
+	Created bool   `json:"created" yaml:"created"`
+	// Changed is false if an existing kustomization was already up to date.
+	Changed bool     `json:"changed" yaml:"changed"`
+	Added   []string `json:"added,omitempty" yaml:"added,omitempty"`
+}
+
+// AddKustomization adds a kustomization for the Kubernetes manifests of the
+// output, which is written to the directory dir. A kustomization in the output,
+// or else the one in dir, is updated; otherwise kustomization.yaml is created.
+func AddKustomization(output, dir string, opts KustomizeOptions) (string, *KustomizationChange, error) {
+	files := ParseGeneratedFiles(output)
+
+	var resources []string
+	existing, index := "", -1
+	change := &KustomizationChange{Path: kustomizationFiles[0]}
+	for i, f := range files {
+		if containsFold(kustomizationFiles, f.Name) {
+			existing, index, change.Path = f.Content, i, f.Name
+			continue
+		}
+		if isYAMLPath(f.Name) {
+			if _, ok := parseManifestInfo(f.Content); ok {
+				resources = append(resources, path.Clean(f.Name))
+			}
+		}
+	}
+	if index < 0 {
+		for _, name := range kustomizationFiles {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err == nil {
+				existing, change.Path = string(data), name
+				break
+			}
+			if !os.IsNotExist(err) {
+				return "", nil, fmt.Errorf("failed to read kustomization: %w", err)
+			}
+		}
+	}
+	change.Created = existing == ""
+
+	content, added, err := UpdateKustomization(existing, resources, opts)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to update %s: %w", change.Path, err)
+	}
+	change.Added = added
+	// An existing file that needs no change is not rewritten, which would only
+	// reformat it.
+	if index < 0 && !change.Created {
+		if unchanged, _, err := UpdateKustomization(existing, nil, KustomizeOptions{}); err == nil && unchanged == content {
+			return output, change, nil
+		}
+	}
+	change.Changed = true
+
+	if index >= 0 {
+		files[index].Content = content
+	} else {
+		files = append(files, GeneratedFile{Name: change.Path, Content: content})
+	}
+	return RenderGeneratedFiles(files), change, nil
+}
+
+// UpdateKustomization adds resources that are not listed yet to the
+// kustomization content and sets the configured fields. Existing entries,
+// their order and comments are kept. An empty content creates a new
+// kustomization. It returns the added resources.
+func UpdateKustomization(content string, resources []string, opts KustomizeOptions) (string, []string, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if strings.TrimSpace(content) != "" {
+		docs, err := decodeYAMLDocuments(content)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(docs) != 1 || docs[0].Kind != yaml.MappingNode {
+			return "", nil, fmt.Errorf("not a kustomization")
+		}
+		doc = docs[0]
+	} else {
+		setMappingValue(doc, "apiVersion", scalarNode("kustomize.config.k8s.io/v1beta1"))
+		setMappingValue(doc, "kind", scalarNode("Kustomization"))
+	}
+
+	if opts.Namespace != "" {
+		setMappingValue(doc, "namespace", scalarNode(opts.Namespace))
+	}
+	if opts.NameSuffix != "" {
+		setMappingValue(doc, "nameSuffix", scalarNode(opts.NameSuffix))
+	}
+	if len(opts.CommonLabels) > 0 {
+		labels := mappingValue(doc, "commonLabels")
+		if labels == nil || labels.Kind != yaml.MappingNode {
+			labels = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingValue(doc, "commonLabels", labels)
+		}
+		for _, k := range sortedStringKeys(opts.CommonLabels) {
+			setMappingValue(labels, k, scalarNode(opts.CommonLabels[k]))
+		}
+	}
+
+	list := mappingValue(doc, "resources")
+	if list == nil || list.Kind != yaml.SequenceNode {
+		list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setMappingValue(doc, "resources", list)
+	}
+	var added []string
+	for _, r := range resources {
+		if kustomizationLists(list, r) {
+			continue
+		}
+		list.Content = append(list.Content, scalarNode(r))
+		added = append(added, r)
+	}
+
+	out, err := encodeYAMLDocuments([]*yaml.Node{doc})
+	if err != nil {
+		return "", nil, err
+	}
+	return out + "\n", added, nil
+}
+
+// kustomizationLists reports whether resource is listed, itself or through a
+// directory containing it.
+func kustomizationLists(list *yaml.Node, resource string) bool {
+	for _, item := range list.Content {
+		entry := path.Clean(item.Value)
+		if entry == resource || strings.HasPrefix(resource, entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// setMappingValue replaces the value of key in a mapping node or appends it.
+// Unlike setRulePath, key may contain dots, as label keys do.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, scalarNode(key), value)
+}
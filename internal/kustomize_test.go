@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const kustomizeOutput = `# file: apps/web.yaml
+kind: Deployment
+metadata:
+  name: web
+# file: service.yaml
+kind: Service
+metadata:
+  name: web
+# file: values.yaml
+replicas: 2
+`
+
+func TestAddKustomizationCreate(t *testing.T) {
+	out, change, err := AddKustomization(kustomizeOutput, t.TempDir(), KustomizeOptions{Namespace: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !change.Created || !change.Changed || change.Path != "kustomization.yaml" || strings.Join(change.Added, ",") != "apps/web.yaml,service.yaml" {
+		t.Errorf("unexpected change %+v", change)
+	}
+	files := ParseGeneratedFiles(out)
+	if len(files) != 4 || files[3].Name != "kustomization.yaml" {
+		t.Fatalf("got files %+v", files)
+	}
+	want := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: shop
+resources:
+  - apps/web.yaml
+  - service.yaml
+`
+	if strings.TrimSpace(files[3].Content) != strings.TrimSpace(want) {
+		t.Errorf("got\n%s\nwant\n%s", files[3].Content, want)
+	}
+}
+
+func TestAddKustomizationUpdate(t *testing.T) {
+	dir := t.TempDir()
+	existing := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+# keep this
+resources:
+  - zz-existing.yaml
+  - ./service.yaml
+commonLabels:
+  team: old
+`
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := KustomizeOptions{CommonLabels: map[string]string{"team": "platform", "app.kubernetes.io/part-of": "shop"}, NameSuffix: "-dev"}
+	out, change, err := AddKustomization(kustomizeOutput, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Created || strings.Join(change.Added, ",") != "apps/web.yaml" {
+		t.Errorf("unexpected change %+v", change)
+	}
+	var content string
+	for _, f := range ParseGeneratedFiles(out) {
+		if f.Name == "kustomization.yaml" {
+			content = f.Content
+		}
+	}
+	want := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+# keep this
+resources:
+  - zz-existing.yaml
+  - ./service.yaml
+  - apps/web.yaml
+commonLabels:
+  team: platform
+  app.kubernetes.io/part-of: shop
+nameSuffix: -dev
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(want) {
+		t.Errorf("got\n%s\nwant\n%s", content, want)
+	}
+
+	// Once everything is listed the file is left alone.
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, change, err := AddKustomization(kustomizeOutput, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Changed || again != kustomizeOutput {
+		t.Errorf("expected no change, got %+v\n%s", change, again)
+	}
+}
+
+func TestAddKustomizationFromOutput(t *testing.T) {
+	output := kustomizeOutput + `# file: kustomization.yaml
+kind: Kustomization
+resources:
+  - apps/
+`
+	out, change, err := AddKustomization(output, t.TempDir(), KustomizeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Created || strings.Join(change.Added, ",") != "service.yaml" {
+		t.Errorf("unexpected change %+v", change)
+	}
+	if n := strings.Count(out, "# file: kustomization.yaml"); n != 1 {
+		t.Errorf("%d kustomization files in\n%s", n, out)
+	}
+
+	if _, _, err := AddKustomization("# file: kustomization.yaml\n- a\n", t.TempDir(), KustomizeOptions{}); err == nil {
+		t.Error("expected error for an invalid kustomization")
+	}
+}
+
+func TestKustomizeSettings(t *testing.T) {
+	rulesets := []*StructuredRuleset{
+		{Kustomize: &KustomizeOptions{Namespace: "org", CommonLabels: map[string]string{"team": "a", "tier": "x"}}},
+		{},
+		{Kustomize: &KustomizeOptions{Namespace: "env", CommonLabels: map[string]string{"team": "b"}}},
+	}
+	got := KustomizeSettings(rulesets).Merge(KustomizeOptions{NameSuffix: "-dev"})
+	if got.Namespace != "env" || got.NameSuffix != "-dev" || got.CommonLabels["team"] != "b" || got.CommonLabels["tier"] != "x" {
+		t.Errorf("got %+v", got)
+	}
+	if rulesets[0].Kustomize.CommonLabels["team"] != "a" {
+		t.Error("merge modified the ruleset")
+	}
+
+	rs, err := ParseStructuredRuleset("k.yaml", "kind: Ruleset\nkustomize:\n  namespace: crossplane-system\n")
+	if err != nil || rs.Kustomize == nil || rs.Kustomize.Namespace != "crossplane-system" {
+		t.Errorf("got %+v, %v", rs, err)
+	}
+}
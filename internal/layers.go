@@ -0,0 +1,380 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ruleset layers from lowest to highest precedence. When two layers set the
+// same key, the later layer wins.
+const (
+	LayerOrg      = "org"
+	LayerPlatform = "platform"
+	LayerEnv      = "env"
+	LayerUsecase  = "usecase"
+	LayerRun      = "run"
+)
+
+// RulesetLayers lists all layers in order of precedence.
+var RulesetLayers = []string{LayerOrg, LayerPlatform, LayerEnv, LayerUsecase, LayerRun}
+
+func layerIndex(layer string) int {
+	for i, l := range RulesetLayers {
+		if l == layer {
+			return i
+		}
+	}
+	return -1
+}
+
+// RulesetSource is a ruleset file or directory assigned to a layer.
+type RulesetSource struct {
+	Layer string
+	Path  string
+	// Optional sources are skipped if the path does not exist.
+	Optional bool
+}
+
+// ParseRulesetSource parses "layer=path", e.g. "org=rules/org/".
+func ParseRulesetSource(spec string) (RulesetSource, error) {
+	layer, path, ok := strings.Cut(spec, "=")
+	layer, path = strings.TrimSpace(layer), strings.TrimSpace(path)
+	if !ok || path == "" {
+		return RulesetSource{}, fmt.Errorf("invalid ruleset %q, expected layer=path", spec)
+	}
+	if layerIndex(layer) < 0 {
+		return RulesetSource{}, fmt.Errorf("unknown ruleset layer %q (supported: %s)", layer, strings.Join(RulesetLayers, ", "))
+	}
+	return RulesetSource{Layer: layer, Path: path}, nil
+}
+
+// ParseRulesetSources parses a list of "layer=path" specs.
+func ParseRulesetSources(specs []string) ([]RulesetSource, error) {
+	var sources []RulesetSource
+	for _, spec := range specs {
+		s, err := ParseRulesetSource(spec)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// RulesetSourcesFromEnv returns the org and platform rulesets configured with
+// K2N_RULESET_ORG and K2N_RULESET_PLATFORM (comma-separated paths), so shared
+// rules do not have to be passed on every run.
+func RulesetSourcesFromEnv() []RulesetSource {
+	var sources []RulesetSource
+	for layer, env := range map[string]string{LayerOrg: "K2N_RULESET_ORG", LayerPlatform: "K2N_RULESET_PLATFORM"} {
+		for _, p := range SplitAndTrimPaths(os.Getenv(env)) {
+			sources = append(sources, RulesetSource{Layer: layer, Path: p})
+		}
+	}
+	sortRulesetSources(sources)
+	return sources
+}
+
+func sortRulesetSources(sources []RulesetSource) {
+	sort.SliceStable(sources, func(a, b int) bool {
+		return layerIndex(sources[a].Layer) < layerIndex(sources[b].Layer)
+	})
+}
+
+// RuleFile is a loaded ruleset file.
+type RuleFile struct {
+	Layer   string
+	Path    string
+	Content string
+	// FromDir is set for files found in a ruleset directory; their prompt
+	// text starts with the file name.
+	FromDir bool
+
+	// Text is the content sent to the model, with values overridden by a
+	// later layer removed. Empty if everything was overridden.
+	Text string
+	// Structured is the structured ruleset of the file, with overridden rules
+	// removed, or nil.
+	Structured *StructuredRuleset
+}
+
+// PromptText returns the text of the file as it appears in the prompt.
+func (f *RuleFile) PromptText() string {
+	text := f.Text
+	if f.FromDir {
+		text = fmt.Sprintf("Filename: %s\n%s", filepath.Base(f.Path), text)
+	}
+	if f.Layer != LayerEnv && f.Layer != LayerUsecase {
+		text = fmt.Sprintf("Layer: %s\n%s", f.Layer, text)
+	}
+	return text
+}
+
+// LoadRuleFiles reads the files of all sources, ordered by layer. Directories
+// are read recursively.
+func LoadRuleFiles(sources []RulesetSource) ([]*RuleFile, error) {
+	sources = append([]RulesetSource(nil), sources...)
+	sortRulesetSources(sources)
+
+	var files []*RuleFile
+	for _, src := range sources {
+		info, err := os.Stat(src.Path)
+		if os.IsNotExist(err) && src.Optional {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s ruleset %s: %w", src.Layer, src.Path, err)
+		}
+
+		paths := []string{src.Path}
+		if info.IsDir() {
+			if paths, err = ListFiles(src.Path, nil); err != nil {
+				return nil, fmt.Errorf("failed to read %s ruleset directory %s: %w", src.Layer, src.Path, err)
+			}
+		}
+		for _, p := range paths {
+			content, err := os.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ruleset file %s: %w", p, err)
+			}
+			files = append(files, &RuleFile{Layer: src.Layer, Path: p, Content: string(content), FromDir: info.IsDir()})
+		}
+	}
+	return files, nil
+}
+
+// RuleOrigin is where a rule value was set.
+type RuleOrigin struct {
+	Layer  string `json:"layer" yaml:"layer"`
+	Source string `json:"source" yaml:"source"`
+	Value  string `json:"value" yaml:"value"`
+}
+
+// EffectiveRule is a rule value after merging all layers.
+type EffectiveRule struct {
+	// Key is the dotted key of a plain ruleset value, or "<ruleset> <section>
+	// <path>" for a rule of a structured ruleset.
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Layer  string `json:"layer" yaml:"layer"`
+	Source string `json:"source" yaml:"source"`
+	// Overrides lists the values of lower layers this rule replaced.
+	Overrides []RuleOrigin `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// EffectiveRuleset is the result of merging ruleset layers.
+type EffectiveRuleset struct {
+	Files []*RuleFile     `json:"-" yaml:"-"`
+	Rules []EffectiveRule `json:"rules" yaml:"rules"`
+	// Text lists files that are not YAML mappings; they are passed on as they are.
+	Text []string `json:"text,omitempty" yaml:"text,omitempty"`
+}
+
+// Structured returns the structured rulesets left after merging.
+func (e *EffectiveRuleset) Structured() []*StructuredRuleset {
+	var rulesets []*StructuredRuleset
+	for _, f := range e.Files {
+		if f.Structured != nil {
+			rulesets = append(rulesets, f.Structured)
+		}
+	}
+	return rulesets
+}
+
+// PromptTexts returns the prompt text of the files in the given layers.
+func (e *EffectiveRuleset) PromptTexts(layers ...string) []string {
+	var texts []string
+	for _, f := range e.Files {
+		if f.Text == "" {
+			continue
+		}
+		for _, l := range layers {
+			if f.Layer == l {
+				texts = append(texts, f.PromptText())
+			}
+		}
+	}
+	return texts
+}
+
+// ruleClaim is a key set by a higher layer.
+type ruleClaim struct {
+	scope string // "values" for plain rulesets, the match selector for structured ones
+	path  string
+	file  string
+	rule  int // index into EffectiveRuleset.Rules
+}
+
+// pathsOverlap reports whether two dotted paths address the same value, or one
+// contains the other.
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".") ||
+		strings.HasPrefix(a, b+"[") || strings.HasPrefix(b, a+"[")
+}
+
+// ResolveRulesets merges ruleset files, which must be ordered by layer. Values
+// of plain YAML rulesets are merged key by key and rules of structured rulesets
+// with the same match path by path; on conflicts the later file wins and the
+// overridden value is removed from the earlier file.
+func ResolveRulesets(files []*RuleFile) (*EffectiveRuleset, error) {
+	e := &EffectiveRuleset{Files: files}
+	var claims []ruleClaim
+
+	// claim returns the rule that overrides scope/path, or registers a new one.
+	claim := func(scope, path, key, value string, f *RuleFile) bool {
+		origin := RuleOrigin{Layer: f.Layer, Source: f.Path, Value: value}
+		for _, c := range claims {
+			if c.scope == scope && c.file != f.Path && pathsOverlap(c.path, path) {
+				e.Rules[c.rule].Overrides = append(e.Rules[c.rule].Overrides, origin)
+				return false
+			}
+		}
+		claims = append(claims, ruleClaim{scope: scope, path: path, file: f.Path, rule: len(e.Rules)})
+		e.Rules = append(e.Rules, EffectiveRule{Key: key, Value: value, Layer: f.Layer, Source: f.Path})
+		return true
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+
+		rs, err := ParseStructuredRuleset(f.Path, f.Content)
+		if err != nil {
+			return nil, err
+		}
+		if rs != nil {
+			f.Structured = resolveStructured(rs, f, claim)
+			f.Text = f.Structured.PromptText()
+			continue
+		}
+
+		docs, err := decodeYAMLDocuments(f.Content)
+		if err != nil || len(docs) == 0 || !allMappings(docs) {
+			f.Text = f.Content
+			e.Text = append(e.Text, f.Path)
+			continue
+		}
+
+		removed := false
+		for _, doc := range docs {
+			removed = resolveValues(doc, "", f, claim) || removed
+		}
+		f.Text = f.Content
+		if removed {
+			f.Text = ""
+			if text, err := encodeYAMLDocuments(nonEmptyMappings(docs)); err == nil {
+				f.Text = text
+			}
+		}
+	}
+
+	for a, b := 0, len(e.Text)-1; a < b; a, b = a+1, b-1 {
+		e.Text[a], e.Text[b] = e.Text[b], e.Text[a]
+	}
+	sort.SliceStable(e.Rules, func(a, b int) bool { return e.Rules[a].Key < e.Rules[b].Key })
+	return e, nil
+}
+
+// resolveValues claims the leaf values of a mapping and removes the ones a later
+// layer already set. It reports whether anything was removed.
+func resolveValues(n *yaml.Node, prefix string, f *RuleFile, claim func(scope, path, key, value string, f *RuleFile) bool) bool {
+	removed := false
+	var kept []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + key.Value
+		}
+
+		if value.Kind == yaml.MappingNode && len(value.Content) > 0 {
+			if resolveValues(value, path, f, claim) {
+				removed = true
+				if len(value.Content) == 0 {
+					continue
+				}
+			}
+			kept = append(kept, key, value)
+			continue
+		}
+		if !claim("values", path, path, summarizeNode(value), f) {
+			removed = true
+			continue
+		}
+		kept = append(kept, key, value)
+	}
+	n.Content = kept
+	return removed
+}
+
+// resolveStructured returns a copy of rs without the rules a later layer set for
+// the same paths.
+func resolveStructured(rs *StructuredRuleset, f *RuleFile, claim func(scope, path, key, value string, f *RuleFile) bool) *StructuredRuleset {
+	scope := "match:" + strings.Join(formatPathValues(rs.Match, "="), ",")
+	key := func(section, path string) string { return rs.Name + " " + section + " " + path }
+
+	out := *rs
+	out.Defaults, out.Enforce, out.Forbid = nil, nil, nil
+
+	for _, path := range sortedKeys(rs.Enforce) {
+		rule := rs.Enforce[path]
+		value := formatRuleValue(enforceValue(rule))
+		if re, ok := enforceRegex(rule); ok {
+			value = "regex " + re
+		}
+		if claim(scope, normalizeRulePath(path), key("enforce", path), value, f) {
+			if out.Enforce == nil {
+				out.Enforce = map[string]interface{}{}
+			}
+			out.Enforce[path] = rule
+		}
+	}
+	for _, d := range flattenDefaults("", rs.Defaults) {
+		if claim(scope, d.path, key("defaults", d.path), formatRuleValue(d.value), f) {
+			if out.Defaults == nil {
+				out.Defaults = map[string]interface{}{}
+			}
+			setNestedValue(out.Defaults, strings.Split(d.path, "."), d.value)
+		}
+	}
+	for _, fr := range rs.Forbid {
+		value := "forbidden"
+		switch {
+		case fr.Regex != "":
+			value = "forbidden regex " + fr.Regex
+		case fr.Value != nil:
+			value = "forbidden " + formatRuleValue(fr.Value)
+		}
+		if claim(scope, normalizeRulePath(fr.Path), key("forbid", fr.Path), value, f) {
+			out.Forbid = append(out.Forbid, fr)
+		}
+	}
+	return &out
+}
+
+func normalizeRulePath(path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+}
+
+func allMappings(docs []*yaml.Node) bool {
+	for _, d := range docs {
+		if d.Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+func nonEmptyMappings(docs []*yaml.Node) []*yaml.Node {
+	var out []*yaml.Node
+	for _, d := range docs {
+		if len(d.Content) > 0 {
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRuleFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRulesetSource(t *testing.T) {
+	s, err := ParseRulesetSource("org = rules/org/")
+	if err != nil || s.Layer != LayerOrg || s.Path != "rules/org/" {
+		t.Errorf("unexpected source %+v, %v", s, err)
+	}
+	for _, bad := range []string{"rules/org/", "team=rules", "org="} {
+		if _, err := ParseRulesetSource(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRulesetSourcesFromEnv(t *testing.T) {
+	t.Setenv("K2N_RULESET_ORG", "org.yaml")
+	t.Setenv("K2N_RULESET_PLATFORM", "a.yaml, b.yaml")
+	sources := RulesetSourcesFromEnv()
+	if len(sources) != 3 || sources[0].Layer != LayerOrg || sources[2].Path != "b.yaml" {
+		t.Errorf("unexpected sources %+v", sources)
+	}
+}
+
+func TestLoadRuleFilesOrdersByLayer(t *testing.T) {
+	dir := t.TempDir()
+	run := writeRuleFile(t, dir, "run.yaml", "a: 1\n")
+	org := writeRuleFile(t, dir, "org/base.yaml", "a: 0\n")
+
+	files, err := LoadRuleFiles([]RulesetSource{
+		{Layer: LayerRun, Path: run},
+		{Layer: LayerEnv, Path: filepath.Join(dir, "missing"), Optional: true},
+		{Layer: LayerOrg, Path: filepath.Dir(org)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != org || files[1].Path != run || !files[0].FromDir {
+		t.Errorf("unexpected files %+v", files)
+	}
+
+	if _, err := LoadRuleFiles([]RulesetSource{{Layer: LayerOrg, Path: filepath.Join(dir, "missing")}}); err == nil {
+		t.Error("expected error for a missing ruleset")
+	}
+}
+
+func TestResolveRulesetsValues(t *testing.T) {
+	files := []*RuleFile{
+		{Layer: LayerOrg, Path: "org.yaml", Content: "group: org\ntoken:\n  name: github # shared token\n  key: ORG\nregion: eu\n"},
+		{Layer: LayerEnv, Path: "env.yaml", Content: "# env rules\ngroup: env\ntoken:\n  key: ENV\n"},
+		{Layer: LayerRun, Path: "run.yaml", Content: "group: run\n"},
+		{Layer: LayerUsecase, Path: "notes.md", Content: "Always use two replicas."},
+	}
+	rules, err := ResolveRulesets(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byKey := map[string]EffectiveRule{}
+	for _, r := range rules.Rules {
+		byKey[r.Key] = r
+	}
+	if r := byKey["group"]; r.Value != "run" || r.Layer != LayerRun || len(r.Overrides) != 2 {
+		t.Errorf("group should come from run and override env and org, got %+v", r)
+	}
+	if r := byKey["token.key"]; r.Value != "ENV" || r.Overrides[0].Value != "ORG" {
+		t.Errorf("token.key should come from env, got %+v", r)
+	}
+	if r := byKey["token.name"]; r.Value != "github" || r.Layer != LayerOrg {
+		t.Errorf("token.name should come from org, got %+v", r)
+	}
+	if len(rules.Text) != 1 || rules.Text[0] != "notes.md" {
+		t.Errorf("free text rulesets should be listed, got %v", rules.Text)
+	}
+
+	org := files[0].Text
+	if strings.Contains(org, "group") || strings.Contains(org, "ORG") {
+		t.Errorf("overridden values should be removed from the org ruleset:\n%s", org)
+	}
+	if !strings.Contains(org, "name: github # shared token") || !strings.Contains(org, "region: eu") {
+		t.Errorf("remaining values and comments should be kept:\n%s", org)
+	}
+	if strings.Contains(files[1].Text, "group") || !strings.Contains(files[1].Text, "key: ENV") {
+		t.Errorf("unexpected env text:\n%s", files[1].Text)
+	}
+	if files[2].Text != "group: run\n" {
+		t.Errorf("the highest layer should be unchanged, got %q", files[2].Text)
+	}
+}
+
+func TestResolveRulesetsStructured(t *testing.T) {
+	files := []*RuleFile{
+		{Layer: LayerOrg, Path: "org.yaml", Content: "kind: Ruleset\nname: org\nmatch:\n  kind: App\ndefaults:\n  spec:\n    replicas: 1\n    group: org\nforbid:\n  - metadata.namespace\n"},
+		{Layer: LayerOrg, Path: "other.yaml", Content: "kind: Ruleset\nname: other\nmatch:\n  kind: Job\nenforce:\n  spec.replicas: 5\n"},
+		{Layer: LayerUsecase, Path: "uc.yaml", Content: "kind: Ruleset\nname: uc\nmatch:\n  kind: App\nenforce:\n  spec.replicas: 3\n  metadata.namespace: apps\n"},
+	}
+	rules, err := ResolveRulesets(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	org := files[0].Structured
+	if len(org.Forbid) != 0 || org.Defaults["spec"].(map[string]interface{})["group"] != "org" {
+		t.Errorf("unexpected merged org ruleset %+v", org)
+	}
+	if _, ok := org.Defaults["spec"].(map[string]interface{})["replicas"]; ok {
+		t.Error("spec.replicas default should be overridden by the use case layer")
+	}
+	if files[1].Structured.Enforce["spec.replicas"] != 5 {
+		t.Error("rulesets with another match should not be merged")
+	}
+	if len(rules.Structured()) != 3 {
+		t.Errorf("expected 3 structured rulesets, got %d", len(rules.Structured()))
+	}
+	if strings.Contains(files[0].Text, "metadata.namespace") {
+		t.Errorf("prompt text should not contain overridden rules:\n%s", files[0].Text)
+	}
+}
+
+func TestLoadInputsLayers(t *testing.T) {
+	dir := t.TempDir()
+	org := writeRuleFile(t, dir, "org.yaml", "namespace: org\nteam: platform\n")
+	env := writeRuleFile(t, dir, "env/rules.yaml", "namespace: dev\n")
+
+	in, err := LoadInputs(InputConfig{
+		RulesetEnvDirs: []string{filepath.Dir(env)},
+		Rulesets:       []RulesetSource{{Layer: LayerOrg, Path: org}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(in.EnvRules) != 2 || !strings.HasPrefix(in.EnvRules[0], "Layer: org\nteam: platform") {
+		t.Errorf("unexpected env rules %q", in.EnvRules)
+	}
+	if in.EnvRules[1] != "Filename: rules.yaml\nnamespace: dev\n" {
+		t.Errorf("unexpected env rule %q", in.EnvRules[1])
+	}
+	if len(in.RulesetPaths) != 2 || in.RulesetPaths[0] != org {
+		t.Errorf("unexpected ruleset paths %v", in.RulesetPaths)
+	}
+}
@@ -1,81 +1,604 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+// OutputFile is a single file a generation run wants to write.
+type OutputFile struct {
+	Path    string
+	Content string
+}
+
+// OverwritePolicy decides what happens when an output file already exists.
+type OverwritePolicy string
+
+const (
+	OverwriteAlways OverwritePolicy = "always"
+	OverwriteNever  OverwritePolicy = "never"
+	OverwritePrompt OverwritePolicy = "prompt"
+	OverwriteBackup OverwritePolicy = "backup"
+)
+
+// ParseOverwritePolicy validates a policy name. An empty name means OverwriteAlways.
+func ParseOverwritePolicy(name string) (OverwritePolicy, error) {
+	switch p := OverwritePolicy(strings.ToLower(strings.TrimSpace(name))); p {
+	case "":
+		return OverwriteAlways, nil
+	case OverwriteAlways, OverwriteNever, OverwritePrompt, OverwriteBackup:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown overwrite policy %q (supported: always, never, prompt, backup)", name)
+	}
+}
+
+// OutputOptions controls how output files are written.
+type OutputOptions struct {
+	Policy OverwritePolicy
+	// Confirm is asked before an existing file is overwritten with OverwritePrompt.
+	Confirm func(path string) (bool, error)
+	// Journal, if set, records every file touched so the run can be undone.
+	Journal *Journal
+}
+
 // SaveOutput writes the content to the given destination or stdout if destination is empty.
 // If destination is a directory, it saves each parsed file separately.
 // If destination is a file, it combines all parsed files into one with filename comments.
 func SaveOutput(destination, content string) error {
+	return SaveOutputWithOptions(destination, content, OutputOptions{})
+}
+
+// SaveOutputWithOptions is SaveOutput with an overwrite policy and an optional journal.
+func SaveOutputWithOptions(destination, content string, opts OutputOptions) error {
 	if destination == "" {
 		fmt.Println(content)
 		return nil
 	}
 
-	info, err := os.Stat(destination)
-	if err == nil && info.IsDir() {
-		return writeParsedFilesToDir(destination, content)
+	files, err := ResolveOutputFiles(destination, content)
+	if err != nil {
+		return err
 	}
+	return WriteOutputFiles(files, opts)
+}
 
-	if os.IsNotExist(err) {
-		// If destination ends with path separator or parsed files > 1, treat as dir
+// ResolveOutputFiles determines the files SaveOutput writes for a non-empty destination.
+// An existing directory, a path ending in a separator or output with more than one
+// parsed file yields one file per parsed part; anything else is a single file.
+// Parsed file names that would escape the destination directory are rejected.
+func ResolveOutputFiles(destination, content string) ([]OutputFile, error) {
+	info, err := os.Stat(destination)
+	isDir := err == nil && info.IsDir()
+
+	if !isDir && os.IsNotExist(err) {
 		parsedFiles := ParseGeneratedFiles(content)
-		if strings.HasSuffix(destination, string(os.PathSeparator)) || len(parsedFiles) > 1 {
-			if err := os.MkdirAll(destination, 0755); err != nil {
-				return fmt.Errorf("failed to create directory %s: %w", destination, err)
+		isDir = strings.HasSuffix(destination, string(os.PathSeparator)) || len(parsedFiles) > 1
+	}
+
+	if !isDir {
+		return []OutputFile{{Path: destination, Content: content}}, nil
+	}
+
+	parsedFiles := ParseGeneratedFiles(content)
+	files := make([]OutputFile, 0, len(parsedFiles))
+	for _, f := range parsedFiles {
+		fullPath, err := SafeJoin(destination, f.Name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, OutputFile{Path: fullPath, Content: f.Content})
+	}
+	return files, nil
+}
+
+// SafeJoin joins name onto root and fails if the result, after resolving ".."
+// elements and symlinks of existing parent directories, lies outside root.
+func SafeJoin(root, name string) (string, error) {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("output path %q must be relative to %s", name, root)
+	}
+
+	joined := filepath.Join(root, name)
+	if !isWithin(filepath.Clean(root), joined) {
+		return "", fmt.Errorf("output path %q escapes destination %s", name, root)
+	}
+
+	realRoot, err := resolveExisting(root)
+	if err != nil {
+		return "", err
+	}
+	realJoined, err := resolveExisting(joined)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(realRoot, realJoined) {
+		return "", fmt.Errorf("output path %q escapes destination %s via symlink", name, root)
+	}
+
+	return joined, nil
+}
+
+// isWithin reports whether path equals root or lies below it.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// resolveExisting evaluates symlinks in the longest existing prefix of path and
+// appends the remaining, not yet existing, elements unchanged.
+func resolveExisting(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var rest []string
+	current := abs
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return abs, nil
+		}
+		rest = append([]string{filepath.Base(current)}, rest...)
+		current = parent
+	}
+}
+
+// WriteOutputFiles writes all files according to the overwrite policy, creating
+// parent directories as needed.
+func WriteOutputFiles(files []OutputFile, opts OutputOptions) error {
+	policy := opts.Policy
+	if policy == "" {
+		policy = OverwriteAlways
+	}
+
+	for _, f := range files {
+		// The journal stores absolute paths, so undo works from any directory.
+		absPath, err := filepath.Abs(f.Path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", f.Path, err)
+		}
+		entry := JournalEntry{Path: absPath, Action: ActionCreated}
+
+		existing, err := os.ReadFile(f.Path)
+		switch {
+		case err == nil:
+			entry.Action = ActionModified
+			entry.PreviousContent = string(existing)
+			entry.PreviousChecksum = Checksum(string(existing))
+		case !os.IsNotExist(err):
+			return fmt.Errorf("failed to read existing file %s: %w", f.Path, err)
+		}
+
+		if entry.Action == ActionModified {
+			write, err := allowOverwrite(policy, f.Path, opts.Confirm)
+			if err != nil {
+				return err
+			}
+			if !write {
+				fmt.Printf("Skipped existing %s\n", f.Path)
+				continue
 			}
-			return writeParsedFilesToDir(destination, content)
+			if policy == OverwriteBackup {
+				backupPath, err := backupFile(f.Path, existing)
+				if err != nil {
+					return err
+				}
+				if entry.BackupPath, err = filepath.Abs(backupPath); err != nil {
+					return fmt.Errorf("failed to resolve %s: %w", backupPath, err)
+				}
+				fmt.Printf("Backed up %s to %s\n", f.Path, backupPath)
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", f.Path, err)
+		}
+		if err := os.WriteFile(f.Path, []byte(f.Content), 0644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", f.Path, err)
+		}
+		fmt.Printf("Written %s\n", f.Path)
+
+		if opts.Journal != nil {
+			entry.Checksum = Checksum(f.Content)
+			opts.Journal.Entries = append(opts.Journal.Entries, entry)
+		}
+	}
+	return nil
+}
+
+func allowOverwrite(policy OverwritePolicy, path string, confirm func(string) (bool, error)) (bool, error) {
+	switch policy {
+	case OverwriteNever:
+		return false, nil
+	case OverwritePrompt:
+		if confirm == nil {
+			return false, fmt.Errorf("overwrite policy prompt requires an interactive confirmation for %s", path)
 		}
+		return confirm(path)
+	default:
+		return true, nil
 	}
+}
 
-	// Otherwise treat as single file
-	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
-		return fmt.Errorf("failed to create directory for %s: %w", destination, err)
+// backupFile copies the current content of path to a timestamped sibling file.
+func backupFile(path string, content []byte) (string, error) {
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backupPath, content, 0644); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
 	}
+	return backupPath, nil
+}
+
+// Checksum returns the hex encoded sha256 of content.
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// JournalAction describes what a run did to a file.
+type JournalAction string
 
-	if err := os.WriteFile(destination, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write to %s: %w", destination, err)
+const (
+	ActionCreated  JournalAction = "created"
+	ActionModified JournalAction = "modified"
+)
+
+// JournalEntry records a single file written by a run.
+type JournalEntry struct {
+	Path             string        `json:"path"`
+	Action           JournalAction `json:"action"`
+	Checksum         string        `json:"checksum"`
+	PreviousChecksum string        `json:"previousChecksum,omitempty"`
+	PreviousContent  string        `json:"previousContent,omitempty"`
+	BackupPath       string        `json:"backupPath,omitempty"`
+}
+
+// Journal records what a single run wrote so that it can be undone.
+type Journal struct {
+	ID          string         `json:"id"`
+	Timestamp   time.Time      `json:"timestamp"`
+	Command     string         `json:"command"`
+	Destination string         `json:"destination"`
+	Entries     []JournalEntry `json:"entries"`
+	UndoneAt    *time.Time     `json:"undoneAt,omitempty"`
+}
+
+// NewJournal starts a journal for a run of command writing to destination.
+func NewJournal(command, destination string) *Journal {
+	now := time.Now()
+	return &Journal{
+		ID:          fmt.Sprintf("%s-%04x", now.Format("20060102-150405"), now.Nanosecond()&0xffff),
+		Timestamp:   now,
+		Command:     command,
+		Destination: destination,
+	}
+}
+
+// JournalDir returns the directory journals are stored in: K2N_JOURNAL_DIR or ~/.k2n/journal.
+func JournalDir() string {
+	if dir := os.Getenv("K2N_JOURNAL_DIR"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".k2n", "journal")
 	}
+	return filepath.Join(home, ".k2n", "journal")
+}
 
-	fmt.Printf("Result written to %s\n", destination)
+// Save writes the journal as <dir>/<id>.json. Journals without entries are not saved.
+func (j *Journal) Save(dir string) error {
+	if len(j.Entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create journal directory %s: %w", dir, err)
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+	path := filepath.Join(dir, j.ID+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write journal %s: %w", path, err)
+	}
 	return nil
 }
 
-// ParseGeneratedFiles splits AI-generated output into a map of filename -> content
-func ParseGeneratedFiles(output string) map[string]string {
-	parts := strings.Split(output, "---")
-	files := make(map[string]string)
+// LoadJournals reads all journals from dir, newest first. A missing directory
+// yields no journals.
+func LoadJournals(dir string) ([]*Journal, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory %s: %w", dir, err)
+	}
+
+	var journals []*Journal
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		j, err := LoadJournal(dir, strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		journals = append(journals, j)
+	}
+
+	sort.Slice(journals, func(a, b int) bool {
+		return journals[a].Timestamp.After(journals[b].Timestamp)
+	})
+	return journals, nil
+}
+
+// LoadJournal reads the journal with the given run id from dir.
+func LoadJournal(dir, id string) (*Journal, error) {
+	path := filepath.Join(dir, filepath.Base(id)+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %w", id, err)
+	}
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("failed to decode journal %s: %w", id, err)
+	}
+	return &j, nil
+}
+
+// LatestUndoableJournal returns the newest journal in dir that has not been undone.
+func LatestUndoableJournal(dir string) (*Journal, error) {
+	journals, err := LoadJournals(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range journals {
+		if j.UndoneAt == nil {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("no run to undo in %s", dir)
+}
+
+// CheckUndo lists files of the journal that were changed after the run wrote them.
+func CheckUndo(j *Journal) []string {
+	var conflicts []string
+	for _, e := range j.Entries {
+		data, err := os.ReadFile(e.Path)
+		switch {
+		case os.IsNotExist(err):
+			conflicts = append(conflicts, fmt.Sprintf("%s: deleted since run %s", e.Path, j.ID))
+		case err != nil:
+			conflicts = append(conflicts, fmt.Sprintf("%s: %v", e.Path, err))
+		case Checksum(string(data)) != e.Checksum:
+			conflicts = append(conflicts, fmt.Sprintf("%s: edited since run %s", e.Path, j.ID))
+		}
+	}
+	return conflicts
+}
+
+// UndoJournal rolls back a run: modified files get their previous content back
+// and created files are deleted. Unless force is set, the undo is refused if any
+// file was edited since the run. On success the journal is marked as undone in dir.
+func UndoJournal(dir string, j *Journal, force bool) error {
+	if j.UndoneAt != nil {
+		return fmt.Errorf("run %s was already undone at %s", j.ID, j.UndoneAt.Format(time.RFC3339))
+	}
+
+	if conflicts := CheckUndo(j); len(conflicts) > 0 && !force {
+		return fmt.Errorf("refusing to undo run %s, files changed since:\n  %s", j.ID, strings.Join(conflicts, "\n  "))
+	}
+
+	// Walk backwards so a file written twice in one run ends up in its original state.
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		e := j.Entries[i]
+		switch e.Action {
+		case ActionCreated:
+			if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", e.Path, err)
+			}
+			fmt.Printf("Removed %s\n", e.Path)
+		case ActionModified:
+			if err := os.WriteFile(e.Path, []byte(e.PreviousContent), 0644); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", e.Path, err)
+			}
+			fmt.Printf("Restored %s\n", e.Path)
+		}
+	}
+
+	now := time.Now()
+	j.UndoneAt = &now
+	return j.Save(dir)
+}
+
+// GeneratedFile is a single file parsed from AI output.
+type GeneratedFile struct {
+	Name    string `json:"name" yaml:"name"`
+	Content string `json:"content" yaml:"content"`
+}
+
+// FileHeaderPrefix starts the line that marks the beginning of a file in multi-file output.
+const FileHeaderPrefix = "# file: "
+
+var (
+	// fileHeaderRe matches the explicit file boundary "# file: path/name.yaml" (or "// file:").
+	fileHeaderRe = regexp.MustCompile(`^\s*(?:#|//)\s*file:\s*(\S.*?)\s*$`)
+	// fencedFileRe matches an opening code fence carrying a filename attribute,
+	// e.g. ```yaml file=path/name.yaml or ```hcl filename="main.tf".
+	fencedFileRe = regexp.MustCompile("^\\s*```[\\w.+-]*\\s+(?:file|filename|title|path)=[\"']?([^\"'\\s]+)[\"']?.*$")
+	fenceCloseRe = regexp.MustCompile("^\\s*```\\s*$")
+)
+
+// RenderGeneratedFiles joins files into output with a file header per file,
+// the format ParseGeneratedFiles reads.
+func RenderGeneratedFiles(files []GeneratedFile) string {
+	var parts []string
+	for _, f := range files {
+		parts = append(parts, FileHeaderPrefix+f.Name+"\n"+f.Content)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ParseGeneratedFiles splits AI-generated output into files, preserving the order
+// in which they appear. It understands, in this order of preference:
+//
+//   - "# file: path/name.yaml" header lines: everything up to the next header belongs
+//     to the file, so multi-document YAML separated by "---" stays intact
+//   - fenced code blocks with a filename attribute (```yaml file=path/name.yaml)
+//   - the legacy heuristic: split on "---" and use the first line of each part as name
+//
+// Files with the same name are merged in order of appearance.
+func ParseGeneratedFiles(output string) []GeneratedFile {
+	var files []GeneratedFile
+	switch {
+	case hasMatchingLine(output, fileHeaderRe):
+		files = parseFileHeaders(output)
+	case hasMatchingLine(output, fencedFileRe):
+		files = parseFencedFiles(output)
+	default:
+		files = parseDashSeparated(output)
+	}
+	return mergeDuplicateFiles(files)
+}
+
+func hasMatchingLine(output string, re *regexp.Regexp) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseFileHeaders(output string) []GeneratedFile {
+	var files []GeneratedFile
+	var current *GeneratedFile
+	var body []string
+
+	flush := func() {
+		if current != nil {
+			current.Content = trimDocumentMarkers(strings.Join(body, "\n"))
+			files = append(files, *current)
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if m := fileHeaderRe.FindStringSubmatch(line); m != nil {
+			flush()
+			current = &GeneratedFile{Name: sanitizeFilename(m[1])}
+			body = nil
+			continue
+		}
+		if current != nil {
+			body = append(body, line)
+		}
+	}
+	flush()
+
+	return files
+}
+
+func parseFencedFiles(output string) []GeneratedFile {
+	var files []GeneratedFile
+	var current *GeneratedFile
+	var body []string
 
-	for _, part := range parts {
+	for _, line := range strings.Split(output, "\n") {
+		if current == nil {
+			if m := fencedFileRe.FindStringSubmatch(line); m != nil {
+				current = &GeneratedFile{Name: sanitizeFilename(m[1])}
+				body = nil
+			}
+			continue
+		}
+		if fenceCloseRe.MatchString(line) {
+			current.Content = trimDocumentMarkers(strings.Join(body, "\n"))
+			files = append(files, *current)
+			current = nil
+			continue
+		}
+		body = append(body, line)
+	}
+	if current != nil {
+		current.Content = trimDocumentMarkers(strings.Join(body, "\n"))
+		files = append(files, *current)
+	}
+
+	return files
+}
+
+func parseDashSeparated(output string) []GeneratedFile {
+	var files []GeneratedFile
+	for _, part := range strings.Split(output, "---") {
 		lines := strings.SplitN(strings.TrimSpace(part), "\n", 2)
 		if len(lines) < 2 {
 			continue
 		}
-		filename := sanitizeFilename(lines[0])
-		content := strings.TrimSpace(lines[1])
-		files[filename] = content
+		files = append(files, GeneratedFile{
+			Name:    sanitizeFilename(lines[0]),
+			Content: strings.TrimSpace(lines[1]),
+		})
 	}
-
 	return files
 }
 
-func writeParsedFilesToDir(destination, content string) error {
-	parsedFiles := ParseGeneratedFiles(content)
-	for filename, fileContent := range parsedFiles {
-		fullPath := filepath.Join(destination, filename)
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			return fmt.Errorf("failed to create directory for %s: %w", fullPath, err)
+// trimDocumentMarkers removes surrounding whitespace and leading or trailing "---"
+// lines the model placed between files, keeping separators inside the file.
+func trimDocumentMarkers(content string) string {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "---" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// mergeDuplicateFiles joins files with the same name at the position of the first
+// occurrence. YAML files are joined as separate documents.
+func mergeDuplicateFiles(files []GeneratedFile) []GeneratedFile {
+	index := make(map[string]int)
+	var merged []GeneratedFile
+	for _, f := range files {
+		if f.Name == "" {
+			continue
 		}
-		if err := os.WriteFile(fullPath, []byte(fileContent), 0644); err != nil {
-			return fmt.Errorf("failed to write file %s: %w", fullPath, err)
+		i, seen := index[f.Name]
+		if !seen {
+			index[f.Name] = len(merged)
+			merged = append(merged, f)
+			continue
 		}
-		fmt.Printf("Written %s\n", fullPath)
+		separator := "\n\n"
+		if ext := strings.ToLower(filepath.Ext(f.Name)); ext == ".yaml" || ext == ".yml" {
+			separator = "\n---\n"
+		}
+		merged[i].Content += separator + f.Content
 	}
-	return nil
+	return merged
 }
 
 func sanitizeFilename(name string) string {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -109,3 +110,285 @@ func TestSanitizeFilename(t *testing.T) {
 		}
 	}
 }
+
+func TestSafeJoin(t *testing.T) {
+	root := t.TempDir()
+
+	if _, err := SafeJoin(root, "sub/ok.yaml"); err != nil {
+		t.Errorf("expected nested path to be allowed, got %v", err)
+	}
+
+	for _, name := range []string{"../../etc/x", "../x.yaml", "sub/../../x.yaml", "/etc/passwd"} {
+		if _, err := SafeJoin(root, name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if _, err := SafeJoin(root, "link/x.yaml"); err == nil {
+		t.Error("expected path through symlink leaving root to be rejected")
+	}
+}
+
+func TestSaveOutputRejectsTraversal(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "\n# ../../escaped.yaml\nkind: Bad\n"
+	if err := SaveOutput(dest, content); err == nil {
+		t.Fatal("expected error for path escaping destination")
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped.yaml")); !os.IsNotExist(err) {
+		t.Error("file outside destination must not be written")
+	}
+}
+
+func TestWriteOutputFilesPolicies(t *testing.T) {
+	newFile := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "f.yaml")
+		if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	read := func(path string) string {
+		data, _ := os.ReadFile(path)
+		return string(data)
+	}
+
+	t.Run("never", func(t *testing.T) {
+		path := newFile(t)
+		if err := WriteOutputFiles([]OutputFile{{path, "new"}}, OutputOptions{Policy: OverwriteNever}); err != nil {
+			t.Fatal(err)
+		}
+		if read(path) != "old" {
+			t.Error("existing file must not be overwritten")
+		}
+	})
+
+	t.Run("prompt", func(t *testing.T) {
+		path := newFile(t)
+		asked := ""
+		confirm := func(p string) (bool, error) { asked = p; return false, nil }
+		if err := WriteOutputFiles([]OutputFile{{path, "new"}}, OutputOptions{Policy: OverwritePrompt, Confirm: confirm}); err != nil {
+			t.Fatal(err)
+		}
+		if asked != path || read(path) != "old" {
+			t.Errorf("expected prompt for %s and rejected write, asked=%q content=%q", path, asked, read(path))
+		}
+	})
+
+	t.Run("backup with journal", func(t *testing.T) {
+		path := newFile(t)
+		created := filepath.Join(filepath.Dir(path), "created.yaml")
+		journal := NewJournal("k2n gen", filepath.Dir(path))
+
+		files := []OutputFile{{path, "new"}, {created, "fresh"}}
+		if err := WriteOutputFiles(files, OutputOptions{Policy: OverwriteBackup, Journal: journal}); err != nil {
+			t.Fatal(err)
+		}
+		if read(path) != "new" {
+			t.Error("expected file to be overwritten")
+		}
+		if len(journal.Entries) != 2 {
+			t.Fatalf("expected 2 journal entries, got %d", len(journal.Entries))
+		}
+		modified := journal.Entries[0]
+		if modified.Action != ActionModified || modified.PreviousContent != "old" || read(modified.BackupPath) != "old" {
+			t.Errorf("unexpected journal entry for modified file: %+v", modified)
+		}
+		if journal.Entries[1].Action != ActionCreated || journal.Entries[1].Checksum != Checksum("fresh") {
+			t.Errorf("unexpected journal entry for created file: %+v", journal.Entries[1])
+		}
+
+		dir := t.TempDir()
+		if err := journal.Save(dir); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, journal.ID+".json")); err != nil {
+			t.Errorf("expected journal file: %v", err)
+		}
+	})
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	if p, err := ParseOverwritePolicy(""); err != nil || p != OverwriteAlways {
+		t.Errorf("expected default always, got %q (%v)", p, err)
+	}
+	if p, err := ParseOverwritePolicy("Backup"); err != nil || p != OverwriteBackup {
+		t.Errorf("expected backup, got %q (%v)", p, err)
+	}
+	if _, err := ParseOverwritePolicy("sometimes"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestUndoJournal(t *testing.T) {
+	dest := t.TempDir()
+	journalDir := t.TempDir()
+
+	existing := filepath.Join(dest, "existing.yaml")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dest, "created.yaml")
+
+	journal := NewJournal("k2n gen", dest)
+	files := []OutputFile{{existing, "new"}, {created, "fresh"}}
+	if err := WriteOutputFiles(files, OutputOptions{Journal: journal}); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Save(journalDir); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := LatestUndoableJournal(journalDir)
+	if err != nil || latest.ID != journal.ID {
+		t.Fatalf("expected latest journal %s, got %v (%v)", journal.ID, latest, err)
+	}
+
+	// An edit after the run blocks the undo.
+	if err := os.WriteFile(created, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := UndoJournal(journalDir, latest, false); err == nil {
+		t.Fatal("expected undo to be refused for edited file")
+	}
+	if err := os.WriteFile(created, []byte("fresh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UndoJournal(journalDir, latest, false); err != nil {
+		t.Fatalf("UndoJournal returned error: %v", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "old" {
+		t.Errorf("expected existing file restored, got %q", data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("expected created file to be removed")
+	}
+
+	reloaded, err := LoadJournal(journalDir, journal.ID)
+	if err != nil || reloaded.UndoneAt == nil {
+		t.Fatalf("expected journal to be marked undone, got %v (%v)", reloaded, err)
+	}
+	if _, err := LatestUndoableJournal(journalDir); err == nil {
+		t.Error("expected no undoable run left")
+	}
+}
+
+func TestUndoJournalFromOtherDir(t *testing.T) {
+	root := t.TempDir()
+	journalDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "out"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "out", "existing.yaml"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write with relative paths, as ResolveOutputFiles returns for a relative destination.
+	t.Chdir(root)
+	journal := NewJournal("k2n gen", "out")
+	files := []OutputFile{{filepath.Join("out", "existing.yaml"), "new"}, {filepath.Join("out", "created.yaml"), "fresh"}}
+	if err := WriteOutputFiles(files, OutputOptions{Journal: journal}); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range journal.Entries {
+		if !filepath.IsAbs(e.Path) {
+			t.Errorf("journal path %s is not absolute", e.Path)
+		}
+	}
+	if err := journal.Save(journalDir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Chdir(t.TempDir())
+	latest, err := LatestUndoableJournal(journalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflicts := CheckUndo(latest); len(conflicts) != 0 {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+	if err := UndoJournal(journalDir, latest, false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "out", "existing.yaml")); string(data) != "old" {
+		t.Errorf("expected existing file restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(root, "out", "created.yaml")); !os.IsNotExist(err) {
+		t.Error("expected created file to be removed")
+	}
+}
+
+func TestParseGeneratedFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []GeneratedFile
+	}{
+		{
+			name: "file headers keep multi-document YAML",
+			input: `# file: apps/b.yaml
+apiVersion: v1
+kind: Namespace
+---
+apiVersion: v1
+kind: ConfigMap
+---
+# file: a.yaml
+kind: Secret
+`,
+			expected: []GeneratedFile{
+				{Name: "apps/b.yaml", Content: "apiVersion: v1\nkind: Namespace\n---\napiVersion: v1\nkind: ConfigMap"},
+				{Name: "a.yaml", Content: "kind: Secret"},
+			},
+		},
+		{
+			name: "duplicate headers are merged",
+			input: `# file: x.yaml
+kind: A
+# file: y.tf
+resource "a" "b" {}
+# file: x.yaml
+kind: B
+`,
+			expected: []GeneratedFile{
+				{Name: "x.yaml", Content: "kind: A\n---\nkind: B"},
+				{Name: "y.tf", Content: `resource "a" "b" {}`},
+			},
+		},
+		{
+			name:  "fenced blocks with filename attribute",
+			input: "Here you go:\n```yaml file=claims/runner.yaml\nkind: GithubRunner\n---\nkind: Secret\n```\n\n```hcl filename=\"main.tf\"\nterraform {}\n```\n",
+			expected: []GeneratedFile{
+				{Name: "claims/runner.yaml", Content: "kind: GithubRunner\n---\nkind: Secret"},
+				{Name: "main.tf", Content: "terraform {}"},
+			},
+		},
+		{
+			name:  "legacy heuristic fallback",
+			input: "\n# one.yaml\nkind: One\n---\n# two.yaml\nkind: Two\n",
+			expected: []GeneratedFile{
+				{Name: "one.yaml", Content: "kind: One"},
+				{Name: "two.yaml", Content: "kind: Two"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseGeneratedFiles(tt.input)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseGeneratedFiles() = %#v, want %#v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+)
+
+// ChangeType classifies how a planned file relates to what is on disk.
+type ChangeType string
+
+const (
+	ChangeAdded     ChangeType = "added"
+	ChangeModified  ChangeType = "modified"
+	ChangeUnchanged ChangeType = "unchanged"
+	ChangeRemoved   ChangeType = "removed"
+)
+
+// FileChange describes the effect writing one output file would have.
+type FileChange struct {
+	Path       string
+	Type       ChangeType
+	OldContent string
+	NewContent string
+}
+
+// PlanOutput compares the files SaveOutput would write for destination against
+// the current state on disk without writing anything.
+func PlanOutput(destination, content string) ([]FileChange, error) {
+	if destination == "" {
+		return nil, fmt.Errorf("planning requires a destination")
+	}
+
+	files, err := ResolveOutputFiles(destination, content)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	for _, f := range files {
+		change := FileChange{Path: f.Path, NewContent: f.Content}
+
+		existing, err := os.ReadFile(f.Path)
+		switch {
+		case os.IsNotExist(err):
+			change.Type = ChangeAdded
+		case err != nil:
+			return nil, fmt.Errorf("failed to read %s: %w", f.Path, err)
+		case string(existing) == f.Content:
+			change.Type = ChangeUnchanged
+			change.OldContent = string(existing)
+		default:
+			change.Type = ChangeModified
+			change.OldContent = string(existing)
+		}
+
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// Diff renders the change as a unified diff. Unchanged files yield an empty string.
+func (c FileChange) Diff() string {
+	oldName := "a/" + c.Path
+	if c.Type == ChangeAdded {
+		oldName = "/dev/null"
+	}
+	return UnifiedDiff(oldName, "b/"+c.Path, c.OldContent, c.NewContent, 3)
+}
+
+// SummarizePlan counts the changes per type.
+func SummarizePlan(changes []FileChange) map[ChangeType]int {
+	summary := map[ChangeType]int{
+		ChangeAdded:     0,
+		ChangeModified:  0,
+		ChangeUnchanged: 0,
+	}
+	for _, c := range changes {
+		summary[c.Type]++
+	}
+	return summary
+}
+
+// ApplyChanges writes all added and modified files. Unchanged files are skipped.
+func ApplyChanges(changes []FileChange, opts OutputOptions) error {
+	var files []OutputFile
+	for _, c := range changes {
+		if c.Type == ChangeUnchanged {
+			continue
+		}
+		files = append(files, OutputFile{Path: c.Path, Content: c.NewContent})
+	}
+	return WriteOutputFiles(files, opts)
+}
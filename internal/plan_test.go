@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanOutput(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "same.yaml"), []byte("kind: Same"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "changed.yaml"), []byte("kind: Old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := `
+# same.yaml
+kind: Same
+---
+# changed.yaml
+kind: New
+---
+# added.yaml
+kind: Added
+`
+	changes, err := PlanOutput(dir, content)
+	if err != nil {
+		t.Fatalf("PlanOutput returned error: %v", err)
+	}
+
+	types := map[string]ChangeType{}
+	for _, c := range changes {
+		types[filepath.Base(c.Path)] = c.Type
+	}
+	expected := map[string]ChangeType{
+		"same.yaml":    ChangeUnchanged,
+		"changed.yaml": ChangeModified,
+		"added.yaml":   ChangeAdded,
+	}
+	for name, want := range expected {
+		if types[name] != want {
+			t.Errorf("%s: expected %s, got %s", name, want, types[name])
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "added.yaml")); !os.IsNotExist(err) {
+		t.Error("planning must not write files")
+	}
+
+	summary := SummarizePlan(changes)
+	if summary[ChangeAdded] != 1 || summary[ChangeModified] != 1 || summary[ChangeUnchanged] != 1 {
+		t.Errorf("unexpected summary: %v", summary)
+	}
+
+	if err := ApplyChanges(changes, OutputOptions{}); err != nil {
+		t.Fatalf("ApplyChanges returned error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "changed.yaml"))
+	if err != nil || string(data) != "kind: New" {
+		t.Errorf("expected changed.yaml to be updated, got %q (%v)", data, err)
+	}
+}
+
+func TestPlanOutputRequiresDestination(t *testing.T) {
+	if _, err := PlanOutput("", "x"); err == nil {
+		t.Error("expected error for empty destination")
+	}
+}
@@ -0,0 +1,359 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PostProcess configures deterministic changes to the Kubernetes objects of
+// the output, applied after generation so the result does not depend on what
+// the model remembered. It is set in the postprocess section of structured
+// rulesets, usually in the usecase layer:
+//
+//	kind: Ruleset
+//	name: crossplane
+//	postprocess:
+//	  namespace: crossplane-system  # injected where missing
+//	  labels:                       # added where missing
+//	    team: platform
+//	  annotations: {}
+//	  stripEmpty: true              # remove null values and empty lists
+//	  normalize: true               # canonical key order, two-space indentation
+//	  separators: true              # split objects pasted without ---
+//	  clusterScopedKinds: [Provider] # never get a namespace
+type PostProcess struct {
+	Namespace          string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations        map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	StripEmpty         *bool             `json:"stripEmpty,omitempty" yaml:"stripEmpty,omitempty"`
+	Normalize          *bool             `json:"normalize,omitempty" yaml:"normalize,omitempty"`
+	Separators         *bool             `json:"separators,omitempty" yaml:"separators,omitempty"`
+	ClusterScopedKinds []string          `json:"clusterScopedKinds,omitempty" yaml:"clusterScopedKinds,omitempty"`
+}
+
+// ClusterScopedKinds are kinds that never get a namespace injected.
+var ClusterScopedKinds = []string{
+	"APIService", "ClusterIssuer", "ClusterRole", "ClusterRoleBinding",
+	"CompositeResourceDefinition", "Composition", "Configuration",
+	"CSIDriver", "CustomResourceDefinition", "Function", "IngressClass",
+	"MutatingWebhookConfiguration", "Namespace", "Node", "PersistentVolume",
+	"PriorityClass", "Provider", "RuntimeClass", "StorageClass",
+	"ValidatingWebhookConfiguration",
+}
+
+// Merge returns p with the values set in other. Labels and annotations are
+// merged key by key, cluster-scoped kinds are combined.
+func (p PostProcess) Merge(other PostProcess) PostProcess {
+	if other.Namespace != "" {
+		p.Namespace = other.Namespace
+	}
+	p.Labels = mergeStringMaps(p.Labels, other.Labels)
+	p.Annotations = mergeStringMaps(p.Annotations, other.Annotations)
+	if other.StripEmpty != nil {
+		p.StripEmpty = other.StripEmpty
+	}
+	if other.Normalize != nil {
+		p.Normalize = other.Normalize
+	}
+	if other.Separators != nil {
+		p.Separators = other.Separators
+	}
+	for _, k := range other.ClusterScopedKinds {
+		if !containsFold(p.ClusterScopedKinds, k) {
+			p.ClusterScopedKinds = append(p.ClusterScopedKinds, k)
+		}
+	}
+	return p
+}
+
+func mergeStringMaps(a, b map[string]string) map[string]string {
+	if len(b) == 0 {
+		return a
+	}
+	merged := map[string]string{}
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		merged[k] = v
+	}
+	return merged
+}
+
+// PostProcessSettings merges the postprocess sections of the rulesets, which
+// are ordered by layer, so higher layers win.
+func PostProcessSettings(rulesets []*StructuredRuleset) PostProcess {
+	var p PostProcess
+	for _, rs := range rulesets {
+		if rs.PostProcess != nil {
+			p = p.Merge(*rs.PostProcess)
+		}
+	}
+	return p
+}
+
+// Empty reports whether no step is configured.
+func (p PostProcess) Empty() bool {
+	return p.Namespace == "" && len(p.Labels) == 0 && len(p.Annotations) == 0 &&
+		!isSet(p.StripEmpty) && !isSet(p.Normalize) && !isSet(p.Separators)
+}
+
+func isSet(b *bool) bool {
+	return b != nil && *b
+}
+
+// PostProcessChange is a change made by a post-processing step.
+type PostProcessChange struct {
+	File     string `json:"file" yaml:"file"`
+	Document int    `json:"document,omitempty" yaml:"document,omitempty"`
+	Step     string `json:"step" yaml:"step"`
+	Detail   string `json:"detail" yaml:"detail"`
+}
+
+func (c PostProcessChange) String() string {
+	where := c.File
+	if c.Document > 0 {
+		where = fmt.Sprintf("%s (document %d)", c.File, c.Document)
+	}
+	return fmt.Sprintf("%s: %s: %s", where, c.Step, c.Detail)
+}
+
+// PostProcessOutput runs the configured steps on every YAML file of the output
+// in a fixed order: separators, stripEmpty, namespace, labels, annotations and
+// normalize. Only Kubernetes objects are changed; other documents, files that
+// are not YAML and files that fail to parse are left as they are.
+func PostProcessOutput(output string, p PostProcess) (string, []PostProcessChange) {
+	if p.Empty() {
+		return output, nil
+	}
+	files := ParseGeneratedFiles(output)
+	var changes []PostProcessChange
+	changed := false
+
+	for i, f := range files {
+		if !isYAMLPath(f.Name) {
+			continue
+		}
+		content := f.Content
+		if isSet(p.Separators) {
+			var n int
+			content, n = ensureSeparators(content)
+			if n > 0 {
+				changes = append(changes, PostProcessChange{File: f.Name, Step: "separators", Detail: fmt.Sprintf("inserted %d document separator(s)", n)})
+			}
+		}
+		docs, err := decodeYAMLDocuments(content)
+		if err != nil {
+			continue // reported by ValidateYAML
+		}
+
+		fileChanged := content != f.Content
+		for d, doc := range docs {
+			obj, ok := objectOf(doc)
+			if !ok {
+				continue
+			}
+			record := func(step, format string, a ...any) {
+				c := PostProcessChange{File: f.Name, Step: step, Detail: fmt.Sprintf(format, a...)}
+				if len(docs) > 1 {
+					c.Document = d + 1
+				}
+				changes = append(changes, c)
+				fileChanged = true
+			}
+
+			if isSet(p.StripEmpty) {
+				var removed []string
+				stripEmpty(doc, "", &removed)
+				for _, path := range removed {
+					record("stripEmpty", "removed empty %s", path)
+				}
+			}
+			metadata := mappingValue(doc, "metadata")
+			if p.Namespace != "" && obj.Namespace == "" && !p.clusterScoped(obj.Kind) {
+				setMappingValue(metadata, "namespace", scalarNode(p.Namespace))
+				record("namespace", "set metadata.namespace to %s", p.Namespace)
+			}
+			for _, k := range sortedStringKeys(p.Labels) {
+				if addMissing(metadata, "labels", k, p.Labels[k]) {
+					record("labels", "added label %s=%s", k, p.Labels[k])
+				}
+			}
+			for _, k := range sortedStringKeys(p.Annotations) {
+				if addMissing(metadata, "annotations", k, p.Annotations[k]) {
+					record("annotations", "added annotation %s=%s", k, p.Annotations[k])
+				}
+			}
+			if isSet(p.Normalize) && normalizeKeyOrder(doc) {
+				record("normalize", "sorted keys")
+			}
+		}
+
+		// Normalizing rewrites every file with objects in the same style.
+		if fileChanged || isSet(p.Normalize) {
+			encoded, err := encodeYAMLDocuments(docs)
+			if err != nil {
+				continue
+			}
+			if encoded != strings.TrimSpace(f.Content) {
+				files[i].Content = encoded
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return output, changes
+	}
+	return RenderGeneratedFiles(files), changes
+}
+
+func (p PostProcess) clusterScoped(kind string) bool {
+	return containsFold(ClusterScopedKinds, kind) || containsFold(p.ClusterScopedKinds, kind)
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// addMissing sets key in the map field of metadata unless it is set already.
+func addMissing(metadata *yaml.Node, field, key, value string) bool {
+	m := mappingValue(metadata, field)
+	if m == nil || m.Kind != yaml.MappingNode {
+		m = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setMappingValue(metadata, field, m)
+	}
+	if mappingValue(m, key) != nil {
+		return false
+	}
+	setMappingValue(m, key, scalarNode(value))
+	return true
+}
+
+// stripEmpty removes null values and empty lists below n, and mappings that
+// are empty after that. An empty string or a {} written as such is kept:
+// storageClassName: "" and emptyDir: {} mean something to Kubernetes.
+func stripEmpty(n *yaml.Node, path string, removed *[]string) {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			stripEmpty(item, fmt.Sprintf("%s[%d]", path, i), removed)
+		}
+	case yaml.MappingNode:
+		var kept []*yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			p := key.Value
+			if path != "" {
+				p = path + "." + key.Value
+			}
+			hadContent := len(value.Content) > 0
+			stripEmpty(value, p, removed)
+			empty := false
+			switch value.Kind {
+			case yaml.ScalarNode:
+				empty = value.Tag == "!!null"
+			case yaml.SequenceNode:
+				empty = len(value.Content) == 0
+			case yaml.MappingNode:
+				empty = hadContent && len(value.Content) == 0
+			}
+			if empty {
+				*removed = append(*removed, p)
+				continue
+			}
+			kept = append(kept, key, value)
+		}
+		n.Content = kept
+	}
+}
+
+// Canonical key orders; keys not listed follow in alphabetical order at the
+// top level and in their original order in metadata.
+var (
+	topLevelKeyOrder = []string{"apiVersion", "kind", "metadata", "spec", "data", "stringData", "type"}
+	metadataKeyOrder = []string{"name", "generateName", "namespace", "labels", "annotations"}
+)
+
+// normalizeKeyOrder puts the keys of an object and its metadata in canonical
+// order and sorts labels and annotations. It reports whether anything moved.
+func normalizeKeyOrder(doc *yaml.Node) bool {
+	moved := sortMapping(doc, topLevelKeyOrder, true)
+	if metadata := mappingValue(doc, "metadata"); metadata != nil && metadata.Kind == yaml.MappingNode {
+		moved = sortMapping(metadata, metadataKeyOrder, false) || moved
+		for _, field := range []string{"labels", "annotations"} {
+			if m := mappingValue(metadata, field); m != nil && m.Kind == yaml.MappingNode {
+				moved = sortMapping(m, nil, true) || moved
+			}
+		}
+	}
+	return moved
+}
+
+// sortMapping orders the keys of m by their position in order, then
+// alphabetically or in their original order.
+func sortMapping(m *yaml.Node, order []string, alphabetical bool) bool {
+	type pair struct{ key, value *yaml.Node }
+	pairs := make([]pair, 0, len(m.Content)/2)
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		pairs = append(pairs, pair{m.Content[i], m.Content[i+1]})
+	}
+	rank := func(key string) int {
+		for i, k := range order {
+			if k == key {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		ra, rb := rank(pairs[a].key.Value), rank(pairs[b].key.Value)
+		if ra != rb {
+			return ra < rb
+		}
+		return alphabetical && pairs[a].key.Value < pairs[b].key.Value
+	})
+
+	moved := false
+	for i, p := range pairs {
+		if m.Content[2*i] != p.key {
+			moved = true
+		}
+		m.Content[2*i], m.Content[2*i+1] = p.key, p.value
+	}
+	return moved
+}
+
+var topLevelObjectKey = regexp.MustCompile(`^(apiVersion|kind):`)
+
+// ensureSeparators inserts --- where a top-level apiVersion or kind repeats
+// within a document, i.e. where the model pasted objects without separator.
+func ensureSeparators(content string) (string, int) {
+	lines := strings.Split(content, "\n")
+	var out []string
+	seen := map[string]bool{}
+	inserted := 0
+	for _, line := range lines {
+		if strings.TrimRight(line, " \t\r") == "---" || strings.HasPrefix(line, "--- ") {
+			seen = map[string]bool{}
+		} else if m := topLevelObjectKey.FindStringSubmatch(line); m != nil {
+			if seen[m[1]] {
+				out = append(out, "---")
+				inserted++
+				seen = map[string]bool{}
+			}
+			seen[m[1]] = true
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n"), inserted
+}
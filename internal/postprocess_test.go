@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func postProcessFile(t *testing.T, output, name string) string {
+	t.Helper()
+	for _, f := range ParseGeneratedFiles(output) {
+		if f.Name == name {
+			return strings.TrimSpace(f.Content)
+		}
+	}
+	t.Fatalf("no file %s in\n%s", name, output)
+	return ""
+}
+
+func TestPostProcessOutput(t *testing.T) {
+	output := `# file: runner.yaml
+spec:
+  repository: ansible
+  labels: []
+  volumes:
+    - name: cache
+      emptyDir: {}
+  storageClassName: ""
+  extra:
+    removed: null
+metadata:
+  labels:
+    team: own
+  name: runner
+kind: GithubRunner
+apiVersion: resources.stuttgart-things.com/v1alpha1
+# file: values.yaml
+replicas: null
+`
+	p := PostProcess{
+		Namespace:   "crossplane-system",
+		Labels:      map[string]string{"team": "platform", "app": "runner"},
+		Annotations: map[string]string{"owner": "k2n"},
+		StripEmpty:  boolPtr(true),
+		Normalize:   boolPtr(true),
+	}
+	out, changes := PostProcessOutput(output, p)
+
+	want := `apiVersion: resources.stuttgart-things.com/v1alpha1
+kind: GithubRunner
+metadata:
+  name: runner
+  namespace: crossplane-system
+  labels:
+    app: runner
+    team: own
+  annotations:
+    owner: k2n
+spec:
+  repository: ansible
+  volumes:
+    - name: cache
+      emptyDir: {}
+  storageClassName: ""`
+	if got := postProcessFile(t, out, "runner.yaml"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := postProcessFile(t, out, "values.yaml"); got != "replicas: null" {
+		t.Errorf("values.yaml changed: %s", got)
+	}
+
+	var steps []string
+	for _, c := range changes {
+		steps = append(steps, c.Step+" "+c.Detail)
+	}
+	wantSteps := []string{
+		"stripEmpty removed empty spec.labels",
+		"stripEmpty removed empty spec.extra.removed",
+		"stripEmpty removed empty spec.extra",
+		"namespace set metadata.namespace to crossplane-system",
+		"labels added label app=runner",
+		"annotations added annotation owner=k2n",
+		"normalize sorted keys",
+	}
+	if strings.Join(steps, "\n") != strings.Join(wantSteps, "\n") {
+		t.Errorf("got changes\n%s\nwant\n%s", strings.Join(steps, "\n"), strings.Join(wantSteps, "\n"))
+	}
+
+	// The pipeline is idempotent.
+	again, changes := PostProcessOutput(out, p)
+	if again != out || len(changes) != 0 {
+		t.Errorf("second run changed the output: %v", changes)
+	}
+}
+
+func TestPostProcessClusterScoped(t *testing.T) {
+	output := "# file: ns.yaml\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: shop\n---\napiVersion: pkg.crossplane.io/v1\nkind: Widget\nmetadata:\n  name: w\n"
+	p := PostProcess{Namespace: "crossplane-system", ClusterScopedKinds: []string{"widget"}}
+	out, changes := PostProcessOutput(output, p)
+	if out != output || len(changes) != 0 {
+		t.Errorf("cluster-scoped objects changed: %v\n%s", changes, out)
+	}
+
+	p.ClusterScopedKinds = nil
+	_, changes = PostProcessOutput(output, p)
+	if len(changes) != 1 || changes[0].Document != 2 || changes[0].String() != "ns.yaml (document 2): namespace: set metadata.namespace to crossplane-system" {
+		t.Errorf("got %v", changes)
+	}
+}
+
+func TestEnsureSeparators(t *testing.T) {
+	output := `# file: all.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+kind: Secret
+apiVersion: v1
+metadata:
+  name: b
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: c
+`
+	out, changes := PostProcessOutput(output, PostProcess{Separators: boolPtr(true)})
+	if len(changes) != 1 || changes[0].Detail != "inserted 1 document separator(s)" {
+		t.Errorf("got %v", changes)
+	}
+	content := postProcessFile(t, out, "all.yaml")
+	if strings.Count(content, "---") != 2 || !strings.Contains(content, "name: a\n---\nkind: Secret") {
+		t.Errorf("got\n%s", content)
+	}
+	if problems := ValidateYAML(out); len(problems) != 0 {
+		t.Errorf("still invalid: %v", problems)
+	}
+}
+
+func TestPostProcessSettings(t *testing.T) {
+	rulesets := []*StructuredRuleset{
+		{PostProcess: &PostProcess{Namespace: "org", Labels: map[string]string{"team": "a"}, Normalize: boolPtr(true)}},
+		{Kustomize: &KustomizeOptions{Namespace: "ignored"}},
+		{PostProcess: &PostProcess{Namespace: "crossplane-system", Normalize: boolPtr(false), ClusterScopedKinds: []string{"Widget"}}},
+	}
+	p := PostProcessSettings(rulesets)
+	if p.Namespace != "crossplane-system" || p.Labels["team"] != "a" || isSet(p.Normalize) || len(p.ClusterScopedKinds) != 1 {
+		t.Errorf("got %+v", p)
+	}
+	if (PostProcess{Normalize: boolPtr(false)}).Empty() != true || p.Empty() {
+		t.Error("Empty is wrong")
+	}
+
+	rs, err := ParseStructuredRuleset("crossplane.yaml", "kind: Ruleset\npostprocess:\n  namespace: crossplane-system\n  stripEmpty: true\n")
+	if err != nil || rs.PostProcess == nil || rs.PostProcess.Namespace != "crossplane-system" || !isSet(rs.PostProcess.StripEmpty) {
+		t.Errorf("got %+v, %v", rs, err)
+	}
+}
@@ -1,12 +1,27 @@
 package internal
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/pterm/pterm"
 	"github.com/pterm/pterm/putils"
 )
 
+// plainOutput suppresses decorative output such as the banner.
+var plainOutput bool
+
+// SetPlainOutput disables the banner and other decorative terminal output.
+func SetPlainOutput(plain bool) {
+	plainOutput = plain
+}
+
 // MAKE DYNAMIC
 func PrintBanner() {
+	if plainOutput {
+		return
+	}
+
 	ptermLogo, _ := pterm.DefaultBigText.WithLetters(
 		putils.LettersFromStringWithStyle("kaef", pterm.NewStyle(pterm.FgLightCyan)),
 		putils.LettersFromStringWithStyle("fken", pterm.NewStyle(pterm.FgLightMagenta)),
@@ -48,3 +63,40 @@ func PrintEnvTable(data map[string]string) error {
 		WithData(tableData).
 		Render()
 }
+
+// PrintPlan renders a colored unified diff for every added or modified file
+// followed by a summary of added, modified and unchanged files.
+func PrintPlan(changes []FileChange) {
+	for _, c := range changes {
+		if c.Type == ChangeUnchanged {
+			continue
+		}
+		PrintDiff(c.Diff())
+		fmt.Println()
+	}
+
+	summary := SummarizePlan(changes)
+	fmt.Printf("📋 Plan: %s, %s, %s\n",
+		pterm.Green(fmt.Sprintf("%d added", summary[ChangeAdded])),
+		pterm.Yellow(fmt.Sprintf("%d modified", summary[ChangeModified])),
+		pterm.Gray(fmt.Sprintf("%d unchanged", summary[ChangeUnchanged])),
+	)
+}
+
+// PrintDiff renders a unified diff with colored headers, hunks and lines.
+func PrintDiff(diff string) {
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Println(pterm.Bold.Sprint(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(pterm.Cyan(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(pterm.Green(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(pterm.Red(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
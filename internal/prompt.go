@@ -12,6 +12,17 @@ func BuildPrompt(
 	technology,
 	instruction string) string {
 
+	named := make([]Example, len(examples))
+	for i, ex := range examples {
+		named[i] = Example{Content: ex}
+	}
+	return BuildPromptFromExamples(named, nil, envRules, usecaseRules, technology, instruction)
+}
+
+// BuildPromptFromExamples builds the generation prompt. Every example is
+// introduced with its file name and description, if known. Reference context
+// gets its own section between the rules and the examples.
+func BuildPromptFromExamples(examples []Example, reference []ContextFile, envRules, usecaseRules []string, technology, instruction string) string {
 	var builder strings.Builder
 
 	tech := technology
@@ -20,8 +31,9 @@ func BuildPrompt(
 	}
 	builder.WriteString("You are a " + tech + " expert.\n\n")
 	builder.WriteString("General Output Formatting Rules:\n")
-	builder.WriteString("- add the marker three dashes.\n")
-	builder.WriteString("- add a potential file name as comment above the file (not a file path) e.g. playbook.yaml\n")
+	builder.WriteString("- Start every file with a header line '" + FileHeaderPrefix + "<name>' on its own line, e.g. '" + FileHeaderPrefix + "playbook.yaml'.\n")
+	builder.WriteString("- Use a relative file name; a sub directory is allowed (e.g. '" + FileHeaderPrefix + "apps/runner.yaml'), absolute paths and '..' are not.\n")
+	builder.WriteString("- Everything up to the next file header belongs to that file. Use '---' only to separate YAML documents within the same file.\n")
 	builder.WriteString("- Use '.yaml' as the extension for YAML files.\n")
 	builder.WriteString("- Do NOT include syntax highlighting or markdown code fences.\n\n")
 
@@ -41,12 +53,32 @@ func BuildPrompt(
 		builder.WriteString("\n")
 	}
 
+	builder.WriteString(ReferenceContextSection(reference))
+
 	builder.WriteString("Examples:\n")
 	for i, ex := range examples {
-		builder.WriteString(fmt.Sprintf("Example %d:\n%s\n\n", i+1, ex))
+		builder.WriteString(fmt.Sprintf("%s\n%s\n\n", ex.promptHeader(i+1), ex.Content))
 	}
 
 	builder.WriteString(fmt.Sprintf("Instruction:\n%s\n", instruction))
 
 	return builder.String()
 }
+
+// BuildRepairPrompt asks the model to fix its previous output. It repeats the
+// original prompt so the model keeps the full context, followed by the previous
+// answer and the problems found while validating it.
+func BuildRepairPrompt(originalPrompt, previousOutput string, problems []string) string {
+	var builder strings.Builder
+
+	builder.WriteString(originalPrompt)
+	builder.WriteString("\nYour previous answer was:\n")
+	builder.WriteString(previousOutput)
+	builder.WriteString("\n\nIt failed validation with the following problems:\n")
+	for _, p := range problems {
+		builder.WriteString("- " + p + "\n")
+	}
+	builder.WriteString("\nReturn the complete corrected output. Keep the same output format and fix only what is needed to resolve the problems.\n")
+
+	return builder.String()
+}
@@ -35,6 +35,9 @@ func TestBuildPrompt(t *testing.T) {
 	if !strings.Contains(prompt, examples[0]) || !strings.Contains(prompt, examples[1]) {
 		t.Error("Prompt missing examples")
 	}
+	if !strings.Contains(prompt, FileHeaderPrefix) {
+		t.Error("Prompt missing file header instruction")
+	}
 	if !strings.Contains(prompt, instruction) {
 		t.Error("Prompt missing instruction")
 	}
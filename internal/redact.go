@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces secrets in redacted text.
+const redactedValue = "***"
+
+// secretKey matches keys that look like they hold a secret.
+const secretKey = `(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret|private[_-]?key)[\w-]*`
+
+// secretAssignment matches key: value and key=value pairs whose key looks like
+// a secret. The value must be on the same line and must not open a flow
+// mapping or sequence, so a key holding a nested mapping is left alone.
+var secretAssignment = regexp.MustCompile(`(?i)(` + secretKey + `)(["']?[ \t]*[:=][ \t]*)(["']?[^\s"',{}\[][^\s"',}]*["']?)`)
+
+// secretBlockScalar matches a YAML key with a secret looking name whose value
+// is a block scalar (| or >) on the following, more indented lines.
+var secretBlockScalar = regexp.MustCompile(`(?i)^([ \t]*(?:-[ \t]+)?)["']?(` + secretKey + `)["']?[ \t]*:[ \t]*[|>][-+0-9]*[ \t]*(?:#.*)?$`)
+
+// blockIndicator is a block scalar header without its key.
+var blockIndicator = regexp.MustCompile(`^[|>][-+0-9]*$`)
+
+// secretReferenceSuffixes end keys that name or point to a secret instead of
+// holding it, like secretName or passwordSecretRef.
+var secretReferenceSuffixes = []string{"name", "namespace", "ref"}
+
+// isSecretReference reports whether a secret looking key names a secret
+// instead of holding it.
+func isSecretReference(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range secretReferenceSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretPatterns match secrets in free text. The first group is kept, the rest
+// of the match is replaced.
+var secretPatterns = []*regexp.Regexp{
+	// HTTP authorization headers
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{8,}`),
+	// well-known token formats: GitHub, OpenAI/OpenRouter, Google API keys, AWS access keys
+	regexp.MustCompile(`()\b(?:gh[pousr]_[A-Za-z0-9]{20,}|sk-[A-Za-z0-9-]{20,}|AIza[0-9A-Za-z_-]{35}|AKIA[0-9A-Z]{16})\b`),
+	// PEM private keys
+	regexp.MustCompile(`(-----BEGIN [A-Z ]*PRIVATE KEY-----)[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// RedactSecrets replaces values that look like credentials with "***", so text
+// can be stored or shown without leaking secrets.
+func RedactSecrets(text string) string {
+	text = redactBlockScalars(text)
+	text = secretAssignment.ReplaceAllStringFunc(text, func(match string) string {
+		parts := secretAssignment.FindStringSubmatch(match)
+		// Block scalars were handled above.
+		if isSecretReference(parts[1]) || blockIndicator.MatchString(parts[3]) {
+			return match
+		}
+		return parts[1] + parts[2] + redactedValue
+	})
+	for _, re := range secretPatterns {
+		text = re.ReplaceAllString(text, "${1}"+redactedValue)
+	}
+	return text
+}
+
+// redactBlockScalars replaces the lines of block scalars held by secret keys
+// with a single "***" line at the same indentation, so YAML stays valid.
+func redactBlockScalars(text string) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		out = append(out, lines[i])
+		m := secretBlockScalar.FindStringSubmatch(lines[i])
+		if m == nil || isSecretReference(m[2]) {
+			continue
+		}
+		// The block holds every following line that is blank or indented
+		// deeper than the key.
+		keyIndent := len(m[1])
+		end, indent := i+1, ""
+		for ; end < len(lines); end++ {
+			trimmed := strings.TrimLeft(lines[end], " \t")
+			if trimmed == "" {
+				continue
+			}
+			if len(lines[end])-len(trimmed) <= keyIndent {
+				break
+			}
+			if indent == "" {
+				indent = lines[end][:len(lines[end])-len(trimmed)]
+			}
+		}
+		// Trailing blank lines are not part of the value.
+		for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		if indent != "" {
+			out = append(out, indent+redactedValue)
+		}
+		i = end - 1
+	}
+	return strings.Join(out, "\n")
+}
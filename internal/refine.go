@@ -0,0 +1,391 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BuildRefinePrompt asks the model to modify an existing file according to the
+// instruction and to return the complete file, leaving everything else as it is.
+func BuildRefinePrompt(
+	name string,
+	content string,
+	envRules []string,
+	usecaseRules []string,
+	technology,
+	instruction string) string {
+
+	var builder strings.Builder
+
+	tech := technology
+	if tech == "" {
+		tech = "technology"
+	}
+	builder.WriteString("You are a " + tech + " expert editing an existing file.\n\n")
+	builder.WriteString("General Output Formatting Rules:\n")
+	builder.WriteString("- Return the complete modified file, starting with the header line '" + FileHeaderPrefix + filepath.Base(name) + "'.\n")
+	builder.WriteString("- Change only what the instruction asks for. Keep all other fields, their order, comments and formatting exactly as they are.\n")
+	builder.WriteString("- Do NOT include syntax highlighting, markdown code fences or explanations.\n\n")
+
+	if len(envRules) > 0 {
+		builder.WriteString("Environment Rules:\n")
+		for _, rule := range envRules {
+			builder.WriteString(rule + "\n---\n")
+		}
+		builder.WriteString("\n")
+	}
+
+	if len(usecaseRules) > 0 {
+		builder.WriteString("Use Case Rules:\n")
+		for _, rule := range usecaseRules {
+			builder.WriteString(rule + "\n---\n")
+		}
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString(fmt.Sprintf("Current content of %s:\n%s\n\n", filepath.Base(name), strings.TrimRight(content, "\n")))
+	builder.WriteString(fmt.Sprintf("Instruction:\n%s\n", instruction))
+
+	return builder.String()
+}
+
+// bareFenceRe matches an opening or closing code fence without a filename.
+var bareFenceRe = regexp.MustCompile("^\\s*```[\\w.+-]*\\s*$")
+
+// ExtractRefinedFile returns the content of the refined file from the model output.
+// Output with file headers or named fences must contain name or exactly one file;
+// anything else is taken as the file content itself. The trailing newline of the
+// original is kept.
+func ExtractRefinedFile(output, name, original string) (string, error) {
+	var content string
+
+	if hasMatchingLine(output, fileHeaderRe) || hasMatchingLine(output, fencedFileRe) {
+		files := ParseGeneratedFiles(output)
+		base := filepath.Base(name)
+		found := false
+		for _, f := range files {
+			if filepath.Base(f.Name) == base {
+				content, found = f.Content, true
+				break
+			}
+		}
+		if !found {
+			if len(files) != 1 {
+				return "", fmt.Errorf("expected the refined %s, got %d file(s)", base, len(files))
+			}
+			content = files[0].Content
+		}
+	} else {
+		var lines []string
+		for _, line := range strings.Split(output, "\n") {
+			if !bareFenceRe.MatchString(line) {
+				lines = append(lines, line)
+			}
+		}
+		content = strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+
+	if content == "" {
+		return "", fmt.Errorf("the refined %s is empty", filepath.Base(name))
+	}
+	if strings.HasSuffix(original, "\n") {
+		content += "\n"
+	}
+	return content, nil
+}
+
+// FixRefinedFile applies the structured rulesets in fix mode to the refined
+// content of the file name, as extracted by ExtractRefinedFile. It returns the
+// fixed content and the violations, all of which concern the refined file.
+func FixRefinedFile(content, name string, rulesets []*StructuredRuleset) (string, []RuleViolation) {
+	rendered := RenderGeneratedFiles([]GeneratedFile{{Name: filepath.Base(name), Content: content}})
+	fixed, violations := ApplyStructuredRulesets(rendered, rulesets, true)
+	files := ParseGeneratedFiles(fixed)
+	if fixed == rendered || len(files) != 1 {
+		return content, violations
+	}
+	fixedContent := files[0].Content
+	if strings.HasSuffix(content, "\n") && !strings.HasSuffix(fixedContent, "\n") {
+		fixedContent += "\n"
+	}
+	return fixedContent, violations
+}
+
+// YAMLChange is a structural difference between two YAML streams.
+type YAMLChange struct {
+	Path string
+	Type ChangeType
+	Old  string
+	New  string
+}
+
+// String renders the change on one line, e.g. "spec.version modified: 0.12.0 → 0.13.0".
+func (c YAMLChange) String() string {
+	if c.Path == "#" {
+		return fmt.Sprintf("comment removed: # %s", c.Old)
+	}
+	switch c.Type {
+	case ChangeAdded:
+		return fmt.Sprintf("%s added: %s", c.Path, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("%s removed: %s", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("%s modified: %s → %s", c.Path, c.Old, c.New)
+	}
+}
+
+// CompareYAML compares two YAML streams document by document and returns the
+// added, removed and modified values. Key order and formatting are ignored.
+// Removed comments are reported with a "#" path.
+func CompareYAML(oldContent, newContent string) ([]YAMLChange, error) {
+	oldDocs, err := decodeYAMLDocuments(oldContent)
+	if err != nil {
+		return nil, fmt.Errorf("original: %w", err)
+	}
+	newDocs, err := decodeYAMLDocuments(newContent)
+	if err != nil {
+		return nil, fmt.Errorf("refined: %w", err)
+	}
+
+	var changes []YAMLChange
+	for i := 0; i < len(oldDocs) || i < len(newDocs); i++ {
+		prefix := ""
+		if len(oldDocs) > 1 || len(newDocs) > 1 {
+			prefix = fmt.Sprintf("[doc %d]", i)
+		}
+		switch {
+		case i >= len(newDocs):
+			changes = append(changes, YAMLChange{Path: prefix, Type: ChangeRemoved, Old: summarizeNode(oldDocs[i])})
+		case i >= len(oldDocs):
+			changes = append(changes, YAMLChange{Path: prefix, Type: ChangeAdded, New: summarizeNode(newDocs[i])})
+		default:
+			compareYAMLNodes(prefix, oldDocs[i], newDocs[i], &changes)
+		}
+	}
+
+	newComments := map[string]bool{}
+	for _, doc := range newDocs {
+		for _, c := range collectComments(doc) {
+			newComments[c] = true
+		}
+	}
+	for _, doc := range oldDocs {
+		for _, c := range collectComments(doc) {
+			if !newComments[c] {
+				changes = append(changes, YAMLChange{Path: "#", Type: ChangeRemoved, Old: c})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+func decodeYAMLDocuments(content string) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+			docs = append(docs, doc.Content[0])
+		} else {
+			docs = append(docs, &doc)
+		}
+	}
+}
+
+func compareYAMLNodes(path string, a, b *yaml.Node, changes *[]YAMLChange) {
+	if a.Kind == yaml.AliasNode {
+		a = a.Alias
+	}
+	if b.Kind == yaml.AliasNode {
+		b = b.Alias
+	}
+
+	if a.Kind != b.Kind {
+		*changes = append(*changes, YAMLChange{Path: path, Type: ChangeModified, Old: summarizeNode(a), New: summarizeNode(b)})
+		return
+	}
+
+	switch a.Kind {
+	case yaml.MappingNode:
+		oldValues := mappingValues(a)
+		newValues := mappingValues(b)
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			key := a.Content[i].Value
+			if nv, ok := newValues[key]; ok {
+				compareYAMLNodes(joinYAMLPath(path, key), a.Content[i+1], nv, changes)
+			} else {
+				*changes = append(*changes, YAMLChange{Path: joinYAMLPath(path, key), Type: ChangeRemoved, Old: summarizeNode(a.Content[i+1])})
+			}
+		}
+		for i := 0; i+1 < len(b.Content); i += 2 {
+			key := b.Content[i].Value
+			if _, ok := oldValues[key]; !ok {
+				*changes = append(*changes, YAMLChange{Path: joinYAMLPath(path, key), Type: ChangeAdded, New: summarizeNode(b.Content[i+1])})
+			}
+		}
+	case yaml.SequenceNode:
+		for i := 0; i < len(a.Content) || i < len(b.Content); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(b.Content):
+				*changes = append(*changes, YAMLChange{Path: itemPath, Type: ChangeRemoved, Old: summarizeNode(a.Content[i])})
+			case i >= len(a.Content):
+				*changes = append(*changes, YAMLChange{Path: itemPath, Type: ChangeAdded, New: summarizeNode(b.Content[i])})
+			default:
+				compareYAMLNodes(itemPath, a.Content[i], b.Content[i], changes)
+			}
+		}
+	default:
+		if a.Value != b.Value || a.ShortTag() != b.ShortTag() {
+			*changes = append(*changes, YAMLChange{Path: path, Type: ChangeModified, Old: summarizeNode(a), New: summarizeNode(b)})
+		}
+	}
+}
+
+func mappingValues(n *yaml.Node) map[string]*yaml.Node {
+	values := make(map[string]*yaml.Node, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		values[n.Content[i].Value] = n.Content[i+1]
+	}
+	return values
+}
+
+func joinYAMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// summarizeNode renders scalars as their value and collections in flow style.
+func summarizeNode(n *yaml.Node) string {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value
+	}
+	flow := *n
+	flow.Style = yaml.FlowStyle
+	out, err := yaml.Marshal(&flow)
+	if err != nil {
+		return "<" + n.Tag + ">"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// collectComments returns the trimmed text of all comments in a node tree.
+func collectComments(n *yaml.Node) []string {
+	var comments []string
+	for _, c := range []string{n.HeadComment, n.LineComment, n.FootComment} {
+		for _, line := range strings.Split(c, "\n") {
+			if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#")); line != "" {
+				comments = append(comments, line)
+			}
+		}
+	}
+	for _, child := range n.Content {
+		comments = append(comments, collectComments(child)...)
+	}
+	return comments
+}
+
+var (
+	// wordRe splits an instruction into comparable words.
+	wordRe = regexp.MustCompile(`[A-Za-z0-9_.:/-]+`)
+	// pathSegmentRe splits a change path into its keys.
+	pathSegmentRe = regexp.MustCompile(`[.\[\]]+`)
+	// docPrefixRe matches the document prefix of paths in multi-document streams.
+	docPrefixRe = regexp.MustCompile(`^\[doc \d+\]\.?`)
+)
+
+// UnexpectedChanges returns the changes outside the requested area. A change is
+// expected if its path starts with one of the allowed dotted paths or, when no
+// paths are allowed explicitly, if the instruction mentions one of the path
+// segments or the new value. Removed comments are always unexpected.
+func UnexpectedChanges(changes []YAMLChange, instruction string, allowed []string) []YAMLChange {
+	mentioned := map[string]bool{}
+	for _, w := range wordRe.FindAllString(strings.ToLower(instruction), -1) {
+		mentioned[strings.Trim(w, ".:/-")] = true
+	}
+
+	var unexpected []YAMLChange
+	for _, c := range changes {
+		if c.Path != "#" && changeAllowed(c, mentioned, allowed) {
+			continue
+		}
+		unexpected = append(unexpected, c)
+	}
+	return unexpected
+}
+
+func changeAllowed(c YAMLChange, mentioned map[string]bool, allowed []string) bool {
+	path := docPrefixRe.ReplaceAllString(c.Path, "")
+	if len(allowed) > 0 {
+		for _, a := range allowed {
+			if path == a || strings.HasPrefix(path, a+".") || strings.HasPrefix(path, a+"[") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, segment := range pathSegmentRe.Split(path, -1) {
+		segment = strings.ToLower(segment)
+		if segment == "" {
+			continue
+		}
+		if mentioned[segment] {
+			return true
+		}
+		// Also match the words of camelCase or dashed keys, e.g. "replicas" in "maxReplicas".
+		for w := range mentioned {
+			if len(w) > 3 && strings.Contains(segment, w) {
+				return true
+			}
+		}
+	}
+	return c.New != "" && mentioned[strings.ToLower(c.New)]
+}
+
+// RefineValidator checks refined output against the original file. YAML files
+// must parse and may only change in the requested area; other files are not checked.
+func RefineValidator(name, original, instruction string, allowed []string) Validator {
+	return func(output string) []string {
+		refined, err := ExtractRefinedFile(output, name, original)
+		if err != nil {
+			return []string{err.Error()}
+		}
+		if ext := strings.ToLower(filepath.Ext(name)); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		changes, err := CompareYAML(original, refined)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: invalid YAML: %v", filepath.Base(name), err)}
+		}
+
+		var problems []string
+		for _, c := range UnexpectedChanges(changes, instruction, allowed) {
+			if c.Path == "#" {
+				problems = append(problems, fmt.Sprintf("comment removed, keep it: # %s", c.Old))
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("unexpected change outside the requested area, revert it: %s", c))
+		}
+		sort.Strings(problems)
+		return problems
+	}
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+const refineOriginal = `# app release
+apiVersion: v1
+kind: Release
+metadata:
+  name: app # the name
+spec:
+  version: 0.12.0
+  replicas: 2
+  ports: [80]
+`
+
+func TestBuildRefinePrompt(t *testing.T) {
+	prompt := BuildRefinePrompt("deploy/app.yaml", refineOriginal, []string{"env rule"}, nil, "kubernetes", "bump version")
+	for _, want := range []string{FileHeaderPrefix + "app.yaml", "Current content of app.yaml", "replicas: 2", "env rule", "Instruction:\nbump version"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt should contain %q", want)
+		}
+	}
+}
+
+func TestExtractRefinedFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{name: "file header", output: "# file: app.yaml\nkind: Release\n", want: "kind: Release\n"},
+		{name: "other file name", output: "# file: other.yaml\nkind: Release\n", want: "kind: Release\n"},
+		{name: "plain content in fence", output: "```yaml\nkind: Release\n```\n", want: "kind: Release\n"},
+		{name: "several files", output: "# file: a.yaml\na: 1\n# file: b.yaml\nb: 1\n", wantErr: true},
+		{name: "empty", output: "```\n```", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractRefinedFile(tt.output, "deploy/app.yaml", "kind: Old\n")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixRefinedFile(t *testing.T) {
+	rulesets := []*StructuredRuleset{mustParseRuleset(t, runnerRuleset)}
+	original := "kind: GithubRunner\nspec:\n  version: 1.0.0\n"
+	output := `# file: other.yaml
+kind: GithubRunner
+spec:
+  version: 1.0.0
+# file: claims/runner.yaml
+kind: GithubRunner
+metadata:
+  namespace: default
+spec:
+  version: 1.1.0
+`
+	refined, err := ExtractRefinedFile(output, "claims/runner.yaml", original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed, violations := FixRefinedFile(refined, "claims/runner.yaml", rulesets)
+	if strings.Contains(fixed, "namespace") || !strings.Contains(fixed, "group: stuttgart-things") || !strings.Contains(fixed, "version: 1.1.0") {
+		t.Errorf("rules not applied:\n%s", fixed)
+	}
+	if !strings.HasSuffix(fixed, "\n") || strings.Contains(fixed, "# file:") {
+		t.Errorf("unexpected content %q", fixed)
+	}
+	if len(violations) == 0 {
+		t.Fatal("expected fixes")
+	}
+	for _, v := range violations {
+		if !v.Fixed || v.File != "runner.yaml" {
+			t.Errorf("unexpected violation %s", v)
+		}
+	}
+
+	// Plain content is fixed as well, a file without violations is kept as is.
+	if fixed, _ := FixRefinedFile("kind: GithubRunner\nmetadata:\n  namespace: x\n", "runner.yaml", rulesets); strings.Contains(fixed, "namespace") {
+		t.Errorf("plain content not fixed:\n%s", fixed)
+	}
+	clean := "---\nkind: Other # comment\n"
+	if got, violations := FixRefinedFile(clean, "runner.yaml", rulesets); got != clean || len(violations) != 0 {
+		t.Errorf("got %q, %v", got, violations)
+	}
+}
+
+func TestCompareYAML(t *testing.T) {
+	refined := `apiVersion: v1
+kind: Release
+metadata:
+  namespace: prod
+  name: app # the name
+spec:
+  replicas: 3
+  version: 0.13.0
+  ports: [80, 443]
+`
+	changes, err := CompareYAML(refineOriginal, refined)
+	if err != nil {
+		t.Fatalf("CompareYAML returned error: %v", err)
+	}
+
+	got := map[string]ChangeType{}
+	for _, c := range changes {
+		got[c.Path] = c.Type
+	}
+	want := map[string]ChangeType{
+		"metadata.namespace": ChangeAdded,
+		"spec.version":       ChangeModified,
+		"spec.replicas":      ChangeModified,
+		"spec.ports[1]":      ChangeAdded,
+		"#":                  ChangeRemoved,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got changes %v, want %v", changes, want)
+	}
+	for path, typ := range want {
+		if got[path] != typ {
+			t.Errorf("%s: got %q, want %q", path, got[path], typ)
+		}
+	}
+
+	same, err := CompareYAML(refineOriginal, "apiVersion: v1\n# app release\nkind: Release\nspec: {ports: [80], replicas: 2, version: 0.12.0}\nmetadata:\n  name: app # the name\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(same) != 0 {
+		t.Errorf("reordering and restyling should not be a change, got %v", same)
+	}
+}
+
+func TestUnexpectedChanges(t *testing.T) {
+	changes := []YAMLChange{
+		{Path: "spec.version", Type: ChangeModified, Old: "0.12.0", New: "0.13.0"},
+		{Path: "metadata.namespace", Type: ChangeAdded, New: "prod"},
+		{Path: "spec.image", Type: ChangeModified, Old: "nginx:1.24", New: "nginx:1.25"},
+		{Path: "spec.replicas", Type: ChangeModified, Old: "2", New: "3"},
+		{Path: "#", Type: ChangeRemoved, Old: "app release"},
+	}
+
+	unexpected := UnexpectedChanges(changes, "Bump version to 0.13.0, add namespace and use nginx:1.25.", nil)
+	if len(unexpected) != 2 || unexpected[0].Path != "spec.replicas" || unexpected[1].Path != "#" {
+		t.Errorf("unexpected changes from instruction: %v", unexpected)
+	}
+
+	unexpected = UnexpectedChanges(changes, "anything", []string{"spec"})
+	if len(unexpected) != 2 || unexpected[0].Path != "metadata.namespace" {
+		t.Errorf("unexpected changes with allowed paths: %v", unexpected)
+	}
+}
+
+func TestRefineValidator(t *testing.T) {
+	validate := RefineValidator("app.yaml", refineOriginal, "bump version to 0.13.0", nil)
+
+	ok := "# file: app.yaml\n" + strings.Replace(refineOriginal, "0.12.0", "0.13.0", 1)
+	if problems := validate(ok); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+
+	bad := "# file: app.yaml\n" + strings.Replace(strings.Replace(refineOriginal, "0.12.0", "0.13.0", 1), "replicas: 2", "replicas: 5", 1)
+	problems := validate(bad)
+	if len(problems) != 1 || !strings.Contains(problems[0], "spec.replicas") {
+		t.Errorf("expected replicas problem, got %v", problems)
+	}
+
+	if problems := validate("# file: app.yaml\nkey: [unclosed\n"); len(problems) != 1 || !strings.Contains(problems[0], "invalid YAML") {
+		t.Errorf("expected invalid YAML problem, got %v", problems)
+	}
+}
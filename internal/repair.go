@@ -0,0 +1,65 @@
+package internal
+
+import "fmt"
+
+// RepairAttempt records the outcome of one generate/validate iteration.
+type RepairAttempt struct {
+	Iteration int
+	Problems  []string
+}
+
+// RepairResult is the final state of a generate → validate → repair loop.
+type RepairResult struct {
+	Output   string
+	Attempts []RepairAttempt
+	Passed   bool
+}
+
+// GenerateWithRepair calls the model with prompt, validates the answer and, while
+// validation fails, sends the problems back together with the previous output
+// asking for a fix. It stops once the output passes or after maxRepairs repair
+// rounds. logf receives one line per iteration and may be nil.
+func GenerateWithRepair(
+	prompt string,
+	maxRepairs int,
+	call func(prompt string) (string, error),
+	validate Validator,
+	logf func(format string, a ...any)) (*RepairResult, error) {
+
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+
+	result := &RepairResult{}
+	currentPrompt := prompt
+
+	for i := 0; i <= maxRepairs; i++ {
+		output, err := call(currentPrompt)
+		if err != nil {
+			return result, fmt.Errorf("generation attempt %d: %w", i+1, err)
+		}
+		result.Output = output
+
+		var problems []string
+		if validate != nil {
+			problems = validate(output)
+		}
+		result.Attempts = append(result.Attempts, RepairAttempt{Iteration: i + 1, Problems: problems})
+
+		if len(problems) == 0 {
+			logf("attempt %d/%d: output passed validation", i+1, maxRepairs+1)
+			result.Passed = true
+			return result, nil
+		}
+
+		logf("attempt %d/%d: %d problem(s) found", i+1, maxRepairs+1, len(problems))
+		for _, p := range problems {
+			logf("  - %s", p)
+		}
+
+		currentPrompt = BuildRepairPrompt(prompt, output, problems)
+	}
+
+	logf("repair budget of %d exhausted, keeping last output", maxRepairs)
+	return result, nil
+}
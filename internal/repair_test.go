@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateWithRepair(t *testing.T) {
+	t.Run("passes first time", func(t *testing.T) {
+		calls := 0
+		call := func(p string) (string, error) {
+			calls++
+			return "ok", nil
+		}
+
+		result, err := GenerateWithRepair("prompt", 3, call, func(string) []string { return nil }, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Passed || calls != 1 || len(result.Attempts) != 1 {
+			t.Errorf("expected single passing attempt, got passed=%v calls=%d attempts=%d", result.Passed, calls, len(result.Attempts))
+		}
+	})
+
+	t.Run("repairs with problems in prompt", func(t *testing.T) {
+		var prompts []string
+		call := func(p string) (string, error) {
+			prompts = append(prompts, p)
+			if len(prompts) < 3 {
+				return "broken", nil
+			}
+			return "fixed", nil
+		}
+		validate := func(content string) []string {
+			if content == "broken" {
+				return []string{"missing namespace"}
+			}
+			return nil
+		}
+
+		result, err := GenerateWithRepair("prompt", 3, call, validate, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Passed || result.Output != "fixed" {
+			t.Errorf("expected fixed output, got %+v", result)
+		}
+		if len(prompts) != 3 {
+			t.Fatalf("expected 3 calls, got %d", len(prompts))
+		}
+		if !strings.Contains(prompts[1], "missing namespace") || !strings.Contains(prompts[1], "broken") {
+			t.Errorf("repair prompt should contain previous output and problems, got %q", prompts[1])
+		}
+	})
+
+	t.Run("budget exhausted", func(t *testing.T) {
+		calls := 0
+		call := func(p string) (string, error) {
+			calls++
+			return "broken", nil
+		}
+
+		result, err := GenerateWithRepair("prompt", 2, call, func(string) []string { return []string{"bad"} }, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Passed || calls != 3 || result.Output != "broken" {
+			t.Errorf("expected 3 failing attempts, got passed=%v calls=%d", result.Passed, calls)
+		}
+	})
+
+	t.Run("call error", func(t *testing.T) {
+		call := func(p string) (string, error) { return "", errors.New("boom") }
+		if _, err := GenerateWithRepair("prompt", 2, call, nil, nil); err == nil {
+			t.Error("expected error from failing call")
+		}
+	})
+}
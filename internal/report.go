@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stuttgart-things/k2n/internal/ai"
+	"gopkg.in/yaml.v3"
+)
+
+// ReportMessage is a structured warning or error of a run.
+type ReportMessage struct {
+	Stage   string `json:"stage" yaml:"stage"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// ReportFile is a file written by a run.
+type ReportFile struct {
+	Path     string        `json:"path" yaml:"path"`
+	Action   JournalAction `json:"action" yaml:"action"`
+	Checksum string        `json:"checksum" yaml:"checksum"`
+}
+
+// Report is the machine-readable summary of a gen or talk run.
+type Report struct {
+	Command       string                 `json:"command" yaml:"command"`
+	Status        string                 `json:"status" yaml:"status"`
+	RunID         string                 `json:"runId,omitempty" yaml:"runId,omitempty"`
+	StartedAt     time.Time              `json:"startedAt" yaml:"startedAt"`
+	FinishedAt    time.Time              `json:"finishedAt" yaml:"finishedAt"`
+	Config        map[string]string      `json:"config" yaml:"config"`
+	Examples      []string               `json:"examples,omitempty" yaml:"examples,omitempty"`
+	Rulesets      []string               `json:"rulesets,omitempty" yaml:"rulesets,omitempty"`
+	Context       []string               `json:"context,omitempty" yaml:"context,omitempty"`
+	Conventions   *Conventions           `json:"conventions,omitempty" yaml:"conventions,omitempty"`
+	Git           *GitCommit             `json:"git,omitempty" yaml:"git,omitempty"`
+	Kustomization *KustomizationChange   `json:"kustomization,omitempty" yaml:"kustomization,omitempty"`
+	Sources       []GitSource            `json:"sources,omitempty" yaml:"sources,omitempty"`
+	Skipped       []SkippedFile          `json:"skippedFiles,omitempty" yaml:"skippedFiles,omitempty"`
+	Collapsed     []CollapsedExample     `json:"collapsedExamples,omitempty" yaml:"collapsedExamples,omitempty"`
+	PromptHash    string                 `json:"promptHash,omitempty" yaml:"promptHash,omitempty"`
+	Provider      string                 `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Model         string                 `json:"model,omitempty" yaml:"model,omitempty"`
+	Usage         ai.Usage               `json:"usage" yaml:"usage"`
+	Attempts      int                    `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	Template      string                 `json:"template,omitempty" yaml:"template,omitempty"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Files         []ReportFile           `json:"files" yaml:"files"`
+	Warnings      []ReportMessage        `json:"warnings" yaml:"warnings"`
+	Errors        []ReportMessage        `json:"errors" yaml:"errors"`
+}
+
+// Report status values.
+const (
+	ReportSuccess = "success"
+	ReportFailed  = "failed"
+)
+
+// NewReport starts a report for the given command.
+func NewReport(command string) *Report {
+	return &Report{
+		Command:   command,
+		Status:    ReportSuccess,
+		StartedAt: time.Now(),
+		Config:    map[string]string{},
+		Files:     []ReportFile{},
+		Warnings:  []ReportMessage{},
+		Errors:    []ReportMessage{},
+	}
+}
+
+// SetConfig stores the resolved configuration with secret values masked.
+func (r *Report) SetConfig(config map[string]string) {
+	for k, v := range config {
+		r.Config[k] = MaskSecret(k, v)
+	}
+}
+
+// SetPrompt records the sha256 of the prompt sent to the AI.
+func (r *Report) SetPrompt(prompt string) {
+	r.PromptHash = "sha256:" + Checksum(prompt)
+}
+
+// Warn adds a structured warning.
+func (r *Report) Warn(stage, format string, a ...any) {
+	r.Warnings = append(r.Warnings, ReportMessage{Stage: stage, Message: fmt.Sprintf(format, a...)})
+}
+
+// Fail adds a structured error and marks the run as failed.
+func (r *Report) Fail(stage string, err error) {
+	r.Status = ReportFailed
+	r.Errors = append(r.Errors, ReportMessage{Stage: stage, Message: err.Error()})
+}
+
+// AddJournal records the files written according to the journal of the run.
+func (r *Report) AddJournal(j *Journal) {
+	if j == nil {
+		return
+	}
+	if len(j.Entries) > 0 {
+		r.RunID = j.ID
+	}
+	for _, e := range j.Entries {
+		r.Files = append(r.Files, ReportFile{Path: e.Path, Action: e.Action, Checksum: "sha256:" + e.Checksum})
+	}
+}
+
+// Write renders the report as json or yaml to path, or to stdout if path is empty or "-".
+func (r *Report) Write(format, path string) error {
+	r.FinishedAt = time.Now()
+	sort.Strings(r.Examples)
+	sort.Strings(r.Rulesets)
+	return WriteStructured(r, format, path)
+}
+
+// WriteStructured renders v as json or yaml to path, or to stdout if path is empty or "-".
+func WriteStructured(v interface{}, format, path string) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	case "yaml", "yml":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(v)
+		data = buf.Bytes()
+	default:
+		return fmt.Errorf("unknown report format %q (supported: json, yaml)", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	if path == "" || path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for report %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
+
+// ValidateReportFormat checks a report format name. An empty name disables the report.
+func ValidateReportFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", "json", "yaml", "yml":
+		return nil
+	default:
+		return fmt.Errorf("unknown report format %q (supported: json, yaml)", format)
+	}
+}
+
+// secretKeyMarkers identify configuration keys whose values must not be reported.
+var secretKeyMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD"}
+
+// MaskSecret returns "***" for non-empty values of keys that look like secrets.
+func MaskSecret(key, value string) string {
+	if value == "" {
+		return value
+	}
+	upper := strings.ToUpper(key)
+	for _, marker := range secretKeyMarkers {
+		if strings.Contains(upper, marker) {
+			return "***"
+		}
+	}
+	return value
+}
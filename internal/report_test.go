@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestReportWrite(t *testing.T) {
+	report := NewReport("gen")
+	report.SetConfig(map[string]string{
+		"AI_API_KEY":      "secret-value", // pragma: allowlist secret
+		"CLAIM_API_TOKEN": "token-value",
+		"USECASE":         "crossplane",
+	})
+	report.SetPrompt("prompt")
+	report.Warn("examples", "no examples provided")
+	report.Fail("ai", errors.New("boom"))
+
+	journal := NewJournal("k2n gen", "/tmp/out")
+	journal.Entries = append(journal.Entries, JournalEntry{Path: "/tmp/out/a.yaml", Action: ActionCreated, Checksum: Checksum("a")})
+	report.AddJournal(journal)
+
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "report.json")
+	if err := report.Write("json", jsonPath); err != nil {
+		t.Fatalf("Write json returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-value") || strings.Contains(string(data), "token-value") {
+		t.Error("report must not contain secrets")
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if decoded.Status != ReportFailed || len(decoded.Errors) != 1 || len(decoded.Warnings) != 1 {
+		t.Errorf("unexpected status or messages: %+v", decoded)
+	}
+	if decoded.Config["USECASE"] != "crossplane" || decoded.Config["AI_API_KEY"] != "***" {
+		t.Errorf("unexpected config: %v", decoded.Config)
+	}
+	if decoded.PromptHash != "sha256:"+Checksum("prompt") {
+		t.Errorf("unexpected prompt hash %q", decoded.PromptHash)
+	}
+	if len(decoded.Files) != 1 || decoded.Files[0].Checksum != "sha256:"+Checksum("a") || decoded.RunID != journal.ID {
+		t.Errorf("unexpected files: %+v", decoded.Files)
+	}
+
+	yamlPath := filepath.Join(dir, "report.yaml")
+	if err := report.Write("yaml", yamlPath); err != nil {
+		t.Fatalf("Write yaml returned error: %v", err)
+	}
+	data, _ = os.ReadFile(yamlPath)
+	var generic map[string]interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil || generic["command"] != "gen" {
+		t.Errorf("unexpected yaml report: %v (%v)", generic, err)
+	}
+
+	if err := report.Write("xml", ""); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
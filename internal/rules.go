@@ -0,0 +1,634 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StructuredRulesetKind marks a ruleset file as structured. Other ruleset files
+// are free text that is only pasted into the prompt.
+const StructuredRulesetKind = "Ruleset"
+
+// Rules modes control what happens with structured rulesets after generation.
+const (
+	RulesFix   = "fix"   // apply defaults and fix violations where possible
+	RulesCheck = "check" // report violations only
+	RulesOff   = "off"   // ignore structured rules after generation
+)
+
+// ParseRulesMode checks a rules mode name.
+func ParseRulesMode(mode string) (string, error) {
+	switch mode {
+	case RulesFix, RulesCheck, RulesOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown rules mode %q (supported: fix, check, off)", mode)
+	}
+}
+
+// StructuredRuleset is a ruleset with machine-checkable rules:
+//
+//	kind: Ruleset
+//	name: runner
+//	description: Rules for GitHub runner claims
+//	match:            # documents the ruleset applies to (default: all)
+//	  kind: GithubRunner
+//	defaults:         # values injected where missing
+//	  spec:
+//	    group: stuttgart-things
+//	enforce:          # field path → required value, or {regex: ...}
+//	  spec.token.name: github
+//	  spec.version: {regex: '^2\.\d+\.\d+$'}
+//	forbid:           # fields that must not be set, optionally only with a value or regex
+//	  - spec.privileged
+//	  - {path: metadata.namespace, value: default}
+//	kustomize:        # fields of the kustomization written with --kustomize
+//	  namespace: crossplane-system
+//	postprocess:      # deterministic changes after generation, see PostProcess
+//	  namespace: crossplane-system
+//
+// Paths are dotted field names with optional [n] or [*] indexes and an optional
+// leading "$.".
+type StructuredRuleset struct {
+	Kind        string                 `yaml:"kind"`
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	Match       map[string]interface{} `yaml:"match"`
+	Defaults    map[string]interface{} `yaml:"defaults"`
+	Enforce     map[string]interface{} `yaml:"enforce"`
+	Forbid      []ForbidRule           `yaml:"forbid"`
+	// Kustomize configures the kustomization written with --kustomize.
+	Kustomize *KustomizeOptions `yaml:"kustomize"`
+	// PostProcess configures the steps run on the output after generation.
+	PostProcess *PostProcess `yaml:"postprocess"`
+
+	// Source is the file the ruleset was loaded from.
+	Source string `yaml:"-"`
+}
+
+// ForbidRule forbids a field, or only a value or pattern of it.
+type ForbidRule struct {
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+	Regex string      `yaml:"regex"`
+}
+
+// UnmarshalYAML accepts a plain path as shorthand for {path: <path>}.
+func (f *ForbidRule) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		f.Path = node.Value
+		return nil
+	}
+	type plain ForbidRule
+	return node.Decode((*plain)(f))
+}
+
+// ParseStructuredRuleset parses content as structured ruleset. It returns nil
+// without error if the content is not a structured ruleset.
+func ParseStructuredRuleset(source, content string) (*StructuredRuleset, error) {
+	var probe struct {
+		Kind string `yaml:"kind"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &probe); err != nil || probe.Kind != StructuredRulesetKind {
+		return nil, nil
+	}
+
+	var rs StructuredRuleset
+	if err := yaml.Unmarshal([]byte(content), &rs); err != nil {
+		return nil, fmt.Errorf("invalid ruleset %s: %w", source, err)
+	}
+	rs.Source = source
+	if rs.Name == "" {
+		rs.Name = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	}
+
+	for path, rule := range rs.Enforce {
+		if _, err := parseRulePath(path); err != nil {
+			return nil, fmt.Errorf("invalid ruleset %s: enforce %s: %w", source, path, err)
+		}
+		if m, ok := rule.(map[string]interface{}); ok {
+			if re, ok := m["regex"].(string); ok {
+				if _, err := regexp.Compile(re); err != nil {
+					return nil, fmt.Errorf("invalid ruleset %s: enforce %s: %w", source, path, err)
+				}
+			}
+		}
+	}
+	for _, f := range rs.Forbid {
+		if _, err := parseRulePath(f.Path); err != nil {
+			return nil, fmt.Errorf("invalid ruleset %s: forbid %s: %w", source, f.Path, err)
+		}
+		if f.Regex != "" {
+			if _, err := regexp.Compile(f.Regex); err != nil {
+				return nil, fmt.Errorf("invalid ruleset %s: forbid %s: %w", source, f.Path, err)
+			}
+		}
+	}
+	return &rs, nil
+}
+
+// RulesetPromptText returns the text of a ruleset file as it is put into the
+// prompt. Structured rulesets are rendered in a human-readable form.
+func RulesetPromptText(source, content string) string {
+	rs, err := ParseStructuredRuleset(source, content)
+	if err != nil || rs == nil {
+		return content
+	}
+	return rs.PromptText()
+}
+
+// PromptText renders the ruleset as instructions for the model.
+func (r *StructuredRuleset) PromptText() string {
+	var b strings.Builder
+	b.WriteString("Ruleset " + r.Name)
+	if r.Description != "" {
+		b.WriteString(": " + r.Description)
+	}
+	b.WriteString("\n")
+
+	if len(r.Match) > 0 {
+		b.WriteString("Applies to documents where " + strings.Join(formatPathValues(r.Match, "="), " and ") + ".\n")
+	}
+	if len(r.Defaults) > 0 {
+		b.WriteString("Use these values unless the instruction says otherwise:\n")
+		for _, line := range formatPathValues(flattenDefaults("", r.Defaults), ": ") {
+			b.WriteString("- " + line + "\n")
+		}
+	}
+	if len(r.Enforce) > 0 {
+		b.WriteString("Always:\n")
+		for _, path := range sortedKeys(r.Enforce) {
+			if re, ok := enforceRegex(r.Enforce[path]); ok {
+				b.WriteString(fmt.Sprintf("- %s must match %s\n", path, re))
+			} else {
+				b.WriteString(fmt.Sprintf("- %s must be %s\n", path, formatRuleValue(enforceValue(r.Enforce[path]))))
+			}
+		}
+	}
+	if len(r.Forbid) > 0 {
+		b.WriteString("Never:\n")
+		for _, f := range r.Forbid {
+			switch {
+			case f.Regex != "":
+				b.WriteString(fmt.Sprintf("- set %s to a value matching %s\n", f.Path, f.Regex))
+			case f.Value != nil:
+				b.WriteString(fmt.Sprintf("- set %s to %s\n", f.Path, formatRuleValue(f.Value)))
+			default:
+				b.WriteString(fmt.Sprintf("- set %s\n", f.Path))
+			}
+		}
+	}
+	return b.String()
+}
+
+// RuleViolation is a structured rule a generated document breaks.
+type RuleViolation struct {
+	Ruleset  string
+	File     string
+	Document int
+	Path     string
+	Message  string
+	Fixed    bool
+}
+
+func (v RuleViolation) String() string {
+	s := fmt.Sprintf("%s: %s (ruleset %s)", v.File, v.Message, v.Ruleset)
+	if v.Document > 0 {
+		s = fmt.Sprintf("%s[doc %d]: %s (ruleset %s)", v.File, v.Document, v.Message, v.Ruleset)
+	}
+	if v.Fixed {
+		s += " [fixed]"
+	}
+	return s
+}
+
+// ApplyStructuredRulesets checks every YAML document of the generated output
+// against the rulesets. With fix, defaults are injected, required values set and
+// forbidden fields removed; the returned output then contains the changes.
+// Violations that were not fixed are returned with Fixed false.
+func ApplyStructuredRulesets(output string, rulesets []*StructuredRuleset, fix bool) (string, []RuleViolation) {
+	if len(rulesets) == 0 {
+		return output, nil
+	}
+
+	files := ParseGeneratedFiles(output)
+	var violations []RuleViolation
+	changed := false
+
+	for i, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name))
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		docs, err := decodeYAMLDocuments(f.Content)
+		if err != nil {
+			continue // reported by ValidateYAML
+		}
+
+		fileChanged := false
+		for d, doc := range docs {
+			if doc.Kind != yaml.MappingNode {
+				continue
+			}
+			for _, rs := range rulesets {
+				docViolations, docChanged := rs.apply(doc, fix)
+				for _, v := range docViolations {
+					v.File = f.Name
+					if len(docs) > 1 {
+						v.Document = d + 1
+					}
+					violations = append(violations, v)
+				}
+				fileChanged = fileChanged || docChanged
+			}
+		}
+
+		if fileChanged {
+			content, err := encodeYAMLDocuments(docs)
+			if err == nil {
+				files[i].Content = content
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return output, violations
+	}
+	return RenderGeneratedFiles(files), violations
+}
+
+// StructuredRulesValidator reports violations of the rulesets as problems, so
+// they are sent back to the model for repair. With fix, violations k2n can fix
+// itself are not reported.
+func StructuredRulesValidator(rulesets []*StructuredRuleset, fix bool) Validator {
+	return func(content string) []string {
+		_, violations := ApplyStructuredRulesets(content, rulesets, fix)
+		var problems []string
+		for _, v := range violations {
+			if !v.Fixed {
+				problems = append(problems, v.String())
+			}
+		}
+		return problems
+	}
+}
+
+// apply checks one document against the ruleset and fixes it if requested.
+func (r *StructuredRuleset) apply(doc *yaml.Node, fix bool) ([]RuleViolation, bool) {
+	for path, want := range r.Match {
+		nodes := lookupRulePath(doc, path)
+		if len(nodes) == 0 || !nodeEquals(nodes[0], want) {
+			return nil, false
+		}
+	}
+
+	var violations []RuleViolation
+	changed := false
+	violation := func(path, format string, a ...any) *RuleViolation {
+		violations = append(violations, RuleViolation{Ruleset: r.Name, Path: path, Message: fmt.Sprintf(format, a...)})
+		return &violations[len(violations)-1]
+	}
+
+	if fix {
+		for _, d := range flattenDefaults("", r.Defaults) {
+			if len(lookupRulePath(doc, d.path)) == 0 && setRulePath(doc, d.path, d.value) {
+				v := violation(d.path, "%s was missing, set default %s", d.path, formatRuleValue(d.value))
+				v.Fixed, changed = true, true
+			}
+		}
+	}
+
+	for _, path := range sortedKeys(r.Enforce) {
+		rule := r.Enforce[path]
+		re, isRegex := enforceRegex(rule)
+		want := enforceValue(rule)
+		nodes := lookupRulePath(doc, path)
+
+		if len(nodes) == 0 {
+			v := violation(path, "%s is required", path)
+			if fix && !isRegex && setRulePath(doc, path, want) {
+				v.Fixed, changed = true, true
+			}
+			continue
+		}
+		for _, n := range nodes {
+			switch {
+			case isRegex && !regexp.MustCompile(re).MatchString(n.Value):
+				violation(path, "%s is %q and must match %s", path, n.Value, re)
+			case !isRegex && !nodeEquals(n, want):
+				v := violation(path, "%s is %s and must be %s", path, summarizeNode(n), formatRuleValue(want))
+				if fix && replaceNode(n, want) {
+					v.Fixed, changed = true, true
+				}
+			}
+		}
+	}
+
+	for _, f := range r.Forbid {
+		for _, n := range lookupRulePath(doc, f.Path) {
+			var v *RuleViolation
+			switch {
+			case f.Regex != "":
+				if regexp.MustCompile(f.Regex).MatchString(n.Value) {
+					v = violation(f.Path, "%s must not match %s", f.Path, f.Regex)
+				}
+			case f.Value != nil:
+				if nodeEquals(n, f.Value) {
+					v = violation(f.Path, "%s must not be %s", f.Path, formatRuleValue(f.Value))
+				}
+			default:
+				v = violation(f.Path, "%s must not be set", f.Path)
+			}
+			if v != nil && fix && deleteRulePath(doc, f.Path, n) {
+				v.Fixed, changed = true, true
+			}
+		}
+	}
+
+	return violations, changed
+}
+
+// rulePathSegment is a mapping key, a sequence index or the [*] wildcard (index -1).
+type rulePathSegment struct {
+	key   string
+	index int
+	isKey bool
+}
+
+var rulePathIndexRe = regexp.MustCompile(`\[(\*|\d+)\]`)
+
+func parseRulePath(path string) ([]rulePathSegment, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var segments []rulePathSegment
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		if i := strings.Index(part, "["); i >= 0 {
+			key = part[:i]
+			rest := part[i:]
+			if rulePathIndexRe.ReplaceAllString(rest, "") != "" {
+				return nil, fmt.Errorf("invalid index in %q", part)
+			}
+			if key != "" {
+				segments = append(segments, rulePathSegment{key: key, isKey: true})
+			}
+			for _, m := range rulePathIndexRe.FindAllStringSubmatch(rest, -1) {
+				index := -1
+				if m[1] != "*" {
+					index, _ = strconv.Atoi(m[1])
+				}
+				segments = append(segments, rulePathSegment{index: index})
+			}
+			continue
+		}
+		if key == "" {
+			return nil, fmt.Errorf("empty field name in %q", path)
+		}
+		segments = append(segments, rulePathSegment{key: key, isKey: true})
+	}
+	return segments, nil
+}
+
+// lookupRulePath returns all nodes matching path below root.
+func lookupRulePath(root *yaml.Node, path string) []*yaml.Node {
+	segments, err := parseRulePath(path)
+	if err != nil {
+		return nil
+	}
+	nodes := []*yaml.Node{root}
+	for _, seg := range segments {
+		var next []*yaml.Node
+		for _, n := range nodes {
+			switch {
+			case seg.isKey && n.Kind == yaml.MappingNode:
+				if v := mappingValue(n, seg.key); v != nil {
+					next = append(next, v)
+				}
+			case !seg.isKey && n.Kind == yaml.SequenceNode:
+				if seg.index < 0 {
+					next = append(next, n.Content...)
+				} else if seg.index < len(n.Content) {
+					next = append(next, n.Content[seg.index])
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setRulePath sets the value at a path of mapping keys, creating missing
+// mappings on the way. Paths with indexes cannot be created.
+func setRulePath(root *yaml.Node, path string, value interface{}) bool {
+	segments, err := parseRulePath(path)
+	if err != nil {
+		return false
+	}
+	current := root
+	for i, seg := range segments {
+		if !seg.isKey || current.Kind != yaml.MappingNode {
+			return false
+		}
+		existing := mappingValue(current, seg.key)
+		if i == len(segments)-1 {
+			if existing != nil {
+				return replaceNode(existing, value)
+			}
+			var valueNode yaml.Node
+			if err := valueNode.Encode(value); err != nil {
+				return false
+			}
+			current.Content = append(current.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: seg.key}, &valueNode)
+			return true
+		}
+		if existing == nil {
+			existing = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			current.Content = append(current.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: seg.key}, existing)
+		}
+		current = existing
+	}
+	return false
+}
+
+// deleteRulePath removes target, found at path, from its parent.
+func deleteRulePath(root *yaml.Node, path string, target *yaml.Node) bool {
+	segments, err := parseRulePath(path)
+	if err != nil || len(segments) == 0 {
+		return false
+	}
+	var parents []*yaml.Node
+	if len(segments) == 1 {
+		parents = []*yaml.Node{root}
+	} else {
+		parents = lookupSegments(root, segments[:len(segments)-1])
+	}
+	for _, p := range parents {
+		for i, child := range p.Content {
+			if child != target {
+				continue
+			}
+			switch p.Kind {
+			case yaml.MappingNode:
+				p.Content = append(p.Content[:i-1], p.Content[i+1:]...)
+			case yaml.SequenceNode:
+				p.Content = append(p.Content[:i], p.Content[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func lookupSegments(root *yaml.Node, segments []rulePathSegment) []*yaml.Node {
+	var parts []string
+	for _, s := range segments {
+		switch {
+		case s.isKey:
+			parts = append(parts, "."+s.key)
+		case s.index < 0:
+			parts = append(parts, "[*]")
+		default:
+			parts = append(parts, fmt.Sprintf("[%d]", s.index))
+		}
+	}
+	return lookupRulePath(root, strings.Join(parts, ""))
+}
+
+// replaceNode overwrites n with the encoded value, keeping its comments.
+func replaceNode(n *yaml.Node, value interface{}) bool {
+	var replacement yaml.Node
+	if err := replacement.Encode(value); err != nil {
+		return false
+	}
+	replacement.HeadComment, replacement.LineComment, replacement.FootComment = n.HeadComment, n.LineComment, n.FootComment
+	*n = replacement
+	return true
+}
+
+// nodeEquals compares a node with a value decoded from a ruleset.
+func nodeEquals(n *yaml.Node, want interface{}) bool {
+	var got interface{}
+	if err := n.Decode(&got); err != nil {
+		return false
+	}
+	if reflect.DeepEqual(got, want) {
+		return true
+	}
+	// Scalars compare by their text, so "2" matches 2 in the ruleset.
+	if n.Kind == yaml.ScalarNode {
+		return n.Value == fmt.Sprint(want)
+	}
+	return false
+}
+
+func enforceRegex(rule interface{}) (string, bool) {
+	if m, ok := rule.(map[string]interface{}); ok {
+		if re, ok := m["regex"].(string); ok {
+			return re, true
+		}
+	}
+	return "", false
+}
+
+func enforceValue(rule interface{}) interface{} {
+	if m, ok := rule.(map[string]interface{}); ok {
+		if v, ok := m["value"]; ok {
+			return v
+		}
+	}
+	return rule
+}
+
+type pathValue struct {
+	path  string
+	value interface{}
+}
+
+// flattenDefaults turns nested defaults into leaf paths. Lists are leaves.
+func flattenDefaults(prefix string, values map[string]interface{}) []pathValue {
+	var out []pathValue
+	for _, k := range sortedKeys(values) {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if nested, ok := values[k].(map[string]interface{}); ok && len(nested) > 0 {
+			out = append(out, flattenDefaults(path, nested)...)
+			continue
+		}
+		out = append(out, pathValue{path, values[k]})
+	}
+	return out
+}
+
+func formatPathValues(values interface{}, sep string) []string {
+	var lines []string
+	switch v := values.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			lines = append(lines, k+sep+formatRuleValue(v[k]))
+		}
+	case []pathValue:
+		for _, pv := range v {
+			lines = append(lines, pv.path+sep+formatRuleValue(pv.value))
+		}
+	}
+	return lines
+}
+
+func formatRuleValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return summarizeNode(&n)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeYAMLDocuments renders documents as a multi-document stream.
+func encodeYAMLDocuments(docs []*yaml.Node) (string, error) {
+	var parts []string
+	for _, doc := range docs {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return "", err
+		}
+		enc.Close()
+		parts = append(parts, strings.TrimSpace(buf.String()))
+	}
+	return strings.Join(parts, "\n---\n"), nil
+}
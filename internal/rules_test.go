@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const runnerRuleset = `kind: Ruleset
+name: runner
+description: GithubRunner rules
+match:
+  kind: GithubRunner
+defaults:
+  spec:
+    group: stuttgart-things
+enforce:
+  spec.token.name: github
+  spec.version: {regex: '^\d+\.\d+\.\d+$'}
+  $.spec.replicas: 1
+forbid:
+  - metadata.namespace
+  - {path: spec.clusterConfig, value: default}
+  - {path: "spec.labels[*]", regex: "^tmp-"}
+`
+
+func mustParseRuleset(t *testing.T, content string) *StructuredRuleset {
+	t.Helper()
+	rs, err := ParseStructuredRuleset("runner.yaml", content)
+	if err != nil {
+		t.Fatalf("ParseStructuredRuleset: %v", err)
+	}
+	if rs == nil {
+		t.Fatal("expected a structured ruleset")
+	}
+	return rs
+}
+
+func TestParseStructuredRuleset(t *testing.T) {
+	rs := mustParseRuleset(t, runnerRuleset)
+	if rs.Name != "runner" || len(rs.Enforce) != 3 || len(rs.Forbid) != 3 {
+		t.Errorf("unexpected ruleset: %+v", rs)
+	}
+	if rs.Forbid[0].Path != "metadata.namespace" || rs.Forbid[1].Value != "default" {
+		t.Errorf("unexpected forbid rules: %+v", rs.Forbid)
+	}
+
+	plain, err := ParseStructuredRuleset("rules.yaml", "group: stuttgart-things\n")
+	if err != nil || plain != nil {
+		t.Errorf("free text ruleset should not be structured, got %v, %v", plain, err)
+	}
+
+	for _, bad := range []string{
+		"kind: Ruleset\nenforce:\n  spec..name: x\n",
+		"kind: Ruleset\nenforce:\n  spec.name: {regex: '('}\n",
+		"kind: Ruleset\nforbid:\n  - spec.ports[x]\n",
+	} {
+		if _, err := ParseStructuredRuleset("bad.yaml", bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRulesetPromptText(t *testing.T) {
+	text := RulesetPromptText("runner.yaml", runnerRuleset)
+	for _, want := range []string{
+		"Ruleset runner: GithubRunner rules",
+		"Applies to documents where kind=GithubRunner",
+		"- spec.group: stuttgart-things",
+		"- spec.token.name must be github",
+		`- spec.version must match ^\d+\.\d+\.\d+$`,
+		"- set metadata.namespace\n",
+		"- set spec.clusterConfig to default",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("prompt text should contain %q, got:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "kind: Ruleset") {
+		t.Error("prompt text should not contain the raw ruleset")
+	}
+
+	if got := RulesetPromptText("rules.yaml", "group: x\n"); got != "group: x\n" {
+		t.Errorf("free text ruleset should be unchanged, got %q", got)
+	}
+}
+
+func TestApplyStructuredRulesetsFix(t *testing.T) {
+	rs := mustParseRuleset(t, runnerRuleset)
+	output := `# file: runner.yaml
+kind: GithubRunner
+metadata:
+  name: helm
+  namespace: default
+spec:
+  version: 1.2.3 # pinned
+  clusterConfig: default
+  replicas: 3
+  labels: [keep, tmp-x]
+# file: other.yaml
+kind: Secret
+metadata:
+  namespace: default
+`
+	fixed, violations := ApplyStructuredRulesets(output, []*StructuredRuleset{rs}, true)
+
+	files := ParseGeneratedFiles(fixed)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d:\n%s", len(files), fixed)
+	}
+	runner := files[0].Content
+	for _, want := range []string{"group: stuttgart-things", "name: github", "replicas: 1", "version: 1.2.3 # pinned", "labels: [keep]"} {
+		if !strings.Contains(runner, want) {
+			t.Errorf("fixed file should contain %q, got:\n%s", want, runner)
+		}
+	}
+	for _, unwanted := range []string{"namespace", "clusterConfig", "tmp-x"} {
+		if strings.Contains(runner, unwanted) {
+			t.Errorf("fixed file should not contain %q, got:\n%s", unwanted, runner)
+		}
+	}
+	if !strings.Contains(files[1].Content, "namespace: default") {
+		t.Error("documents not matching the ruleset should be untouched")
+	}
+
+	for _, v := range violations {
+		if !v.Fixed {
+			t.Errorf("unexpected unfixed violation: %s", v)
+		}
+	}
+	if len(violations) != 6 {
+		t.Errorf("expected 6 fixed violations, got %d: %v", len(violations), violations)
+	}
+}
+
+func TestApplyStructuredRulesetsCheck(t *testing.T) {
+	rs := mustParseRuleset(t, runnerRuleset)
+	output := "# file: runner.yaml\nkind: GithubRunner\nspec:\n  version: latest\n  replicas: 1\n  token:\n    name: github\n---\nkind: GithubRunner\nspec:\n  group: x\n  version: 1.0.0\n  replicas: \"1\"\n  token:\n    name: github\n"
+
+	out, violations := ApplyStructuredRulesets(output, []*StructuredRuleset{rs}, false)
+	if out != output {
+		t.Error("check mode must not change the output")
+	}
+	if len(violations) != 1 {
+		t.Fatalf("expected 1 violation, got %v", violations)
+	}
+	if got := violations[0].String(); !strings.Contains(got, "runner.yaml[doc 1]") || !strings.Contains(got, "must match") {
+		t.Errorf("unexpected violation %q", got)
+	}
+}
+
+func TestStructuredRulesValidator(t *testing.T) {
+	rs := mustParseRuleset(t, runnerRuleset)
+	output := "# file: runner.yaml\nkind: GithubRunner\nspec:\n  version: latest\n"
+
+	if problems := StructuredRulesValidator([]*StructuredRuleset{rs}, false)(output); len(problems) != 3 {
+		t.Errorf("check mode should report all violations, got %v", problems)
+	}
+	problems := StructuredRulesValidator([]*StructuredRuleset{rs}, true)(output)
+	if len(problems) != 1 || !strings.Contains(problems[0], "spec.version") {
+		t.Errorf("fix mode should only report what cannot be fixed, got %v", problems)
+	}
+}
+
+func TestLoadInputsStructuredRulesets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "runner.yaml"), []byte(runnerRuleset), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.yaml"), []byte("group: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := LoadInputs(InputConfig{RulesetUsecaseDirs: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(in.Structured) != 1 || in.Structured[0].Name != "runner" {
+		t.Errorf("expected the structured ruleset, got %+v", in.Structured)
+	}
+	joined := strings.Join(in.UsecaseRules, "\n")
+	if !strings.Contains(joined, "Filename: runner.yaml\nRuleset runner") || !strings.Contains(joined, "group: x") {
+		t.Errorf("unexpected rules:\n%s", joined)
+	}
+}
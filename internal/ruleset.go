@@ -18,7 +18,7 @@ func LoadRulesets(dir string) ([]string, error) {
 			if err != nil {
 				return err
 			}
-			rulesets = append(rulesets, fmt.Sprintf("Filename: %s\n%s", filepath.Base(path), content))
+			rulesets = append(rulesets, fmt.Sprintf("Filename: %s\n%s", filepath.Base(path), RulesetPromptText(path, string(content))))
 		}
 		return nil
 	})
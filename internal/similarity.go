@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MinHash parameters: the signature has minHashBands×minHashRows values.
+// Examples sharing all values of one band are compared.
+const (
+	minHashBands = 32
+	minHashRows  = 4
+	minHashSize  = minHashBands * minHashRows
+)
+
+// CollapsedExample is an example left out because it is nearly identical to
+// an example that was kept.
+type CollapsedExample struct {
+	Path string `json:"path" yaml:"path"`
+	// Kept is the path of the example representing the cluster.
+	Kept string `json:"kept" yaml:"kept"`
+	// Similarity is the estimated Jaccard similarity to the kept example.
+	Similarity float64 `json:"similarity" yaml:"similarity"`
+}
+
+// CollapseSimilarExamples groups examples whose estimated similarity is at
+// least threshold and keeps one example per group: the one with the highest
+// priority, then the one most similar to the others. Every collapsed example
+// is at least threshold similar to the kept one. Examples keep their order. A
+// threshold of 0 or less disables the check.
+func CollapseSimilarExamples(examples []Example, threshold float64) ([]Example, []CollapsedExample) {
+	if threshold <= 0 || len(examples) < 2 {
+		return examples, nil
+	}
+
+	signatures := make([][minHashSize]uint64, len(examples))
+	for i, ex := range examples {
+		signatures[i] = minHashSignature(exampleShingles(ex.Path, ex.Content))
+	}
+
+	// Only examples sharing a band are likely similar enough to compare.
+	parent := make([]int, len(examples))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	compared := map[[2]int]bool{}
+	for b := 0; b < minHashBands; b++ {
+		buckets := map[[minHashRows]uint64][]int{}
+		for i := range examples {
+			var key [minHashRows]uint64
+			copy(key[:], signatures[i][b*minHashRows:(b+1)*minHashRows])
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, members := range buckets {
+			for x := 0; x < len(members); x++ {
+				for y := x + 1; y < len(members); y++ {
+					pair := [2]int{members[x], members[y]}
+					if compared[pair] {
+						continue
+					}
+					compared[pair] = true
+					if signatureSimilarity(&signatures[pair[0]], &signatures[pair[1]]) >= threshold {
+						parent[find(pair[1])] = find(pair[0])
+					}
+				}
+			}
+		}
+	}
+
+	clusters := map[int][]int{}
+	for i := range examples {
+		root := find(i)
+		clusters[root] = append(clusters[root], i)
+	}
+
+	// Similarity is not transitive, so a cluster may chain examples that are
+	// far apart. Collapse only members similar enough to the representative;
+	// the rest are clustered again around a representative of their own.
+	keep := make([]bool, len(examples))
+	var collapsed []CollapsedExample
+	for _, members := range clusters {
+		for len(members) > 0 {
+			best := representative(examples, signatures, members)
+			keep[best] = true
+			var rest []int
+			for _, m := range members {
+				if m == best {
+					continue
+				}
+				similarity := signatureSimilarity(&signatures[m], &signatures[best])
+				if similarity < threshold {
+					rest = append(rest, m)
+					continue
+				}
+				collapsed = append(collapsed, CollapsedExample{
+					Path:       examples[m].Path,
+					Kept:       examples[best].Path,
+					Similarity: roundSimilarity(similarity),
+				})
+			}
+			members = rest
+		}
+	}
+	sort.Slice(collapsed, func(a, b int) bool { return collapsed[a].Path < collapsed[b].Path })
+
+	var kept []Example
+	for i, ex := range examples {
+		if keep[i] {
+			kept = append(kept, ex)
+		}
+	}
+	return kept, collapsed
+}
+
+// representative picks the member with the highest priority and, among those,
+// the highest average similarity to the other members. Ties keep the first.
+func representative(examples []Example, signatures [][minHashSize]uint64, members []int) int {
+	best, bestScore := members[0], -1.0
+	for _, m := range members {
+		if examples[m].Meta.Priority < examples[best].Meta.Priority {
+			continue
+		}
+		score := 0.0
+		for _, o := range members {
+			if o != m {
+				score += signatureSimilarity(&signatures[m], &signatures[o])
+			}
+		}
+		if examples[m].Meta.Priority > examples[best].Meta.Priority || score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	return best
+}
+
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+// exampleShingles normalizes an example into a set of features. YAML is
+// flattened into its field paths and path=value pairs, so key order,
+// formatting and comments do not matter and list indexes are dropped. Other
+// files are split into lowercase word triples.
+func exampleShingles(path, content string) []string {
+	set := map[string]struct{}{}
+	if isYAMLPath(path) {
+		if docs, err := decodeYAMLDocuments(content); err == nil && len(docs) > 0 {
+			for _, doc := range docs {
+				for _, pv := range flattenNode(doc, "") {
+					key := listIndex.ReplaceAllString(pv.path, "[]")
+					set[key] = struct{}{}
+					set[key+"="+pv.value] = struct{}{}
+				}
+			}
+		}
+	}
+	if len(set) == 0 {
+		words := strings.Fields(strings.ToLower(content))
+		for i := range words {
+			end := min(i+3, len(words))
+			set[strings.Join(words[i:end], " ")] = struct{}{}
+			if end == len(words) {
+				break
+			}
+		}
+	}
+
+	shingles := make([]string, 0, len(set))
+	for s := range set {
+		shingles = append(shingles, s)
+	}
+	return shingles
+}
+
+type leafValue struct {
+	path, value string
+}
+
+// flattenNode lists the scalar leaves of a YAML node with their dotted paths.
+func flattenNode(node *yaml.Node, path string) []leafValue {
+	switch node.Kind {
+	case yaml.MappingNode:
+		var out []leafValue
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			out = append(out, flattenNode(node.Content[i+1], key)...)
+		}
+		return out
+	case yaml.SequenceNode:
+		var out []leafValue
+		for i, item := range node.Content {
+			out = append(out, flattenNode(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return out
+	case yaml.AliasNode:
+		return flattenNode(node.Alias, path)
+	default:
+		return []leafValue{{path: path, value: node.Value}}
+	}
+}
+
+func isYAMLPath(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, ".yml")
+}
+
+// minHashSignature keeps, for every hash function, the smallest hash of all
+// shingles. Hash functions are the fnv hash of the shingle mixed with a seed.
+func minHashSignature(shingles []string) [minHashSize]uint64 {
+	var sig [minHashSize]uint64
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for _, s := range shingles {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		base := h.Sum64()
+		for i := range sig {
+			if v := mix64(base ^ uint64(i+1)*0x9e3779b97f4a7c15); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// signatureSimilarity estimates the Jaccard similarity of two shingle sets.
+func signatureSimilarity(a, b *[minHashSize]uint64) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / minHashSize
+}
+
+func roundSimilarity(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func runnerClaim(name, repo string) string {
+	return fmt.Sprintf(`apiVersion: resources.stuttgart-things.com/v1alpha1
+kind: GithubRunner
+metadata:
+  name: %s
+spec:
+  repository: %s
+  group: stuttgart-things
+  version: 2.311.0
+  replicas: 1
+  clusterConfig: cicd
+  githubTokenSecret:
+    name: github
+    namespace: crossplane-system
+  labels:
+    - self-hosted
+    - linux
+`, name, repo)
+}
+
+func TestCollapseSimilarExamples(t *testing.T) {
+	examples := []Example{
+		{Path: "runner-k2n.yaml", Content: runnerClaim("k2n", "k2n")},
+		{Path: "runner-dagger.yaml", Content: runnerClaim("dagger", "dagger")},
+		{Path: "configmap.yaml", Content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  key: value\n"},
+		{Path: "runner-helm.yaml", Content: runnerClaim("helm", "helm"), Meta: ExampleMeta{Priority: 5}},
+		{Path: "main.tf", Content: `resource "aws_instance" "web" { ami = "ami-123" }`},
+	}
+
+	kept, collapsed := CollapseSimilarExamples(examples, 0.7)
+	var keptPaths []string
+	for _, ex := range kept {
+		keptPaths = append(keptPaths, ex.Path)
+	}
+	if fmt.Sprint(keptPaths) != "[configmap.yaml runner-helm.yaml main.tf]" {
+		t.Errorf("expected the runner with the highest priority to be kept, got %v", keptPaths)
+	}
+	if len(collapsed) != 2 || collapsed[0].Path != "runner-dagger.yaml" || collapsed[1].Path != "runner-k2n.yaml" {
+		t.Fatalf("unexpected collapsed examples %+v", collapsed)
+	}
+	for _, c := range collapsed {
+		if c.Kept != "runner-helm.yaml" || c.Similarity < 0.7 || c.Similarity >= 1 {
+			t.Errorf("unexpected collapse %+v", c)
+		}
+	}
+
+	if kept, collapsed := CollapseSimilarExamples(examples, 0); len(kept) != len(examples) || collapsed != nil {
+		t.Error("threshold 0 should disable collapsing")
+	}
+	if kept, _ := CollapseSimilarExamples(examples, 0.99); len(kept) != len(examples) {
+		t.Errorf("expected no collapse at 0.99, kept %d", len(kept))
+	}
+}
+
+func TestCollapseSimilarExamplesRepresentative(t *testing.T) {
+	// Without priorities the example closest to the others is kept.
+	base := runnerClaim("a", "a")
+	examples := []Example{
+		{Path: "outlier.yaml", Content: base + "extra:\n  one: 1\n  two: 2\n"},
+		{Path: "center.yaml", Content: base + "extra:\n  one: 1\n"},
+		{Path: "other.yaml", Content: base},
+	}
+	kept, _ := CollapseSimilarExamples(examples, 0.6)
+	if len(kept) != 1 || kept[0].Path != "center.yaml" {
+		t.Errorf("expected center.yaml to represent the cluster, got %+v", kept)
+	}
+}
+
+func TestCollapseSimilarExamplesNoChaining(t *testing.T) {
+	// a is similar to b and b to c, but a and c are far apart.
+	words := func(from, to int) string {
+		var w []string
+		for i := from; i < to; i++ {
+			w = append(w, fmt.Sprintf("word%d", i))
+		}
+		return strings.Join(w, " ")
+	}
+	examples := []Example{
+		{Path: "a.txt", Content: words(0, 60), Meta: ExampleMeta{Priority: 5}},
+		{Path: "b.txt", Content: words(10, 70)},
+		{Path: "c.txt", Content: words(20, 80)},
+	}
+	kept, collapsed := CollapseSimilarExamples(examples, 0.6)
+	if len(kept) != 2 || kept[0].Path != "a.txt" || kept[1].Path != "c.txt" {
+		t.Errorf("expected a.txt and c.txt to be kept, got %+v", kept)
+	}
+	if len(collapsed) != 1 || collapsed[0].Path != "b.txt" || collapsed[0].Kept != "a.txt" {
+		t.Fatalf("unexpected collapsed examples %+v", collapsed)
+	}
+	if collapsed[0].Similarity < 0.6 {
+		t.Errorf("collapsed below the threshold: %+v", collapsed[0])
+	}
+}
+
+func TestExampleShinglesNormalizeYAML(t *testing.T) {
+	a := minHashSignature(exampleShingles("a.yaml", "# comment\nb: 2\na:\n  - x\n  - y\n"))
+	b := minHashSignature(exampleShingles("b.yaml", "a: [y, x]\nb: 2\n"))
+	if sim := signatureSimilarity(&a, &b); sim != 1 {
+		t.Errorf("key order, list order, comments and style should not matter, similarity %v", sim)
+	}
+}
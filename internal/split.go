@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Split modes for Kubernetes manifests in the output.
+const (
+	SplitOff    = ""
+	SplitObject = "object"
+	SplitKind   = "kind"
+)
+
+// DefaultNamePatterns are the file name templates used per split mode unless
+// a pattern is configured.
+var DefaultNamePatterns = map[string]string{
+	SplitObject: "{{.kind | lower}}-{{.metadata.name}}.yaml",
+	SplitKind:   "{{.kind | lower}}.yaml",
+}
+
+// ManifestSplitter names the Kubernetes objects of the output from a template
+// instead of the file names the model chose. Objects rendering the same name
+// end up in one file, so a pattern without the object name groups them.
+type ManifestSplitter struct {
+	Mode    string
+	Pattern string
+	tmpl    *template.Template
+}
+
+// NewManifestSplitter parses the name pattern for mode, which is SplitObject
+// or SplitKind. An empty pattern uses the default of the mode.
+func NewManifestSplitter(mode, pattern string) (*ManifestSplitter, error) {
+	def, ok := DefaultNamePatterns[mode]
+	if !ok {
+		return nil, fmt.Errorf("invalid split mode %q: must be %s or %s", mode, SplitObject, SplitKind)
+	}
+	if pattern == "" {
+		pattern = def
+	}
+	tmpl, err := template.New("name").Funcs(instructionFuncs).Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse name pattern: %w", err)
+	}
+	return &ManifestSplitter{Mode: mode, Pattern: pattern, tmpl: tmpl}, nil
+}
+
+// Split moves every YAML document with a kind and a metadata.name into the file
+// its pattern renders. Documents that are not Kubernetes objects stay in the
+// file they came from, as do files that are not YAML or fail to parse. Files
+// keep the order in which they first appear.
+func (s *ManifestSplitter) Split(output string) (string, error) {
+	var (
+		order  []string
+		listed = map[string]bool{}
+		docs   = map[string][]*yaml.Node{}
+		passed = map[string]string{}
+	)
+	list := func(name string) {
+		if !listed[name] {
+			listed[name] = true
+			order = append(order, name)
+		}
+	}
+
+	for _, f := range ParseGeneratedFiles(output) {
+		var nodes []*yaml.Node
+		var err error
+		if isYAMLPath(f.Name) {
+			nodes, err = decodeYAMLDocuments(f.Content)
+		}
+		if !isYAMLPath(f.Name) || err != nil {
+			list(f.Name)
+			passed[f.Name] = f.Content
+			continue
+		}
+		for _, node := range nodes {
+			name, ok, err := s.fileName(node)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				name = f.Name
+			}
+			list(name)
+			docs[name] = append(docs[name], node)
+		}
+	}
+
+	var files []GeneratedFile
+	for _, name := range order {
+		content, isPassed := passed[name]
+		if len(docs[name]) > 0 {
+			encoded, err := encodeYAMLDocuments(docs[name])
+			if err != nil {
+				return "", fmt.Errorf("failed to encode %s: %w", name, err)
+			}
+			if isPassed {
+				content = strings.TrimRight(content, "\n") + "\n---\n"
+			}
+			content += encoded + "\n"
+		}
+		files = append(files, GeneratedFile{Name: name, Content: content})
+	}
+	return RenderGeneratedFiles(files), nil
+}
+
+// fileName renders the pattern for a Kubernetes object. The template sees the
+// whole document plus name and namespace from its metadata; missing values
+// render empty.
+func (s *ManifestSplitter) fileName(node *yaml.Node) (string, bool, error) {
+	obj, ok := objectOf(node)
+	if !ok {
+		return "", false, nil
+	}
+	var data map[string]interface{}
+	if err := node.Decode(&data); err != nil {
+		return "", false, nil
+	}
+	if _, ok := data["name"]; !ok {
+		data["name"] = obj.Name
+	}
+	if _, ok := data["namespace"]; !ok {
+		data["namespace"] = obj.Namespace
+	}
+
+	var b strings.Builder
+	if err := s.tmpl.Execute(&b, data); err != nil {
+		return "", false, fmt.Errorf("failed to render name pattern for %s/%s: %w", obj.Kind, obj.Name, err)
+	}
+	// Missing map keys render as "<no value>"; an empty namespace directory
+	// disappears when the path is cleaned.
+	name := path.Clean("/" + strings.ReplaceAll(b.String(), "<no value>", ""))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || strings.HasSuffix(b.String(), "/") {
+		return "", false, fmt.Errorf("name pattern %q renders no file name for %s/%s", s.Pattern, obj.Kind, obj.Name)
+	}
+	return name, true, nil
+}
+
+// objectOf reads kind, name and namespace of a Kubernetes object.
+func objectOf(node *yaml.Node) (manifestInfo, bool) {
+	if node.Kind != yaml.MappingNode {
+		return manifestInfo{}, false
+	}
+	var doc struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name      string `yaml:"name"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"metadata"`
+	}
+	if err := node.Decode(&doc); err != nil || doc.Kind == "" || doc.Metadata.Name == "" {
+		return manifestInfo{}, false
+	}
+	return manifestInfo{Kind: doc.Kind, Name: doc.Metadata.Name, Namespace: doc.Metadata.Namespace}, true
+}
+
+// DuplicateObjects lists Kubernetes objects that occur more than once in the
+// output with the same kind, name and namespace, with the files they are in.
+// It can be used as a Validator, so the model merges or renames them.
+func DuplicateObjects(output string) []string {
+	type object struct{ kind, namespace, name string }
+	seen := map[object][]string{}
+	for _, f := range ParseGeneratedFiles(output) {
+		if !isYAMLPath(f.Name) {
+			continue
+		}
+		nodes, err := decodeYAMLDocuments(f.Content)
+		if err != nil {
+			continue
+		}
+		for _, node := range nodes {
+			if info, ok := objectOf(node); ok {
+				key := object{info.Kind, info.Namespace, info.Name}
+				seen[key] = append(seen[key], f.Name)
+			}
+		}
+	}
+
+	var problems []string
+	for o, files := range seen {
+		if len(files) < 2 {
+			continue
+		}
+		where := ""
+		if o.namespace != "" {
+			where = " in namespace " + o.namespace
+		}
+		problems = append(problems, fmt.Sprintf("duplicate object %s/%s%s in %s", o.kind, o.name, where, strings.Join(files, ", ")))
+	}
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+const splitOutput = `# file: all.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: shop
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  namespace: shop
+# file: values.yaml
+replicas: 2
+# file: README.md
+kind: not yaml
+`
+
+func splitNames(t *testing.T, output string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	for _, f := range ParseGeneratedFiles(output) {
+		files[f.Name] = f.Content
+	}
+	return files
+}
+
+func TestManifestSplitterObject(t *testing.T) {
+	s, err := NewManifestSplitter(SplitObject, "{{.namespace}}/{{.kind | lower}}-{{.metadata.name}}.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Split(splitOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, f := range ParseGeneratedFiles(out) {
+		order = append(order, f.Name)
+	}
+	want := []string{"shop/deployment-web.yaml", "shop/service-web.yaml", "shop/deployment-worker.yaml", "values.yaml", "README.md"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("got files %v, want %v", order, want)
+	}
+	files := splitNames(t, out)
+	if !strings.Contains(files["shop/service-web.yaml"], "kind: Service") || strings.Contains(files["shop/service-web.yaml"], "---") {
+		t.Errorf("service file:\n%s", files["shop/service-web.yaml"])
+	}
+	if !strings.Contains(files["values.yaml"], "replicas: 2") || !strings.Contains(files["README.md"], "not yaml") {
+		t.Errorf("other files changed: %v", files)
+	}
+}
+
+func TestManifestSplitterKind(t *testing.T) {
+	s, err := NewManifestSplitter(SplitKind, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Split(splitOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := splitNames(t, out)
+	deployments := files["deployment.yaml"]
+	if strings.Count(deployments, "kind: Deployment") != 2 || strings.Count(deployments, "---") != 1 {
+		t.Errorf("deployments not grouped:\n%s", deployments)
+	}
+	if _, ok := files["service.yaml"]; !ok {
+		t.Errorf("no service.yaml in %v", files)
+	}
+}
+
+func TestManifestSplitterMissingValues(t *testing.T) {
+	s, err := NewManifestSplitter(SplitObject, "{{.namespace}}/{{.metadata.labels.app}}{{.kind | lower}}.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Split("# file: x.yaml\nkind: ConfigMap\nmetadata:\n  name: cfg\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := splitNames(t, out); files["configmap.yaml"] == "" {
+		t.Errorf("got %v", files)
+	}
+
+	if _, err := NewManifestSplitter("file", ""); err == nil {
+		t.Error("expected invalid mode error")
+	}
+	if _, err := NewManifestSplitter(SplitObject, "{{.kind"); err == nil {
+		t.Error("expected parse error")
+	}
+	s, _ = NewManifestSplitter(SplitObject, "{{.namespace}}/")
+	if _, err := s.Split("# file: x.yaml\nkind: ConfigMap\nmetadata:\n  name: cfg\n"); err == nil {
+		t.Error("expected error for a pattern without file name")
+	}
+}
+
+func TestDuplicateObjects(t *testing.T) {
+	output := splitOutput + `# file: extra.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+---
+kind: Deployment
+metadata:
+  name: web
+  namespace: other
+`
+	problems := DuplicateObjects(output)
+	if len(problems) != 1 || problems[0] != "duplicate object Deployment/web in namespace shop in all.yaml, extra.yaml" {
+		t.Errorf("got %v", problems)
+	}
+	if problems := DuplicateObjects(splitOutput); len(problems) != 0 {
+		t.Errorf("unexpected problems %v", problems)
+	}
+}
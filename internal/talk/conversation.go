@@ -15,8 +15,9 @@ type AIResponse struct {
 
 // BuildSystemPrompt constructs a system prompt that includes all available
 // claim templates and their parameter schemas so the AI can match user intent
-// to a specific template and fill in the parameters.
-func BuildSystemPrompt(templates []ClaimTemplate) string {
+// to a specific template and fill in the parameters. referenceContext is an
+// optional, already rendered section with facts about the environment.
+func BuildSystemPrompt(templates []ClaimTemplate, referenceContext string) string {
 	var b strings.Builder
 
 	b.WriteString("You are an infrastructure assistant that helps users provision Crossplane claims.\n")
@@ -60,6 +61,10 @@ func BuildSystemPrompt(templates []ClaimTemplate) string {
 	}
 
 	b.WriteString(strings.Repeat("=", 60) + "\n\n")
+	if referenceContext != "" {
+		b.WriteString(referenceContext)
+		b.WriteString("Use the reference context to fill in parameter values, e.g. existing names, namespaces and versions.\n\n")
+	}
 	b.WriteString("INSTRUCTIONS:\n")
 	b.WriteString("Based on the user's request, select the most appropriate template and fill in the parameters.\n")
 	b.WriteString("Respond with ONLY a JSON block in the following format (no markdown fences, no extra text):\n\n")
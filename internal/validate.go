@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validator inspects generated output and returns a list of problems.
+// An empty result means the output passed the check.
+type Validator func(content string) []string
+
+// ValidateYAML checks that every parsed file with a YAML extension contains
+// well-formed YAML documents.
+func ValidateYAML(content string) []string {
+	var problems []string
+
+	for _, f := range ParseGeneratedFiles(content) {
+		ext := strings.ToLower(filepath.Ext(f.Name))
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		if err := checkYAMLDocuments(f.Content); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid YAML: %v", f.Name, err))
+		}
+	}
+
+	return problems
+}
+
+// checkYAMLDocuments decodes all documents in a YAML stream and reports the first error.
+func checkYAMLDocuments(content string) error {
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// CommandValidator returns a Validator that runs a user-supplied shell command
+// against the generated output. The raw output is passed on stdin and the parsed
+// files are written to a temporary directory exposed as K2N_OUTPUT_DIR.
+// A non-zero exit status is reported as a problem together with the command output.
+func CommandValidator(command string) Validator {
+	return func(content string) []string {
+		dir, err := os.MkdirTemp("", "k2n-check-")
+		if err != nil {
+			return []string{fmt.Sprintf("check %q: failed to create temp dir: %v", command, err)}
+		}
+		defer os.RemoveAll(dir)
+
+		for _, f := range ParseGeneratedFiles(content) {
+			fullPath, err := SafeJoin(dir, f.Name)
+			if err != nil {
+				return []string{fmt.Sprintf("check %q: %v", command, err)}
+			}
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+				return []string{fmt.Sprintf("check %q: failed to create directory for %s: %v", command, f.Name, err)}
+			}
+			if err := os.WriteFile(fullPath, []byte(f.Content), 0644); err != nil {
+				return []string{fmt.Sprintf("check %q: failed to write %s: %v", command, f.Name, err)}
+			}
+		}
+
+		var out bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = strings.NewReader(content)
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		cmd.Env = append(os.Environ(), "K2N_OUTPUT_DIR="+dir)
+
+		if err := cmd.Run(); err != nil {
+			msg := strings.TrimSpace(out.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			return []string{fmt.Sprintf("check %q failed: %s", command, msg)}
+		}
+		return nil
+	}
+}
+
+// CombineValidators runs all validators in order and concatenates their problems.
+func CombineValidators(validators ...Validator) Validator {
+	return func(content string) []string {
+		var problems []string
+		for _, v := range validators {
+			if v == nil {
+				continue
+			}
+			problems = append(problems, v(content)...)
+		}
+		return problems
+	}
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateYAML(t *testing.T) {
+	valid := `
+# ok.yaml
+apiVersion: v1
+kind: ConfigMap
+`
+	if problems := ValidateYAML(valid); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+
+	invalid := `
+# broken.yaml
+apiVersion: v1
+kind: [ConfigMap
+`
+	problems := ValidateYAML(invalid)
+	if len(problems) != 1 || !strings.Contains(problems[0], "broken.yaml") {
+		t.Errorf("expected one problem for broken.yaml, got %v", problems)
+	}
+
+	nonYAML := `
+# main.tf
+resource "x" "y" { [
+`
+	if problems := ValidateYAML(nonYAML); len(problems) != 0 {
+		t.Errorf("expected non-YAML files to be skipped, got %v", problems)
+	}
+}
+
+func TestCommandValidator(t *testing.T) {
+	content := "\n# a.yaml\nkey: value\n"
+
+	if problems := CommandValidator(`test -f "$K2N_OUTPUT_DIR/a.yaml"`)(content); len(problems) != 0 {
+		t.Errorf("expected check to pass, got %v", problems)
+	}
+
+	problems := CommandValidator("echo nope; exit 1")(content)
+	if len(problems) != 1 || !strings.Contains(problems[0], "nope") {
+		t.Errorf("expected failing check with output, got %v", problems)
+	}
+
+	problems = CommandValidator("true")("\n# ../../escape.yaml\nkey: value\n")
+	if len(problems) != 1 || !strings.Contains(problems[0], "escapes") {
+		t.Errorf("expected path traversal to be rejected, got %v", problems)
+	}
+}